@@ -2,12 +2,16 @@ package app
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -24,10 +28,13 @@ type Post struct {
 
 // ViewData represents the data passed to the template.
 type ViewData struct {
-	Host        string
-	Title       string
-	Posts       []Post
-	NodeAddress string
+	Host           string
+	Title          string
+	Posts          []Post
+	Query          string // search query, empty for all posts
+	NodeAddress    string
+	CSRFToken      string // token of the forms
+	IdempotencyKey string // key of the node requests made by the forms of the page
 }
 
 // Application represents the client application.
@@ -39,7 +46,8 @@ type Application struct {
 // ConnectedNodeAddress is the address of the connected blockchain node.
 const ConnectedNodeAddress = "http://127.0.0.1:8000"
 
-var posts []Post
+// PostsPageSize is the number of posts fetched per request (the node maximum).
+const PostsPageSize = 100
 
 // NewApplication creates a new blockchain application.
 func NewApplication() (*Application, error) {
@@ -60,58 +68,81 @@ func NewApplication() (*Application, error) {
 func (app *Application) SetupRoutes() {
 	// app.Router.Get("/", app.HandleHomePage)
 	app.Router.Get("/", app.IndexHandler)
-	app.Router.Post("/submit", app.SubmitTextareaHandler)
+	app.Router.Post("/submit", protectForm(app.SubmitTextareaHandler))
+	app.Router.Post("/mine", protectForm(app.MineHandler))
+	app.Router.Get("/events", app.EventsHandler)
 }
 
-// Function to fetch the chain from a blockchain node, parse the
-// data, and store it locally.
+// Function to fetch the posts from a blockchain node, page by page from
+// its posts index, and store them locally.
 func (app *Application) FetchPosts(posts *[]Post) {
-	getChainAddress := app.node + "/chain"
-	response, err := http.Get(getChainAddress)
-	if err != nil {
-		log.Println(err)
-	}
-	defer response.Body.Close()
+	app.fetchPostPages("/posts?", posts)
+}
+
+// Function to fetch the posts matching the search query from a blockchain node.
+func (app *Application) SearchPosts(query string, posts *[]Post) {
+	app.fetchPostPages("/search?q="+url.QueryEscape(query)+"&", posts)
+}
 
-	//check request is successful and get response data and pass to posts ref.
-	if response != nil && response.StatusCode == http.StatusOK {
-		var chain struct {
-			Chain []struct {
-				Index        int           `json:"index"`
-				Transactions []interface{} `json:"transactions"`
-				PreviousHash string        `json:"previous_hash"`
-			} `json:"chain"`
+// fetchPostPages fetches every page of posts of the node endpoint path (ending with
+// the start of a query string).
+func (app *Application) fetchPostPages(path string, posts *[]Post) {
+	*posts = nil
+	for offset := 0; ; {
+		getPostsAddress := fmt.Sprintf("%s%soffset=%d&limit=%d", app.node, path, offset, PostsPageSize)
+		response, err := http.Get(getPostsAddress)
+		if err != nil {
+			log.Println(err)
+			return
 		}
-		if err := json.NewDecoder(response.Body).Decode(&chain); err != nil {
-			log.Fatal(err)
+		//check request is successful and get response data and pass to posts ref.
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			log.Println("Failed to fetch posts:", response.Status)
+			return
 		}
-		*posts = nil
-		for _, block := range chain.Chain {
-			for _, tx := range block.Transactions {
-				txMap := tx.(map[string]interface{})
-				index := block.Index
-				hash := block.PreviousHash
-				author := txMap["author"].(string)
-				content := txMap["content"].(string)
-				timestamp := int64(txMap["timestamp"].(float64))
-
-				post := Post{
-					Author:    author,
-					Content:   content,
-					Index:     index,
-					Hash:      hash,
-					Timestamp: timestamp,
-				}
-				*posts = append(*posts, post)
-			}
+		var page struct {
+			Total int `json:"total"`
+			Posts []struct {
+				Author      string `json:"author"`
+				Content     string `json:"content"`
+				Timestamp   int64  `json:"timestamp"`
+				BlockHeight int    `json:"block_height"`
+				BlockHash   string `json:"block_hash"`
+			} `json:"posts"`
+		}
+		err = json.NewDecoder(response.Body).Decode(&page)
+		response.Body.Close()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		for _, post := range page.Posts {
+			*posts = append(*posts, Post{
+				Author:    post.Author,
+				Content:   post.Content,
+				Index:     post.BlockHeight,
+				Hash:      post.BlockHash,
+				Timestamp: post.Timestamp,
+			})
+		}
+		offset += len(page.Posts)
+		if len(page.Posts) == 0 || offset >= page.Total {
+			return
 		}
 	}
 }
 
 // Endpoing: Index Request handler to respond with html file
 func (app *Application) IndexHandler(w http.ResponseWriter, r *http.Request) {
-	//fetch posts from node
-	app.FetchPosts(&posts)
+	//fetch posts (or the posts matching the search query) from node
+	var posts []Post
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query != "" {
+		app.SearchPosts(query, &posts)
+	} else {
+		app.FetchPosts(&posts)
+	}
 	//prepare template for forwarding
 	tmpl, err := template.New("index.html").Funcs(template.FuncMap{
 		"ReadableTime": app.TimestampToString,
@@ -123,10 +154,13 @@ func (app *Application) IndexHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 	}
 	viewData := ViewData{
-		Title:       "YourNet: Decentralized content sharing",
-		Posts:       posts,
-		NodeAddress: ConnectedNodeAddress,
-		Host:        r.Host,
+		Title:          "YourNet: Decentralized content sharing",
+		Posts:          posts,
+		Query:          query,
+		NodeAddress:    app.node,
+		Host:           r.Host,
+		CSRFToken:      csrfToken(w, r),
+		IdempotencyKey: randomToken(),
 	}
 	//write template and send with passed in values (struct) and functions
 	if err := tmpl.Execute(w, viewData); err != nil {
@@ -153,18 +187,124 @@ func (app *Application) SubmitTextareaHandler(w http.ResponseWriter, r *http.Req
 	newTxAddress := app.node + "/new_transaction"
 	payload, err := json.Marshal(postObject)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		http.Error(w, "Invalid post", http.StatusInternalServerError)
+		return
 	}
 
-	//post new transaction to node and redirect to home page
-	_, err = http.Post(newTxAddress, "application/json", bytes.NewBuffer(payload))
+	//post new transaction to node, a resubmitted form isn't posted twice while an
+	//edited one is a new post: the key of the node request is the form key with the post
+	response, err := app.postToNode(newTxAddress, contentKey(r.PostFormValue(IdempotencyField), payload), payload)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		http.Error(w, "Node unavailable", http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		writeNodeError(w, response, "Posting failed: ")
+		return
 	}
 
 	//redirect to home page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// Endpoint: asks the node to mine the pending transactions, then back to the home page
+func (app *Application) MineHandler(w http.ResponseWriter, r *http.Request) {
+	response, err := app.postToNode(app.node+"/mine", r.PostFormValue(IdempotencyField), nil)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Node unavailable", http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		writeNodeError(w, response, "Mining failed: ")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// writeNodeError sends the error of the node response to the visitor, with its status.
+func writeNodeError(w http.ResponseWriter, response *http.Response, prefix string) {
+	var nodeError struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(response.Body).Decode(&nodeError)
+	if nodeError.Error.Message == "" {
+		nodeError.Error.Message = response.Status
+	}
+	http.Error(w, prefix+nodeError.Error.Message, response.StatusCode)
+}
+
+// contentKey returns the idempotency key of a node request made by a form with the key,
+// derived from the payload so that a changed form gets a new key. Empty without form key.
+func contentKey(formKey string, payload []byte) string {
+	if formKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256(append([]byte(formKey+"\n"), payload...))
+	return hex.EncodeToString(sum[:])
+}
+
+// postToNode posts the json payload to the node address, with the idempotency key if any.
+func (app *Application) postToNode(address string, idempotencyKey string, payload []byte) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodPost, address, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		request.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	return http.DefaultClient.Do(request)
+}
+// Endpoint: relays the block and reorg events of the node (server-sent events) to the page
+func (app *Application) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	request, err := http.NewRequestWithContext(r.Context(), http.MethodGet, app.node+"/events?types=block,reorg", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Node unavailable", http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		http.Error(w, "Node unavailable", http.StatusBadGateway)
+		return
+	}
+	// the stream outlives the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	buffer := make([]byte, 4096)
+	for {
+		n, err := response.Body.Read(buffer)
+		if n > 0 {
+			if _, err := w.Write(buffer[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 //Time stamp to readable string (like - just now, yesterday etc)
 func (app *Application) TimestampToString(stamp int64) string {
 	timestamp := time.Unix(stamp, 0)
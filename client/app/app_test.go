@@ -0,0 +1,179 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// nodeRequest is a request received by the fake node.
+type nodeRequest struct {
+	path           string
+	idempotencyKey string
+	body           string
+}
+
+// newTestClient returns a client application connected to a fake node answering
+// with the status and body, and the requests the node received.
+func newTestClient(t *testing.T, status int, body string) (*Application, *[]nodeRequest) {
+	t.Helper()
+	requests := &[]nodeRequest{}
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, nodeRequest{path: r.URL.Path, idempotencyKey: r.Header.Get("Idempotency-Key"), body: string(data)})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(node.Close)
+	app := &Application{Router: chi.NewRouter(), node: node.URL}
+	app.SetupRoutes()
+	return app, requests
+}
+
+// postForm posts the form values to the client with the CSRF cookie.
+func postForm(app *Application, target string, cookie string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestProtectForm(t *testing.T) {
+	token := randomToken()
+	tests := []struct {
+		name       string
+		cookie     string
+		form       url.Values
+		query      url.Values
+		wantStatus int
+	}{
+		{name: "valid", cookie: token, form: url.Values{CSRFField: {token}}, wantStatus: http.StatusSeeOther},
+		{name: "no cookie", form: url.Values{CSRFField: {token}}, wantStatus: http.StatusForbidden},
+		{name: "no token", cookie: token, form: url.Values{}, wantStatus: http.StatusForbidden},
+		{name: "other token", cookie: token, form: url.Values{CSRFField: {randomToken()}}, wantStatus: http.StatusForbidden},
+		{name: "token in the query", cookie: token, form: url.Values{}, query: url.Values{CSRFField: {token}}, wantStatus: http.StatusForbidden},
+		{name: "form too large", cookie: token, form: url.Values{CSRFField: {token}, "content": {strings.Repeat("x", MaxFormSize)}}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, requests := newTestClient(t, http.StatusCreated, `{}`)
+			w := postForm(app, "/submit?"+tt.query.Encode(), tt.cookie, tt.form)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if posted := len(*requests) > 0; posted != (tt.wantStatus == http.StatusSeeOther) {
+				t.Errorf("posted to the node %v, want %v", posted, !posted)
+			}
+		})
+	}
+}
+
+func TestSubmitTextareaHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodeStatus int
+		nodeBody   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "created", nodeStatus: http.StatusCreated, nodeBody: `{"id":"1","status":"pending"}`, wantStatus: http.StatusSeeOther},
+		{name: "invalid transaction", nodeStatus: http.StatusBadRequest, nodeBody: `{"error":{"code":"invalid_transaction","message":"Invalid transaction data"}}`, wantStatus: http.StatusBadRequest, wantBody: "Posting failed: Invalid transaction data"},
+		{name: "key reused", nodeStatus: http.StatusUnprocessableEntity, nodeBody: `{"error":{"code":"idempotency_key_reused","message":"Idempotency key already used for another request"}}`, wantStatus: http.StatusUnprocessableEntity, wantBody: "Idempotency key already used"},
+		{name: "key in use", nodeStatus: http.StatusConflict, nodeBody: `{"error":{"code":"idempotency_key_in_use","message":"A request with this idempotency key is in progress"}}`, wantStatus: http.StatusConflict, wantBody: "in progress"},
+		{name: "no error message", nodeStatus: http.StatusInternalServerError, nodeBody: `oops`, wantStatus: http.StatusInternalServerError, wantBody: "500 Internal Server Error"},
+	}
+	token := randomToken()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, requests := newTestClient(t, tt.nodeStatus, tt.nodeBody)
+			w := postForm(app, "/submit", token, url.Values{CSRFField: {token}, IdempotencyField: {"page"}, "author": {"alice"}, "content": {"hello"}})
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("status %d %q, want %d %q", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+			}
+			if len(*requests) != 1 || (*requests)[0].path != "/new_transaction" || (*requests)[0].body != `{"author":"alice","content":"hello"}` {
+				t.Errorf("node requests %+v", *requests)
+			}
+		})
+	}
+
+	t.Run("node unavailable", func(t *testing.T) {
+		app := &Application{Router: chi.NewRouter(), node: "http://127.0.0.1:1"}
+		app.SetupRoutes()
+		if w := postForm(app, "/submit", token, url.Values{CSRFField: {token}, "content": {"hello"}}); w.Code != http.StatusBadGateway {
+			t.Errorf("status %d, want %d", w.Code, http.StatusBadGateway)
+		}
+	})
+}
+
+// TestSubmitIdempotencyKey checks a resubmitted form is sent with the same key and an
+// edited one with a new key.
+func TestSubmitIdempotencyKey(t *testing.T) {
+	app, requests := newTestClient(t, http.StatusCreated, `{}`)
+	token := randomToken()
+	submits := []struct {
+		formKey string
+		content string
+	}{
+		{"page1", "hello"},
+		{"page1", "hello"},
+		{"page1", "hello again"},
+		{"page2", "hello"},
+		{"", "hello"},
+	}
+	for _, submit := range submits {
+		postForm(app, "/submit", token, url.Values{CSRFField: {token}, IdempotencyField: {submit.formKey}, "author": {"alice"}, "content": {submit.content}})
+	}
+	keys := []string{}
+	for _, request := range *requests {
+		keys = append(keys, request.idempotencyKey)
+	}
+	if len(keys) != len(submits) {
+		t.Fatalf("%d node requests, want %d", len(keys), len(submits))
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("resubmitted form keys %q and %q, want the same key", keys[0], keys[1])
+	}
+	if keys[2] == keys[0] || keys[3] == keys[0] || keys[3] == keys[2] {
+		t.Errorf("keys %q, want a new key for edited content and for another page", keys[:4])
+	}
+	if keys[4] != "" {
+		t.Errorf("key %q without form key, want none", keys[4])
+	}
+}
+
+func TestMineHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodeStatus int
+		nodeBody   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "mined", nodeStatus: http.StatusOK, nodeBody: `{"message":"New block mined"}`, wantStatus: http.StatusSeeOther},
+		{name: "not in turn", nodeStatus: http.StatusConflict, nodeBody: `{"error":{"code":"not_in_turn","message":"Not in turn to seal block"}}`, wantStatus: http.StatusConflict, wantBody: "Mining failed: Not in turn to seal block"},
+		{name: "key reused", nodeStatus: http.StatusUnprocessableEntity, nodeBody: `{"error":{"code":"idempotency_key_reused","message":"Idempotency key already used for another request"}}`, wantStatus: http.StatusUnprocessableEntity, wantBody: "Idempotency key already used"},
+	}
+	token := randomToken()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, requests := newTestClient(t, tt.nodeStatus, tt.nodeBody)
+			w := postForm(app, "/mine", token, url.Values{CSRFField: {token}, IdempotencyField: {"page"}})
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("status %d %q, want %d %q", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+			}
+			if len(*requests) != 1 || (*requests)[0].path != "/mine" || (*requests)[0].idempotencyKey != "page" {
+				t.Errorf("node requests %+v", *requests)
+			}
+		})
+	}
+}
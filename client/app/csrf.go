@@ -0,0 +1,61 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// Form protection: the page sets a random token in a cookie and in its forms, and
+// form posts are only accepted when both match (double submit cookie), so other
+// sites can't post the forms for the visitor.
+const (
+	CSRFCookie       = "csrf_token"
+	CSRFField        = "csrf_token"      // form field holding the token
+	IdempotencyField = "idempotency_key" // form field holding the key of the node request
+	MaxFormSize      = 64 << 10          // bytes of a form body
+)
+
+// csrfToken returns the token of the visitor, setting a new one if it has none.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+	token := randomToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// protectForm limits the form size and rejects the posts without a valid token.
+func protectForm(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxFormSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		cookie, err := r.Cookie(CSRFCookie)
+		if err != nil || cookie.Value == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.PostFormValue(CSRFField))) != 1 {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// randomToken returns 32 random bytes in hex.
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,16 +1,113 @@
 package main
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/chokey2nv/ultainfinity/client"
 	"github.com/chokey2nv/ultainfinity/node"
+	"github.com/chokey2nv/ultainfinity/node/app"
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
 	"github.com/urfave/cli"
 )
 
+// node consensus flags, shared by node and all commands
+var consensusFlags = []cli.Flag{
+	&cli.StringFlag{Name: "genesis", Usage: "genesis config file (network id, consensus, allocations, validators)"},
+	&cli.StringFlag{Name: "consensus", Usage: "set consensus engine (pow, poa, pos)"},
+	&cli.StringFlag{Name: "validators", Usage: "comma separated validator public keys (poa, finality)"},
+	&cli.StringFlag{Name: "validator-key", Usage: "validator private key used to seal blocks and sign votes", EnvVar: "VALIDATOR_KEY"},
+	&cli.StringFlag{Name: "allocations", Usage: "comma separated initial balances as pubkey=amount (pos)"},
+	&cli.StringFlag{Name: "stakes", Usage: "comma separated initial stakes as pubkey=amount (pos)"},
+	&cli.Int64Flag{Name: "slot-duration", Usage: "slot length in seconds (pos)"},
+	&cli.BoolFlag{Name: "finality", Usage: "finalize blocks by 2/3+ votes of the validators"},
+	&cli.StringFlag{Name: "checkpoints", Usage: "comma separated checkpoints as height:hash"},
+	&cli.IntFlag{Name: "max-reorg-depth", Usage: "max number of blocks reverted by consensus (default 100, -1 for unlimited)"},
+}
+
+// nodeConfig reads node options from the command flags
+func nodeConfig(cCtx *cli.Context) (app.Config, error) {
+	config := app.Config{
+		Consensus: blockchain.EngineConfig{
+			Name:         cCtx.String("consensus"),
+			PrivateKey:   cCtx.String("validator-key"),
+			SlotDuration: cCtx.Int64("slot-duration"),
+		},
+		Finality:      cCtx.Bool("finality"),
+		MaxReorgDepth: cCtx.Int("max-reorg-depth"),
+		Checkpoints:   map[int]string{},
+		AdvertiseAddr: cCtx.String("advertise-addr"),
+		Bootstrap:     blockchain.ParseAddressList(cCtx.String("bootstrap")),
+		TargetPeers:   cCtx.Int("target-peers"),
+		P2PAddr:       cCtx.String("p2p-addr"),
+		P2PPeers:      blockchain.ParseAddressList(cCtx.String("p2p-peers")),
+		GRPCAddr:      cCtx.String("grpc-addr"),
+	}
+	if file := cCtx.String("genesis"); file != "" {
+		genesis, err := blockchain.LoadGenesis(file)
+		if err != nil {
+			return config, err
+		}
+		config.Genesis = genesis
+	}
+	if validators := cCtx.String("validators"); validators != "" {
+		config.Consensus.Validators = strings.Split(validators, ",")
+	}
+	var err error
+	config.Consensus.Allocations, err = parseAmounts(cCtx.String("allocations"))
+	if err != nil {
+		return config, err
+	}
+	config.Consensus.Stakes, err = parseAmounts(cCtx.String("stakes"))
+	if err != nil {
+		return config, err
+	}
+	if checkpoints := cCtx.String("checkpoints"); checkpoints != "" {
+		for _, checkpoint := range strings.Split(checkpoints, ",") {
+			height, hash, found := strings.Cut(checkpoint, ":")
+			parsed, err := strconv.Atoi(height)
+			if !found || err != nil {
+				return config, fmt.Errorf("invalid checkpoint %q, expected height:hash", checkpoint)
+			}
+			config.Checkpoints[parsed] = strings.TrimSpace(hash)
+		}
+	}
+	return config, nil
+}
+
+// parseAmounts parses a comma separated list of account=amount pairs
+func parseAmounts(value string) (map[string]int64, error) {
+	amounts := map[string]int64{}
+	if value == "" {
+		return amounts, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		account, amount, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid amount %q, expected account=amount", pair)
+		}
+		parsed, err := strconv.ParseInt(amount, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q: %v", pair, err)
+		}
+		amounts[strings.TrimSpace(account)] = parsed
+	}
+	return amounts, nil
+}
+
 func main() {
 	// Create a channel to receive termination signals
 	signalCh := make(chan os.Signal, 1)
@@ -24,12 +121,22 @@ func main() {
 			{
 				Name:  "node",
 				Usage: "start blockchain server",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{Name: "port", Usage: "set node port"},
-				},
+					&cli.StringFlag{Name: "advertise-addr", Usage: "public address of the node sent to peers", EnvVar: "ADVERTISE_ADDR"},
+					&cli.StringFlag{Name: "bootstrap", Usage: "comma separated addresses of nodes to discover peers from", EnvVar: "BOOTSTRAP"},
+					&cli.IntFlag{Name: "target-peers", Usage: "number of peers to connect to (default 8)"},
+					&cli.StringFlag{Name: "p2p-addr", Usage: "listen address of the p2p transport (e.g. :9000), disabled if empty", EnvVar: "P2P_ADDR"},
+					&cli.StringFlag{Name: "p2p-peers", Usage: "comma separated host:port of p2p nodes to connect to", EnvVar: "P2P_PEERS"},
+					&cli.StringFlag{Name: "grpc-addr", Usage: "listen address of the gRPC API (e.g. :9090), disabled if empty", EnvVar: "GRPC_ADDR"},
+				}, consensusFlags...),
 				Action: func(cCtx *cli.Context) error {
 					port := cCtx.Int64("port")
-					node.StartServer(port)
+					config, err := nodeConfig(cCtx)
+					if err != nil {
+						return err
+					}
+					node.StartServer(port, config)
 					return nil
 				},
 			},
@@ -44,13 +151,23 @@ func main() {
 			{
 				Name:  "all",
 				Usage: "start node & client servers",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{Name: "node-port", Usage: "set node port"},
-				},
+					&cli.StringFlag{Name: "advertise-addr", Usage: "public address of the node sent to peers", EnvVar: "ADVERTISE_ADDR"},
+					&cli.StringFlag{Name: "bootstrap", Usage: "comma separated addresses of nodes to discover peers from", EnvVar: "BOOTSTRAP"},
+					&cli.IntFlag{Name: "target-peers", Usage: "number of peers to connect to (default 8)"},
+					&cli.StringFlag{Name: "p2p-addr", Usage: "listen address of the p2p transport (e.g. :9000), disabled if empty", EnvVar: "P2P_ADDR"},
+					&cli.StringFlag{Name: "p2p-peers", Usage: "comma separated host:port of p2p nodes to connect to", EnvVar: "P2P_PEERS"},
+					&cli.StringFlag{Name: "grpc-addr", Usage: "listen address of the gRPC API (e.g. :9090), disabled if empty", EnvVar: "GRPC_ADDR"},
+				}, consensusFlags...),
 				Action: func(cCtx *cli.Context) error {
 					port := cCtx.Int64("node-port")
+					config, err := nodeConfig(cCtx)
+					if err != nil {
+						return err
+					}
 					go client.StartServer()
-					go node.StartServer(port)
+					go node.StartServer(port, config)
 					// Wait for termination signal
 					<-signalCh
 
@@ -71,6 +188,54 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "keygen",
+				Usage: "generate a validator key pair",
+				Action: func(cCtx *cli.Context) error {
+					publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+					if err != nil {
+						return err
+					}
+					fmt.Println("public key: ", hex.EncodeToString(publicKey))
+					fmt.Println("private key:", hex.EncodeToString(privateKey.Seed()))
+					return nil
+				},
+			},
+			{
+				Name:  "stake",
+				Usage: "submit a signed stake-lock transaction to a node (pos)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "key", Usage: "private key of the staking account", EnvVar: "VALIDATOR_KEY"},
+					&cli.Int64Flag{Name: "amount", Usage: "amount to lock"},
+					&cli.StringFlag{Name: "node", Usage: "node address", Value: "http://127.0.0.1:8000"},
+				},
+				Action: func(cCtx *cli.Context) error {
+					key, err := blockchain.ParsePrivateKey(cCtx.String("key"))
+					if err != nil {
+						return err
+					}
+					tx := blockchain.Transaction{
+						Type:      blockchain.TxTypeStake,
+						Amount:    cCtx.Int64("amount"),
+						Timestamp: time.Now().Unix(),
+					}
+					if err := blockchain.SignTransaction(&tx, key); err != nil {
+						return err
+					}
+					payload, err := json.Marshal(tx)
+					if err != nil {
+						return err
+					}
+					response, err := http.Post(cCtx.String("node")+"/new_transaction", "application/json", bytes.NewBuffer(payload))
+					if err != nil {
+						return err
+					}
+					defer response.Body.Close()
+					body, _ := ioutil.ReadAll(response.Body)
+					fmt.Println(response.Status, string(body))
+					return nil
+				},
+			},
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -3,33 +3,122 @@ package app
 import (
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chokey2nv/ultainfinity/node/blockchain"
+	"github.com/chokey2nv/ultainfinity/node/p2p"
+	"github.com/chokey2nv/ultainfinity/node/webhook"
 	"github.com/go-chi/chi"
+	"google.golang.org/grpc"
 )
 
 // Application represents the blockchain application.
 type Application struct {
 	Blockchain *blockchain.Blockchain
 	Router     *chi.Mux
+	Engine     blockchain.Engine
+	Finality   *blockchain.Finality
+	Peers      *blockchain.PeerManager
+	P2P        *p2p.Transport
+	Sync       *blockchain.Synchronizer
+	Webhooks   *webhook.Manager
+	GRPC       *grpc.Server // nil if the gRPC API is disabled
+	Config     Config
+
+	idempotency *idempotencyStore // responses of the requests with an idempotency key
+}
+
+// Config holds the node options set from the command line.
+type Config struct {
+	Genesis       *blockchain.Genesis // network config, nil for the default network
+	Consensus     blockchain.EngineConfig
+	Finality      bool           // run the finality gadget with the consensus validators
+	Checkpoints   map[int]string // checkpoints added to the hard-coded ones
+	MaxReorgDepth int            // 0 for the default depth, negative for unlimited
+	AdvertiseAddr string         // public address of the node sent to peers
+	Bootstrap     []string       // addresses of the nodes to discover peers from
+	TargetPeers   int            // peers to connect to, 0 for the default count
+	P2PAddr       string         // listen address of the p2p transport, empty to disable it
+	P2PPeers      []string       // host:port of the p2p nodes to connect to
+	GRPCAddr      string         // listen address of the gRPC API, empty to disable it
 }
 
 const BLOCKCHAIN_FILE = "blockchain.json"
 
+// PEERS_FILE is the address book of the node: known peers, their health and ban state.
+const PEERS_FILE = "peers.json"
+
+// WEBHOOKS_FILE holds the registered webhooks with their secrets.
+const WEBHOOKS_FILE = "webhooks.json"
+
 // NewApplication creates a new blockchain application.
-func NewApplication() (*Application, error) {
+func NewApplication(config Config) (*Application, error) {
+	//the network consensus is defined by the genesis config
+	if config.Genesis != nil {
+		config.Consensus = config.Genesis.EngineConfig(config.Consensus.PrivateKey)
+	}
+	engine, err := blockchain.NewEngine(config.Consensus)
+	if err != nil {
+		return nil, err
+	}
 	app := &Application{
-		Router: chi.NewRouter(),
+		Router:      chi.NewRouter(),
+		Engine:      engine,
+		Config:      config,
+		idempotency: newIdempotencyStore(),
 	}
-	err := app.LoadBlockchain(BLOCKCHAIN_FILE)
+	app.Peers, err = blockchain.NewPeerManager(PEERS_FILE)
 	if err != nil {
 		return nil, err
 	}
+	if config.AdvertiseAddr != "" {
+		app.Peers.AdvertiseAddr, err = blockchain.NormalizeAddress(config.AdvertiseAddr)
+		if err != nil {
+			return nil, fmt.Errorf("advertise address: %v", err)
+		}
+	}
+	if config.Finality {
+		app.Finality, err = blockchain.NewFinality(config.Consensus.Validators, config.Consensus.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = app.LoadBlockchain(BLOCKCHAIN_FILE)
+	if err != nil {
+		return nil, err
+	}
+	app.Sync = blockchain.NewSynchronizer(app.Blockchain)
+	if app.Finality != nil {
+		// blocks committed by the validators are synced as soon as we miss one
+		app.Finality.OnMissingBlock = func() {
+			if app.Sync.Sync() {
+				app.onNewTip()
+			}
+		}
+	}
+	app.Webhooks, err = webhook.NewManager(app.Blockchain, WEBHOOKS_FILE)
+	if err != nil {
+		return nil, err
+	}
+	if config.P2PAddr != "" {
+		app.P2P = p2p.NewTransport(app.Blockchain, app.Peers.AdvertiseAddr)
+		app.P2P.OnNewTip = app.onNewTip
+		if err := app.P2P.Listen(config.P2PAddr); err != nil {
+			return nil, fmt.Errorf("p2p: %v", err)
+		}
+	}
+	if config.GRPCAddr != "" {
+		if err := app.ServeGRPC(config.GRPCAddr); err != nil {
+			return nil, fmt.Errorf("grpc: %v", err)
+		}
+	}
 	app.SetupRoutes()
 	return app, nil
 }
@@ -46,12 +135,47 @@ func (app *Application) LoadBlockchain(file string) error {
 		if err != nil {
 			return err
 		}
+		// consensus is selected when the chain is created and can't change afterwards
+		consensus := bchain.ConsensusType
+		if consensus == "" {
+			consensus = blockchain.ConsensusPoW
+		}
+		if consensus != app.Engine.Name() {
+			return fmt.Errorf("chain in %s was created with %s consensus", file, consensus)
+		}
+		// and must belong to the configured network
+		genesisBlock, err := app.Config.Genesis.Block()
+		if err != nil {
+			return err
+		}
+		if bchain.GenesisHash() != genesisBlock.Hash {
+			return fmt.Errorf("chain in %s has a different genesis block", file)
+		}
 	} else {
-		bchain, err = blockchain.NewBlockchain()
+		bchain, err = blockchain.NewBlockchainFromGenesis(app.Config.Genesis)
 		if err != nil {
 			return err
 		}
 	}
+	bchain.SetEngine(app.Engine)
+	bchain.Peers = app.Peers
+	bchain.Events = blockchain.NewEventHub()
+	//reorg protection: hard-coded and configured checkpoints, max depth
+	bchain.Checkpoints = map[int]string{0: bchain.GenesisHash()}
+	if app.Config.Genesis == nil {
+		for height, hash := range blockchain.DefaultCheckpoints {
+			bchain.Checkpoints[height] = hash
+		}
+	}
+	for height, hash := range app.Config.Checkpoints {
+		bchain.Checkpoints[height] = hash
+	}
+	switch {
+	case app.Config.MaxReorgDepth == 0:
+		bchain.MaxReorgDepth = blockchain.DefaultMaxReorgDepth
+	case app.Config.MaxReorgDepth > 0:
+		bchain.MaxReorgDepth = app.Config.MaxReorgDepth
+	}
 	app.Blockchain = bchain
 	return nil
 }
@@ -69,18 +193,86 @@ func (app *Application) SaveApplication() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := app.Peers.Save(); err != nil {
+		return err
+	}
+	return app.Webhooks.Save()
 }
 
 // set http routes and handlers
 func (app *Application) SetupRoutes() {
-	app.Router.Post("/new_transaction", app.HandleNewTransaction)
+	app.Router.Use(limitBody)
+	app.Router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Route not found")
+	})
+	app.Router.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+	})
+	app.Router.Get("/openapi.yaml", app.HandleGetOpenAPI)
+	app.Router.Post("/new_transaction", app.idempotent(app.HandleNewTransaction))
 	app.Router.Get("/chain", app.HandleGetChain)
-	app.Router.Get("/mine", app.HandleMine)
+	app.Router.Get("/blocks", app.HandleGetBlocks)
+	app.Router.Get("/blocks/{height}", app.HandleGetBlockByHeight)
+	app.Router.Get("/blocks/hash/{hash}", app.HandleGetBlockByHash)
+	app.Router.Get("/tip", app.HandleGetTip)
+	app.Router.Get("/sync", app.HandleGetSync)
+	app.Router.Get("/p2p", app.HandleGetP2PConns)
+	app.Router.Get("/events", app.HandleEvents)
+	app.Router.Post("/webhooks", app.idempotent(app.HandleRegisterWebhook))
+	app.Router.Get("/webhooks", app.HandleGetWebhooks)
+	app.Router.Get("/webhooks/{id}", app.HandleGetWebhook)
+	app.Router.Delete("/webhooks/{id}", app.HandleDeleteWebhook)
+	app.Router.Get("/webhooks/{id}/deliveries", app.HandleGetWebhookDeliveries)
+	app.Router.Post("/mine", app.idempotent(app.HandleMine))
 	app.Router.Get("/pending_tx", app.HandleGetPendingTransactions)
+	app.Router.Get("/tx/{id}", app.HandleGetTransaction)
+	app.Router.Get("/posts", app.HandleGetPosts)
+	app.Router.Get("/authors/{author}/posts", app.HandleGetAuthorPosts)
+	app.Router.Get("/search", app.HandleSearchPosts)
+	app.Router.Post("/rpc", app.idempotent(app.HandleRPC))
 	app.Router.Post("/add_block", app.HandleVerifyAndAddBlock)
+	app.Router.Post("/inv", app.HandleInventory)
+	app.Router.Get("/headers", app.HandleGetHeaders)
+	app.Router.Post("/getdata", app.HandleGetData)
 	app.Router.Post("/register_node", app.HandleRegisterNode)
-	app.Router.Post("/register_with", app.HandleRegisterNodeWith)
+	app.Router.Post("/register_with", app.idempotent(app.HandleRegisterNodeWith))
+	app.Router.Post("/handshake", app.HandleHandshake)
+	app.Router.Get("/peers", app.HandleGetPeers)
+	app.Router.Post("/peer_exchange", app.HandlePeerExchange)
+	app.Router.Get("/ledger", app.HandleGetLedger)
+	app.Router.Get("/finality", app.HandleGetFinality)
+	app.Router.Post("/finality/vote", app.HandleFinalityVote)
+	app.Router.Get("/reorgs", app.HandleGetRejectedReorgs)
+	app.Router.Get("/genesis", app.HandleGetGenesis)
+}
+
+// advertiseAddress returns the address peers should use to reach us, the configured
+// advertised address or else the host the request was sent to.
+func (app *Application) advertiseAddress(r *http.Request) string {
+	if app.Peers.AdvertiseAddr != "" {
+		return app.Peers.AdvertiseAddr
+	}
+	return "http://" + r.Host
+}
+
+// requestSender returns the known peer that sent the request, if it can be identified
+func (app *Application) requestSender(r *http.Request) (blockchain.NodePeer, bool) {
+	return app.Peers.PeerForRequest(r.RemoteAddr, r.Header.Get(blockchain.NodeIDHeader), r.Header.Get(blockchain.NodeAddressHeader))
+}
+
+// announceNewBlock announces our last block to the peers, over http and the p2p transport
+func (app *Application) announceNewBlock() {
+	app.Blockchain.AnnounceNewBlock()
+	if app.P2P != nil {
+		app.P2P.BroadcastBlock(app.Blockchain.GetLastBlock())
+	}
+}
+
+// onNewTip runs the finality gadget (if enabled) after the chain tip changed
+func (app *Application) onNewTip() {
+	if app.Finality != nil {
+		app.Finality.OnNewTip(app.Blockchain)
+	}
 }
 
 // Endpoint /register_with handler function - registers node to list via synced node and syncs the calling node
@@ -90,27 +282,26 @@ func (app *Application) HandleRegisterNodeWith(w http.ResponseWriter, r *http.Re
 	err := json.NewDecoder(r.Body).Decode(&node)
 	if err != nil {
 		log.Println("Error decoding node:", err)
-		http.Error(w, "Invalid node data", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid node data")
 		return
 	}
-	// handle empty node address
-	if node.NodeAddress == "" {
-		http.Error(w, "Invalid node data", http.StatusBadRequest)
+	// handle empty or invalid node address
+	remoteAddress, err := blockchain.ParsePeerAddress(node.NodeAddress)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid node data: "+err.Error())
 		return
 	}
-	// Prepare the request payload
-	data := map[string]string{
-		"node_address": r.Host,
-	}
-	payload, err := json.Marshal(data)
+	node.NodeAddress = remoteAddress.String()
+	// Prepare the request payload, our handshake
+	payload, err := json.Marshal(app.Blockchain.Handshake(app.advertiseAddress(r)))
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
 	// Make a request to register with the remote node
-	response, err := http.Post(node.NodeAddress+"/register_node", "application/json", bytes.NewBuffer(payload))
+	response, err := http.Post(remoteAddress.URL("/register_node"), "application/json", bytes.NewBuffer(payload))
 	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusBadGateway, ErrCodeNodeUnreachable, "Node unreachable: "+err.Error())
 		return
 	}
 	defer response.Body.Close()
@@ -118,65 +309,135 @@ func (app *Application) HandleRegisterNodeWith(w http.ResponseWriter, r *http.Re
 	if response != nil && response.StatusCode == http.StatusOK {
 
 		var responseData struct {
-			Chain []map[string]interface{} `json:"chain"`
-			Peers []string                 `json:"peers"`
+			Handshake blockchain.Handshake     `json:"handshake"`
+			Chain     []map[string]interface{} `json:"chain"`
+			Peers     []blockchain.NodePeer    `json:"peers"`
 		}
 		// decode body (chain as dump)
 		err := json.NewDecoder(response.Body).Decode(&responseData)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+		// check the remote node is compatible
+		if err := app.Blockchain.CheckHandshake(responseData.Handshake); err != nil {
+			log.Printf("Rejected node %s: %v", node.NodeAddress, err)
+			writeError(w, http.StatusConflict, ErrCodeIncompatibleNode, "Incompatible node: "+err.Error())
 			return
 		}
 
 		//create chain from the received dump
-		app.Blockchain, err = blockchain.CreateChainFromDump(responseData.Chain, responseData.Peers)
+		syncedChain, err := blockchain.CreateChainFromDump(responseData.Chain, []string{}, app.Blockchain)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+		//never revert checkpoints, finalized or too many blocks
+		if err := app.Blockchain.ReplaceChainIfAllowed(syncedChain.Chain); err != nil {
+			app.Blockchain.RecordRejectedReorg(node.NodeAddress, syncedChain.Chain, err)
+			writeError(w, http.StatusConflict, ErrCodeReorgRejected, err.Error())
 			return
 		}
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("Registration successful"))
+		// the registered node is a peer too, with the peers it knows (except us)
+		remotePeer := blockchain.PeerFromHandshake(responseData.Handshake)
+		remotePeer.NodeAddress = node.NodeAddress
+		app.Peers.AddNodePeer(&remotePeer)
+		// and the peers it knows are connected by discovery (up to the target peer count)
+		addresses := []string{}
+		for _, peer := range responseData.Peers {
+			addresses = append(addresses, peer.NodeAddress)
+		}
+		app.Peers.AddAddresses(addresses)
+		go app.Blockchain.DiscoverPeers(app.Config.TargetPeers)
+		writeMessage(w, http.StatusOK, "Registration successful")
 	} else {
-		//pass along the response message
-		body, _ := ioutil.ReadAll(response.Body)
-		w.WriteHeader(response.StatusCode)
-		w.Write(body)
+		//pass along the remote node error
+		var remoteError ErrorResponse
+		if err := json.NewDecoder(response.Body).Decode(&remoteError); err != nil || remoteError.Error.Code == "" {
+			remoteError.Error = APIError{Code: ErrCodeRegistrationFailed, Message: "Registration failed: " + response.Status}
+		}
+		writeError(w, response.StatusCode, remoteError.Error.Code, remoteError.Error.Message)
 	}
 }
 
-// Endpoint /register_node handler - adds node peer to list
+// Endpoint /register_node handler - checks the node handshake and adds node peer to list
 func (app *Application) HandleRegisterNode(w http.ResponseWriter, r *http.Request) {
-	//decode peer node details
-	var node blockchain.NodePeer
-	err := json.NewDecoder(r.Body).Decode(&node)
+	//decode peer node handshake
+	var handshake blockchain.Handshake
+	err := json.NewDecoder(r.Body).Decode(&handshake)
 	if err != nil {
 		log.Println("Error decoding node:", err)
-		http.Error(w, "Invalid node data", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid node data")
 		return
 	}
 	//check and prevent empty node_address
-	if node.NodeAddress == "" {
-		http.Error(w, "Invalid node data", http.StatusBadRequest)
+	if handshake.NodeAddress == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid node data")
+		return
+	}
+	//reject incompatible nodes (protocol version, other networks)
+	if err := app.Blockchain.CheckHandshake(handshake); err != nil {
+		log.Printf("Rejected node %s: %v", handshake.NodeAddress, err)
+		writeError(w, http.StatusConflict, ErrCodeIncompatibleNode, "Incompatible node: "+err.Error())
 		return
 	}
 
-	//add peer to list
-	app.Blockchain.AddNodePeer(&node)
+	//add peer to list (or update it if known)
+	node := blockchain.PeerFromHandshake(handshake)
+	if err := app.Peers.AddNodePeer(&node); err != nil {
+		log.Printf("Rejected node %s: %v", handshake.NodeAddress, err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid node data: "+err.Error())
+		return
+	}
 	data := map[string]interface{}{
-		"chain": app.Blockchain.Chain,
-		"peers": app.Blockchain.Peers,
+		"handshake": app.Blockchain.Handshake(app.advertiseAddress(r)),
+		"chain":     app.Blockchain.GetChain(),
+		"peers":     app.Peers.PeerList(),
 	}
 	//marshal blockchain to send back as response data
 	bytesBlockchain, err := json.Marshal(data)
 	if err != nil {
-		log.Println("Error decoding chain:", err)
-		http.Error(w, "Invalid chain data", http.StatusBadRequest)
+		log.Println("Error encoding chain:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	w.Write(bytesBlockchain)
 }
 
+// Endpoint /handshake handler - exchanges handshakes, adding the node as a peer (without sending it our chain)
+func (app *Application) HandleHandshake(w http.ResponseWriter, r *http.Request) {
+	var handshake blockchain.Handshake
+	err := json.NewDecoder(r.Body).Decode(&handshake)
+	if err != nil {
+		log.Println("Error decoding handshake:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid handshake data")
+		return
+	}
+	if err := app.Blockchain.CheckHandshake(handshake); err != nil {
+		writeError(w, http.StatusConflict, ErrCodeIncompatibleNode, "Incompatible node: "+err.Error())
+		return
+	}
+	// peering works both ways: the node connecting to us is our peer too (e.g. for its /inv)
+	if handshake.NodeAddress != "" {
+		node := blockchain.PeerFromHandshake(handshake)
+		if err := app.Peers.AddNodePeer(&node); err != nil {
+			log.Printf("Not adding node %s: %v", handshake.NodeAddress, err)
+		}
+	}
+	responseJSON, err := json.Marshal(app.Blockchain.Handshake(app.advertiseAddress(r)))
+	if err != nil {
+		log.Println("Error marshaling handshake:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
 // Endpoint /add_block handler - verifies and add new block
 func (app *Application) HandleVerifyAndAddBlock(w http.ResponseWriter, r *http.Request) {
 	//decode block detail
@@ -184,17 +445,113 @@ func (app *Application) HandleVerifyAndAddBlock(w http.ResponseWriter, r *http.R
 	err := json.NewDecoder(r.Body).Decode(&block)
 	if err != nil {
 		log.Println("Error decoding block:", err)
-		http.Error(w, "Invalid block data", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid block data")
+		return
+	}
+	// reject blocks from banned peers
+	sender, known := app.requestSender(r)
+	if known && app.Peers.IsBanned(sender.NodeAddress) {
+		writeError(w, http.StatusForbidden, ErrCodeBanned, "Node banned")
+		return
+	}
+	// add block to chain (verify block), blocks with unknown parent wait in the orphan pool
+	var peer *blockchain.NodePeer
+	if known {
+		peer = &sender
+	}
+	err = app.Blockchain.AcceptBlock(block, peer)
+	if errors.Is(err, blockchain.ErrOrphanBlock) {
+		writeMessage(w, http.StatusAccepted, "Orphan block")
 		return
 	}
-	// add block to chain (verify block)
-	err = app.Blockchain.AddBlock(block)
 	if err != nil {
-		http.Error(w, "Invalid block data", http.StatusBadRequest)
+		// blocks not extending our tip may be valid, others are invalid
+		if known && !errors.Is(err, blockchain.ErrPreviousHash) {
+			app.Peers.Misbehaving(sender.NodeAddress, blockchain.BlockScore(err), err.Error())
+		}
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidBlock, "Invalid block data: "+err.Error())
 		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Success"))
+	app.onNewTip()
+	writeMessage(w, http.StatusCreated, "Block added")
+}
+
+//Endpoint /inv handler - syncs with the announcing peer when the announced block is unknown
+func (app *Application) HandleInventory(w http.ResponseWriter, r *http.Request) {
+	var inv blockchain.Inventory
+	err := json.NewDecoder(r.Body).Decode(&inv)
+	if err != nil {
+		log.Println("Error decoding inventory:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid inventory data")
+		return
+	}
+	if app.Blockchain.HasBlock(inv.Hash) {
+		writeMessage(w, http.StatusOK, "Known block")
+		return
+	}
+	// blocks are only fetched from known peers
+	sender, known := app.requestSender(r)
+	if !known {
+		writeError(w, http.StatusForbidden, ErrCodeUnknownNode, "Unknown node")
+		return
+	}
+	if app.Peers.IsBanned(sender.NodeAddress) {
+		writeError(w, http.StatusForbidden, ErrCodeBanned, "Node banned")
+		return
+	}
+	go app.syncWithPeer(sender)
+	writeMessage(w, http.StatusAccepted, "Fetching block")
+}
+
+// syncWithPeer downloads the blocks we are missing from peer, and relays the new tip to our peers
+func (app *Application) syncWithPeer(peer blockchain.NodePeer) {
+	changed, err := app.Blockchain.SyncWithPeer(peer)
+	if err != nil {
+		log.Printf("Failed to sync with node %s: %v", peer.NodeAddress, err)
+	}
+	if changed {
+		app.onNewTip()
+		app.announceNewBlock()
+	}
+}
+
+//Endpoint /headers handler - gets the block headers from height `from` (header-first sync)
+func (app *Application) HandleGetHeaders(w http.ResponseWriter, r *http.Request) {
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid from height")
+		return
+	}
+	responseJSON, err := json.Marshal(app.Blockchain.Headers(from))
+	if err != nil {
+		log.Println("Error marshaling headers:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /getdata handler - gets the blocks with the requested hashes
+func (app *Application) HandleGetData(w http.ResponseWriter, r *http.Request) {
+	var request blockchain.GetData
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || len(request.Hashes) > blockchain.MaxGetData {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid getdata request")
+		return
+	}
+	responseJSON, err := json.Marshal(app.Blockchain.BlocksByHash(request.Hashes))
+	if err != nil {
+		log.Println("Error marshaling blocks:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
 }
 
 //Endpoint /new_transaction handler - Add new/pending/unconfirmed transaction
@@ -204,30 +561,81 @@ func (app *Application) HandleNewTransaction(w http.ResponseWriter, r *http.Requ
 	err := json.NewDecoder(r.Body).Decode(&transaction)
 	if err != nil {
 		log.Println("Error decoding transaction:", err)
-		http.Error(w, "Invalid transaction data", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid transaction data")
 		return
 	}
-	//validate transaction details
-	if transaction.Author == "" || transaction.Content == "" {
-		http.Error(w, "Invalid transaction data", http.StatusBadRequest)
+	status, err := app.newTransaction(transaction)
+	if err != nil {
+		log.Println("Invalid transaction:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTransaction, "Invalid transaction data: "+err.Error())
+		return
+	}
+	//respond with the transaction id, to look it up on /tx/{id}
+	responseJSON, err := json.Marshal(status)
+	if err != nil {
+		log.Println("Error marshaling transaction status:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
-	//add timestamp field to the new tx
-	transaction.Timestamp = time.Now().Unix()
-	//add new tx to pending tx (unconfirmed transactions)
-	app.Blockchain.AddNewTransaction(&transaction)
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte("Success"))
+	w.Write(responseJSON)
+}
+
+//Endpoint /tx/{id} handler - gets the status of a transaction: pending or confirmed with
+//its block and confirmations
+func (app *Application) HandleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	status, ok := app.Blockchain.TransactionStatus(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Transaction not found")
+		return
+	}
+	responseJSON, err := json.Marshal(status)
+	if err != nil {
+		log.Println("Error marshaling transaction status:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+// newTransaction validates the transaction and adds it to the pending transactions
+func (app *Application) newTransaction(transaction blockchain.Transaction) (blockchain.TxStatus, error) {
+	//add timestamp field to the new tx, signed (stake) txs carry their own
+	if transaction.Type == blockchain.TxTypePost {
+		transaction.Timestamp = time.Now().Unix()
+	}
+	//validate transaction details
+	if err := transaction.Validate(); err != nil {
+		return blockchain.TxStatus{}, err
+	}
+	//check stake txs against the ledger at our tip
+	if err := app.Blockchain.CheckTransaction(transaction); err != nil {
+		return blockchain.TxStatus{}, err
+	}
+	//add new tx to pending tx (unconfirmed transactions)
+	app.Blockchain.AddNewTransaction(&transaction)
+	if app.P2P != nil {
+		app.P2P.BroadcastTransaction(transaction)
+	}
+	return blockchain.TxStatus{
+		ID:          transaction.ID(),
+		Status:      blockchain.TxStatusPending,
+		Transaction: transaction,
+	}, nil
 }
 
 //Endoing /pending_txs handler - gets pending / unconfirmed transactions
 func (app *Application) HandleGetPendingTransactions(w http.ResponseWriter, r *http.Request) {
 	//marshal pending transactions and forward as respond data
-	responseJSON, err := json.Marshal(app.Blockchain.UnconfirmedTransactions)
+	responseJSON, err := json.Marshal(app.Blockchain.PendingTransactions())
 	if err != nil {
 		log.Println("Error marshaling pending transaction data:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
 
@@ -239,6 +647,7 @@ func (app *Application) HandleGetPendingTransactions(w http.ResponseWriter, r *h
 //Endpoint /chain handler - gets blockchain
 func (app *Application) HandleGetChain(w http.ResponseWriter, r *http.Request) {
 	//package chian data
+	chain := app.Blockchain.GetChain()
 	chainData := struct {
 		Length     int                `json:"length"`
 		Chain      []blockchain.Block `json:"chain"`
@@ -246,9 +655,9 @@ func (app *Application) HandleGetChain(w http.ResponseWriter, r *http.Request) {
 		Difficulty int                `json:"difficulty"`
 		Peers      []string           `json:"peers"`
 	}{
-		Length:     len(app.Blockchain.Chain),
-		Chain:      app.Blockchain.Chain,
-		IsValid:    app.Blockchain.CheckChainValidity(),
+		Length:     len(chain),
+		Chain:      chain,
+		IsValid:    app.Blockchain.IsValid(),
 		Difficulty: app.Blockchain.Difficulty,
 		Peers:      []string{}, // Replace with your peers data
 	}
@@ -256,7 +665,129 @@ func (app *Application) HandleGetChain(w http.ResponseWriter, r *http.Request) {
 	responseJSON, err := json.Marshal(chainData)
 	if err != nil {
 		log.Println("Error marshaling chain data:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /blocks handler - gets a range of blocks, `limit` blocks (default 20, at most 100) from height `from`
+func (app *Application) HandleGetBlocks(w http.ResponseWriter, r *http.Request) {
+	var from, limit int
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = strconv.Atoi(value)
+		if err != nil || from < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid from height")
+			return
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+	blocksData := struct {
+		From   int                `json:"from"`
+		Total  int                `json:"total"`
+		Blocks []blockchain.Block `json:"blocks"`
+	}{
+		From:   from,
+		Total:  len(app.Blockchain.GetChain()),
+		Blocks: app.Blockchain.Blocks(from, limit),
+	}
+	responseJSON, err := json.Marshal(blocksData)
+	if err != nil {
+		log.Println("Error marshaling blocks:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /posts handler - gets a page of the posts by timestamp, between `since`
+//and `until` (unix timestamps, included)
+func (app *Application) HandleGetPosts(w http.ResponseWriter, r *http.Request) {
+	var since, until int64
+	var err error
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || since < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid since")
+			return
+		}
+	}
+	if value := r.URL.Query().Get("until"); value != "" {
+		until, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || until < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid until")
+			return
+		}
+	}
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	app.writePosts(w, app.Blockchain.PostsByTime(since, until, offset, limit))
+}
+
+//Endpoint /authors/{author}/posts handler - gets a page of the posts of the author, in chain order
+func (app *Application) HandleGetAuthorPosts(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	app.writePosts(w, app.Blockchain.PostsByAuthor(chi.URLParam(r, "author"), offset, limit))
+}
+
+//Endpoint /search handler - gets a page of the posts holding every word of `q`, in chain order
+func (app *Application) HandleSearchPosts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if len(blockchain.Words(query)) == 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid search query")
+		return
+	}
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	app.writePosts(w, app.Blockchain.SearchPosts(query, offset, limit))
+}
+
+// pageParams parses the `offset` and `limit` query parameters, 0 when not set
+func pageParams(r *http.Request) (offset int, limit int, err error) {
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("Invalid offset")
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return 0, 0, errors.New("Invalid limit")
+		}
+	}
+	return offset, limit, nil
+}
+
+// writePosts sends the page of posts as json response
+func (app *Application) writePosts(w http.ResponseWriter, page blockchain.PostPage) {
+	responseJSON, err := json.Marshal(page)
+	if err != nil {
+		log.Println("Error marshaling posts:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
 
@@ -265,31 +796,188 @@ func (app *Application) HandleGetChain(w http.ResponseWriter, r *http.Request) {
 	w.Write(responseJSON)
 }
 
+//Endpoint /blocks/{height} handler - gets the block at height
+func (app *Application) HandleGetBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.Atoi(chi.URLParam(r, "height"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid height")
+		return
+	}
+	block, ok := app.Blockchain.BlockByHeight(height)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Block not found")
+		return
+	}
+	app.writeBlock(w, block)
+}
+
+//Endpoint /blocks/hash/{hash} handler - gets the block with the hash
+func (app *Application) HandleGetBlockByHash(w http.ResponseWriter, r *http.Request) {
+	block, ok := app.Blockchain.BlockByHash(chi.URLParam(r, "hash"))
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Block not found")
+		return
+	}
+	app.writeBlock(w, block)
+}
+
+// writeBlock sends the block as json response
+func (app *Application) writeBlock(w http.ResponseWriter, block blockchain.Block) {
+	responseJSON, err := json.Marshal(block)
+	if err != nil {
+		log.Println("Error marshaling block:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /tip handler - gets the height and hash of the last block, the finalized block and chain validity
+func (app *Application) HandleGetTip(w http.ResponseWriter, r *http.Request) {
+	responseJSON, err := json.Marshal(app.Blockchain.Tip())
+	if err != nil {
+		log.Println("Error marshaling tip:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /sync handler - gets the background sync status (syncing or synced, target height)
+func (app *Application) HandleGetSync(w http.ResponseWriter, r *http.Request) {
+	responseJSON, err := json.Marshal(app.Sync.Status())
+	if err != nil {
+		log.Println("Error marshaling sync status:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /p2p handler - gets the connections of the p2p transport
+func (app *Application) HandleGetP2PConns(w http.ResponseWriter, r *http.Request) {
+	if app.P2P == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotEnabled, "P2P transport disabled")
+		return
+	}
+	responseJSON, err := json.Marshal(app.P2P.Conns())
+	if err != nil {
+		log.Println("Error marshaling p2p connections:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /events handler - streams chain events (block, tx, reorg) as server-sent events,
+//`types` filters the event types (comma separated)
+func (app *Application) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Streaming unsupported")
+		return
+	}
+	types := map[string]bool{}
+	for _, eventType := range strings.Split(r.URL.Query().Get("types"), ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			types[eventType] = true
+		}
+	}
+	// the stream outlives the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	events, unsubscribe := app.Blockchain.Events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			if len(types) > 0 && !types[event.Type] {
+				continue
+			}
+			eventJSON, err := json.Marshal(event)
+			if err != nil {
+				log.Println("Error marshaling event:", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, eventJSON)
+			flusher.Flush()
+		}
+	}
+}
+
 //Endpoing /mine handler - mines block (pending transactions into a block, then add to chain)
 func (app *Application) HandleMine(w http.ResponseWriter, r *http.Request) {
 	// mine block
-	success, err := app.Blockchain.MineBlock()
+	mineData, err := app.mine()
+	if errors.Is(err, blockchain.ErrNotInTurn) {
+		writeError(w, http.StatusConflict, ErrCodeNotInTurn, "Not in turn to seal block")
+		return
+	}
 	if err != nil {
 		log.Println("Error mining block:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
-	//define response default details
-	mineData := struct {
-		Message      string                   `json:"message"`
-		ChainLength  int                      `json:"chain_length"`
-		Transactions []blockchain.Transaction `json:"transactions"`
-	}{
-		ChainLength: len(app.Blockchain.Chain),
+	//marshall response data and forward
+	responseJSON, err := json.Marshal(mineData)
+	if err != nil {
+		log.Println("Error marshaling chain data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+// MineResult is the outcome of a mining request.
+type MineResult struct {
+	Message      string                   `json:"message"`
+	ChainLength  int                      `json:"chain_length"`
+	Transactions []blockchain.Transaction `json:"transactions"`
+}
+
+// mine mines the pending transactions, then syncs with the peers and announces the new block
+func (app *Application) mine() (MineResult, error) {
+	success, err := app.Blockchain.MineBlock()
+	if err != nil {
+		return MineResult{}, err
+	}
+	//define response default details
+	mineData := MineResult{ChainLength: len(app.Blockchain.GetChain())}
 	// if mine is successful add length of txs in block and do consensus and broadcast
 	if success {
-		chainLength := len(app.Blockchain.Chain) //get chain length before consensus
-		app.Blockchain.Consensus()               //persis chain with max length
+		chainLength := len(app.Blockchain.GetChain()) //get chain length before consensus
+		app.Blockchain.Consensus()                    //persis chain with max length
 
-		if chainLength > len(app.Blockchain.Chain) {
-			app.Blockchain.AnnounceNewBlock() // broadcast new block
+		if chainLength == len(app.Blockchain.GetChain()) {
+			app.announceNewBlock() // broadcast new block
 		}
+		app.onNewTip()
 
 		// add message and txs in mined block to response data
 		mineData.Message = "New block mined"
@@ -297,11 +985,275 @@ func (app *Application) HandleMine(w http.ResponseWriter, r *http.Request) {
 	} else {
 		mineData.Message = "No transaction to mine"
 	}
-	//marshall response data and forward
-	responseJSON, err := json.Marshal(mineData)
+	return mineData, nil
+}
+
+//Endpoint /ledger handler - gets account balances and stakes (proof of stake only)
+func (app *Application) HandleGetLedger(w http.ResponseWriter, r *http.Request) {
+	engine, ok := app.Blockchain.ConsensusEngine().(*blockchain.ProofOfStakeEngine)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeNotEnabled, "Ledger not available for this consensus")
+		return
+	}
+	responseJSON, err := json.Marshal(engine.Ledger(app.Blockchain.GetChain()))
 	if err != nil {
-		log.Println("Error marshaling chain data:", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Println("Error marshaling ledger data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /finality handler - gets the finalized height and hash with its commit votes
+func (app *Application) HandleGetFinality(w http.ResponseWriter, r *http.Request) {
+	if app.Finality == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotEnabled, "Finality gadget not enabled")
+		return
+	}
+	responseJSON, err := json.Marshal(app.Finality.Status(app.Blockchain))
+	if err != nil {
+		log.Println("Error marshaling finality data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /finality/vote handler - receives prevotes and precommits from validators
+func (app *Application) HandleFinalityVote(w http.ResponseWriter, r *http.Request) {
+	if app.Finality == nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotEnabled, "Finality gadget not enabled")
+		return
+	}
+	var vote blockchain.Vote
+	err := json.NewDecoder(r.Body).Decode(&vote)
+	if err != nil {
+		log.Println("Error decoding vote:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid vote data")
+		return
+	}
+	_, err = app.Finality.AddVote(app.Blockchain, vote)
+	if err != nil {
+		log.Println("Invalid vote:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid vote data")
+		return
+	}
+	writeMessage(w, http.StatusOK, "Vote accepted")
+}
+
+//Endpoint /reorgs handler - gets reorg protection settings and the rejected deep reorgs
+func (app *Application) HandleGetRejectedReorgs(w http.ResponseWriter, r *http.Request) {
+	reorgData := struct {
+		MaxReorgDepth int                        `json:"max_reorg_depth"`
+		Checkpoints   map[int]string             `json:"checkpoints"`
+		Rejected      []blockchain.RejectedReorg `json:"rejected"`
+	}{
+		MaxReorgDepth: app.Blockchain.MaxReorgDepth,
+		Checkpoints:   app.Blockchain.Checkpoints,
+		Rejected:      app.Blockchain.RejectedReorgList(),
+	}
+	responseJSON, err := json.Marshal(reorgData)
+	if err != nil {
+		log.Println("Error marshaling reorg data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /genesis handler - gets the network id, genesis block and config
+func (app *Application) HandleGetGenesis(w http.ResponseWriter, r *http.Request) {
+	genesisData := struct {
+		NetworkID string              `json:"network_id"`
+		Hash      string              `json:"hash"`
+		Block     blockchain.Block    `json:"block"`
+		Config    *blockchain.Genesis `json:"config"`
+	}{
+		NetworkID: app.Blockchain.NetworkID,
+		Hash:      app.Blockchain.GenesisHash(),
+		Block:     app.Blockchain.GetChain()[0],
+		Config:    app.Config.Genesis,
+	}
+	responseJSON, err := json.Marshal(genesisData)
+	if err != nil {
+		log.Println("Error marshaling genesis data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /peers handler - gets the known peers with their health state
+func (app *Application) HandleGetPeers(w http.ResponseWriter, r *http.Request) {
+	responseJSON, err := json.Marshal(app.Peers.PeerList())
+	if err != nil {
+		log.Println("Error marshaling peers data:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /peer_exchange handler - learns the addresses known by the calling node and returns ours
+func (app *Application) HandlePeerExchange(w http.ResponseWriter, r *http.Request) {
+	var exchange blockchain.PeerExchange
+	err := json.NewDecoder(r.Body).Decode(&exchange)
+	if err != nil {
+		log.Println("Error decoding peer exchange:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid peer exchange data")
+		return
+	}
+	sender, known := app.requestSender(r)
+	if known && app.Peers.IsBanned(sender.NodeAddress) {
+		writeError(w, http.StatusForbidden, ErrCodeBanned, "Node banned")
+		return
+	}
+	if exchange.NodeAddress != "" {
+		exchange.Addresses = append([]string{exchange.NodeAddress}, exchange.Addresses...)
+	}
+	app.Peers.AddAddresses(exchange.Addresses)
+
+	responseJSON, err := json.Marshal(blockchain.PeerExchange{
+		NodeAddress: app.Peers.AdvertiseAddr,
+		Addresses:   app.Peers.ExchangeAddresses(),
+	})
+	if err != nil {
+		log.Println("Error marshaling peer exchange:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+// RunSync keeps the chain up to date in the background, syncing with the peers every interval.
+func (app *Application) RunSync(interval time.Duration) {
+	app.Sync.Run(interval, app.onNewTip)
+}
+
+// MonitorPeers bootstraps from the configured nodes, then periodically exchanges handshakes
+// with the peers to track their health and best chain (unreachable peers are eventually removed)
+// and discovers new peers until the target peer count is reached.
+func (app *Application) MonitorPeers(interval time.Duration) {
+	app.Peers.AddAddresses(app.Config.Bootstrap)
+	app.Blockchain.DiscoverPeers(app.Config.TargetPeers)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		app.Blockchain.RefreshPeers()
+		if len(app.Peers.ActivePeers()) == 0 {
+			//retry the bootstrap nodes when isolated
+			app.Peers.AddAddresses(app.Config.Bootstrap)
+		}
+		app.Blockchain.DiscoverPeers(app.Config.TargetPeers)
+		if err := app.Peers.Save(); err != nil {
+			log.Println("Error saving peers:", err)
+		}
+	}
+}
+
+//Endpoint /webhooks handler (POST) - registers a webhook, the response holds its secret
+func (app *Application) HandleRegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook webhook.Webhook
+	err := json.NewDecoder(r.Body).Decode(&hook)
+	if err != nil {
+		log.Println("Error decoding webhook:", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid webhook data")
+		return
+	}
+	hook, err = app.Webhooks.Register(hook)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid webhook data: "+err.Error())
+		return
+	}
+	responseJSON, err := json.Marshal(hook)
+	if err != nil {
+		log.Println("Error marshaling webhook:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(responseJSON)
+}
+
+//Endpoint /webhooks handler - lists the webhooks (without secrets)
+func (app *Application) HandleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	responseJSON, err := json.Marshal(app.Webhooks.Webhooks())
+	if err != nil {
+		log.Println("Error marshaling webhooks:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /webhooks/{id} handler - gets a webhook (without secret)
+func (app *Application) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := app.Webhooks.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
+	responseJSON, err := json.Marshal(hook)
+	if err != nil {
+		log.Println("Error marshaling webhook:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+//Endpoint /webhooks/{id} handler (DELETE) - removes a webhook
+func (app *Application) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := app.Webhooks.Remove(chi.URLParam(r, "id"))
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		log.Println("Error saving webhooks:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Endpoint /webhooks/{id}/deliveries handler - gets the delivery log of a webhook, newest first
+func (app *Application) HandleGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := app.Webhooks.Get(id); err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, "Webhook not found")
+		return
+	}
+	responseJSON, err := json.Marshal(app.Webhooks.Deliveries(id))
+	if err != nil {
+		log.Println("Error marshaling deliveries:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 		return
 	}
 
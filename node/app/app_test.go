@@ -0,0 +1,470 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// newTestApp creates an application working in a temporary directory (for its files),
+// with a proof of work difficulty of 1.
+func newTestApp(t *testing.T, config Config) *Application {
+	t.Helper()
+	inTempDir(t)
+	app, err := NewApplication(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Blockchain.Difficulty = 1
+	return app
+}
+
+// inTempDir runs the test in a temporary working directory.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+}
+
+// serve sends a request to the application router and returns the response.
+func serve(app *Application, method string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdvertiseAddress(t *testing.T) {
+	tests := []struct {
+		name          string
+		advertiseAddr string
+		host          string
+		want          string
+		wantErr       bool
+	}{
+		{name: "request host", host: "10.0.0.1:8000", want: "http://10.0.0.1:8000"},
+		{name: "configured", advertiseAddr: "node.example:9000", host: "10.0.0.1:8000", want: "http://node.example:9000"},
+		{name: "configured https", advertiseAddr: "https://Node.Example", host: "10.0.0.1:8000", want: "https://node.example:443"},
+		{name: "invalid", advertiseAddr: "ftp://node.example", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				inTempDir(t)
+				if _, err := NewApplication(Config{AdvertiseAddr: tt.advertiseAddr}); err == nil {
+					t.Fatal("NewApplication() with invalid advertise address succeeded")
+				}
+				return
+			}
+			app := newTestApp(t, Config{AdvertiseAddr: tt.advertiseAddr})
+			// the handshake of another node process
+			handshake := app.Blockchain.Handshake("http://10.0.0.2:8000")
+			handshake.NodeID = "other"
+			payload, _ := json.Marshal(handshake)
+			r := httptest.NewRequest(http.MethodPost, "/handshake", bytes.NewBuffer(payload))
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			app.Router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var response blockchain.Handshake
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.NodeAddress != tt.want {
+				t.Errorf("advertised %q, want %q", response.NodeAddress, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandshakeAddsPeer(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     func(handshake *blockchain.Handshake)
+		wantStatus int
+		wantInv    int // status of an announcement from the node afterwards
+	}{
+		{name: "with address", update: func(handshake *blockchain.Handshake) {}, wantStatus: http.StatusOK, wantInv: http.StatusAccepted},
+		{name: "without address", update: func(handshake *blockchain.Handshake) { handshake.NodeAddress = "" }, wantStatus: http.StatusOK, wantInv: http.StatusForbidden},
+		{name: "other network", update: func(handshake *blockchain.Handshake) { handshake.NetworkID = "other" }, wantStatus: http.StatusConflict, wantInv: http.StatusForbidden},
+		{name: "ourselves", update: func(handshake *blockchain.Handshake) { handshake.NodeID = "" }, wantStatus: http.StatusConflict, wantInv: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, Config{})
+			// a node on a closed local port, syncing with it fails at once
+			handshake := app.Blockchain.Handshake("http://127.0.0.1:1")
+			handshake.NodeID = "other"
+			tt.update(&handshake)
+			if handshake.NodeID == "" {
+				handshake.NodeID = app.Peers.NodeID
+			}
+			payload, _ := json.Marshal(handshake)
+			header := http.Header{blockchain.NodeIDHeader: {handshake.NodeID}}
+			if w := serveFrom(app, "127.0.0.1:40000", "/handshake", string(payload), header); w.Code != tt.wantStatus {
+				t.Fatalf("handshake status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			w := serveFrom(app, "127.0.0.1:40000", "/inv", `{"height":5,"hash":"unknown"}`, header)
+			if w.Code != tt.wantInv {
+				t.Errorf("inv status %d, want %d: %s", w.Code, tt.wantInv, w.Body)
+			}
+		})
+	}
+}
+
+// serveFrom posts body to target as sent from remoteAddr.
+func serveFrom(app *Application, remoteAddr string, target string, body string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	app.Router.ServeHTTP(w, r)
+	return w
+}
+
+func TestAddBlockScoresSender(t *testing.T) {
+	tests := []struct {
+		name       string
+		block      func(t *testing.T, app *Application) blockchain.Block
+		wantStatus int
+		wantScore  int
+		wantBanned bool
+	}{
+		{name: "valid", block: func(t *testing.T, app *Application) blockchain.Block {
+			return sealedBlock(t, app, app.Blockchain.GetLastBlock(), "hello")
+		}, wantStatus: http.StatusCreated},
+		{name: "stale", block: func(t *testing.T, app *Application) blockchain.Block {
+			return sealedBlock(t, app, app.Blockchain.Chain[0], "late")
+		}, wantStatus: http.StatusBadRequest},
+		{name: "wrong index", block: func(t *testing.T, app *Application) blockchain.Block {
+			block := sealedBlock(t, app, app.Blockchain.GetLastBlock(), "hello")
+			block.Index, block.Hash = block.Index+1, ""
+			if err := app.Blockchain.ProofOfWork(&block); err != nil {
+				t.Fatal(err)
+			}
+			return block
+		}, wantStatus: http.StatusBadRequest, wantScore: blockchain.InvalidBlockScore},
+		{name: "forged proof of work", block: func(t *testing.T, app *Application) blockchain.Block {
+			block := sealedBlock(t, app, app.Blockchain.GetLastBlock(), "hello")
+			block.Transactions[0].Content = "forged"
+			return block
+		}, wantStatus: http.StatusBadRequest, wantBanned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, Config{})
+			app.Blockchain.AddNewTransaction(&blockchain.Transaction{Author: "alice", Content: "first", Timestamp: 1})
+			if _, err := app.mine(); err != nil {
+				t.Fatal(err)
+			}
+			peer := blockchain.NodePeer{NodeAddress: "http://127.0.0.1:1", NodeID: "peer"}
+			if err := app.Peers.AddNodePeer(&peer); err != nil {
+				t.Fatal(err)
+			}
+			payload, _ := json.Marshal(tt.block(t, app))
+			header := http.Header{blockchain.NodeIDHeader: {"peer"}}
+			if w := serveFrom(app, "127.0.0.1:40000", "/add_block", string(payload), header); w.Code != tt.wantStatus {
+				t.Fatalf("add block status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if score := app.Peers.PeerList()[0].Score; score != tt.wantScore {
+				t.Errorf("sender score %d, want %d", score, tt.wantScore)
+			}
+			if banned := app.Peers.IsBanned(peer.NodeAddress); banned != tt.wantBanned {
+				t.Errorf("sender banned %v, want %v", banned, tt.wantBanned)
+			}
+		})
+	}
+}
+
+// sealedBlock returns a block with one post on top of parent, sealed with proof of work.
+func sealedBlock(t *testing.T, app *Application, parent blockchain.Block, content string) blockchain.Block {
+	t.Helper()
+	block := blockchain.Block{
+		Index:        parent.Index + 1,
+		Transactions: []blockchain.Transaction{{Author: "bob", Content: content, Timestamp: 1}},
+		Timestamp:    parent.Timestamp + 1,
+		PreviousHash: parent.Hash,
+	}
+	if err := app.Blockchain.ProofOfWork(&block); err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestGetBlocks(t *testing.T) {
+	tests := []struct {
+		target     string
+		wantStatus int
+	}{
+		{"/blocks", http.StatusOK},
+		{"/blocks?from=0&limit=5", http.StatusOK},
+		{"/blocks?from=-1", http.StatusBadRequest},
+		{"/blocks?limit=x", http.StatusBadRequest},
+		{"/blocks/0", http.StatusOK},
+		{"/blocks/1", http.StatusNotFound},
+		{"/blocks/x", http.StatusBadRequest},
+		{"/blocks/hash/unknown", http.StatusNotFound},
+		{"/tip", http.StatusOK},
+	}
+	app := newTestApp(t, Config{})
+	for _, tt := range tests {
+		if w := serve(app, http.MethodGet, tt.target, "", nil); w.Code != tt.wantStatus {
+			t.Errorf("GET %s status %d, want %d: %s", tt.target, w.Code, tt.wantStatus, w.Body)
+		}
+	}
+}
+
+// TestConcurrentRequests serves the chain while blocks are mined in the background, run with -race.
+func TestConcurrentRequests(t *testing.T) {
+	app := newTestApp(t, Config{})
+	requests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/chain", ""},
+		{http.MethodGet, "/blocks", ""},
+		{http.MethodGet, "/tip", ""},
+		{http.MethodGet, "/pending_tx", ""},
+		{http.MethodGet, "/posts", ""},
+		{http.MethodGet, "/reorgs", ""},
+		{http.MethodGet, "/genesis", ""},
+		{http.MethodPost, "/rpc", `{"jsonrpc":"2.0","method":"mempool_list","id":1}`},
+	}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			app.Blockchain.AddNewTransaction(&blockchain.Transaction{Author: "alice", Content: "post", Timestamp: int64(i)})
+			if _, err := app.mine(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for mining := true; mining; {
+		select {
+		case <-done:
+			mining = false
+		default:
+		}
+		for _, request := range requests {
+			if w := serve(app, request.method, request.target, request.body, nil); w.Code != http.StatusOK {
+				t.Fatalf("%s %s status %d: %s", request.method, request.target, w.Code, w.Body)
+			}
+		}
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		types     string
+		wantTypes []string
+	}{
+		{name: "all events", wantTypes: []string{blockchain.EventTx, blockchain.EventBlock}},
+		{name: "blocks", types: "block,reorg", wantTypes: []string{blockchain.EventBlock}},
+		{name: "transactions", types: " tx ", wantTypes: []string{blockchain.EventTx}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, Config{})
+			server := httptest.NewServer(app.Router)
+			defer server.Close()
+			response, err := http.Get(server.URL + "/events?types=" + url.QueryEscape(tt.types))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer response.Body.Close()
+			if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("status %d, content type %s", response.StatusCode, response.Header.Get("Content-Type"))
+			}
+
+			// the response headers are sent once subscribed
+			app.Blockchain.AddNewTransaction(&blockchain.Transaction{Author: "alice", Content: "hello", Timestamp: 1})
+			if _, err := app.Blockchain.MineBlock(); err != nil {
+				t.Fatal(err)
+			}
+			scanner := bufio.NewScanner(response.Body)
+			for _, want := range tt.wantTypes {
+				var eventType string
+				var event blockchain.Event
+				for scanner.Scan() && scanner.Text() != "" {
+					if value := strings.TrimPrefix(scanner.Text(), "event: "); value != scanner.Text() {
+						eventType = value
+					}
+					if value := strings.TrimPrefix(scanner.Text(), "data: "); value != scanner.Text() {
+						if err := json.Unmarshal([]byte(value), &event); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				if eventType != want || event.Type != want {
+					t.Fatalf("event %q with data type %q, want %q", eventType, event.Type, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionLookup(t *testing.T) {
+	app := newTestApp(t, Config{})
+	w := serve(app, http.MethodPost, "/new_transaction", `{"author":"alice","content":"hello"}`, nil)
+	var submitted blockchain.TxStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil || w.Code != http.StatusCreated || submitted.ID == "" {
+		t.Fatalf("new transaction status %d: %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		name              string
+		mine              bool
+		id                string
+		wantCode          int
+		wantStatus        string
+		wantConfirmations int
+	}{
+		{name: "pending", id: submitted.ID, wantCode: http.StatusOK, wantStatus: blockchain.TxStatusPending},
+		{name: "confirmed", mine: true, id: submitted.ID, wantCode: http.StatusOK, wantStatus: blockchain.TxStatusConfirmed, wantConfirmations: 1},
+		{name: "unknown", id: "unknown", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mine {
+				if w := serve(app, http.MethodPost, "/mine", "", nil); w.Code != http.StatusOK {
+					t.Fatalf("mine status %d: %s", w.Code, w.Body)
+				}
+			}
+			w := serve(app, http.MethodGet, "/tx/"+tt.id, "", nil)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var status blockchain.TxStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if status.ID != tt.id || status.Status != tt.wantStatus || status.Confirmations != tt.wantConfirmations || status.Transaction.Content != "hello" {
+				t.Errorf("transaction %+v, want %s with %d confirmations", status, tt.wantStatus, tt.wantConfirmations)
+			}
+		})
+	}
+}
+
+func TestGetPosts(t *testing.T) {
+	app := newTestApp(t, Config{})
+	for _, body := range []string{
+		`{"author":"alice","content":"first"}`,
+		`{"author":"bob","content":"second"}`,
+		`{"author":"alice","content":"third"}`,
+	} {
+		if w := serve(app, http.MethodPost, "/new_transaction", body, nil); w.Code != http.StatusCreated {
+			t.Fatalf("new transaction status %d: %s", w.Code, w.Body)
+		}
+	}
+	if w := serve(app, http.MethodPost, "/mine", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("mine status %d: %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantPosts  []string
+		wantTotal  int
+	}{
+		{"/posts", http.StatusOK, []string{"first", "second", "third"}, 3},
+		{"/posts?since=1&until=4102444800", http.StatusOK, []string{"first", "second", "third"}, 3},
+		{"/posts?since=4102444800", http.StatusOK, []string{}, 0},
+		{"/posts?until=1", http.StatusOK, []string{}, 0},
+		{"/posts?offset=1&limit=1", http.StatusOK, []string{"second"}, 3},
+		{"/posts?since=x", http.StatusBadRequest, nil, 0},
+		{"/posts?until=-1", http.StatusBadRequest, nil, 0},
+		{"/posts?offset=-1", http.StatusBadRequest, nil, 0},
+		{"/authors/alice/posts", http.StatusOK, []string{"first", "third"}, 2},
+		{"/authors/alice/posts?offset=1", http.StatusOK, []string{"third"}, 2},
+		{"/authors/carol/posts", http.StatusOK, []string{}, 0},
+		{"/authors/alice/posts?limit=x", http.StatusBadRequest, nil, 0},
+	}
+	for _, tt := range tests {
+		w := serve(app, http.MethodGet, tt.target, "", nil)
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s status %d, want %d: %s", tt.target, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != ErrCodeInvalidRequest {
+				t.Errorf("GET %s error %s, want code %s", tt.target, w.Body, ErrCodeInvalidRequest)
+			}
+			continue
+		}
+		var page blockchain.PostPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		posts := []string{}
+		for _, post := range page.Posts {
+			posts = append(posts, post.Content)
+		}
+		if strings.Join(posts, ",") != strings.Join(tt.wantPosts, ",") || page.Total != tt.wantTotal {
+			t.Errorf("GET %s posts %v of %d, want %v of %d", tt.target, posts, page.Total, tt.wantPosts, tt.wantTotal)
+		}
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	app := newTestApp(t, Config{})
+	if w := serve(app, http.MethodPost, "/new_transaction", `{"author":"alice","content":"Hello chain"}`, nil); w.Code != http.StatusCreated {
+		t.Fatalf("new transaction status %d: %s", w.Code, w.Body)
+	}
+	if w := serve(app, http.MethodPost, "/mine", "", nil); w.Code != http.StatusOK {
+		t.Fatalf("mine status %d: %s", w.Code, w.Body)
+	}
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantTotal  int
+	}{
+		{"/search?q=hello", http.StatusOK, 1},
+		{"/search?q=CHAIN+hello", http.StatusOK, 1},
+		{"/search?q=hello+world", http.StatusOK, 0},
+		{"/search?q=hello&offset=1", http.StatusOK, 1},
+		{"/search", http.StatusBadRequest, 0},
+		{"/search?q=%21%3F", http.StatusBadRequest, 0},
+		{"/search?q=hello&limit=-1", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := serve(app, http.MethodGet, tt.target, "", nil)
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s status %d, want %d: %s", tt.target, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		var page blockchain.PostPage
+		if tt.wantStatus == http.StatusOK && (json.Unmarshal(w.Body.Bytes(), &page) != nil || page.Total != tt.wantTotal) {
+			t.Errorf("GET %s page %s, want %d posts in total", tt.target, w.Body, tt.wantTotal)
+		}
+	}
+}
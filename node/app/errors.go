@@ -0,0 +1,61 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of the JSON error responses, stable for clients to check.
+const (
+	ErrCodeInvalidRequest       = "invalid_request"     // malformed body or parameters
+	ErrCodeInvalidBlock         = "invalid_block"       // block rejected by validation
+	ErrCodeInvalidTransaction   = "invalid_transaction" // transaction rejected by validation
+	ErrCodeNotFound             = "not_found"           // unknown route, block, transaction, webhook...
+	ErrCodeMethodNotAllowed     = "method_not_allowed"
+	ErrCodeNotEnabled           = "not_enabled"            // feature disabled on this node
+	ErrCodeIncompatibleNode     = "incompatible_node"      // other protocol version or network
+	ErrCodeUnknownNode          = "unknown_node"           // request reserved to peers
+	ErrCodeBanned               = "banned"                 // request from a banned peer
+	ErrCodeReorgRejected        = "reorg_rejected"         // chain would revert protected blocks
+	ErrCodeNotInTurn            = "not_in_turn"            // not our turn to seal a block
+	ErrCodeNodeUnreachable      = "node_unreachable"       // a remote node didn't answer
+	ErrCodeRegistrationFailed   = "registration_failed"    // a remote node refused our registration
+	ErrCodeRequestTooLarge      = "request_too_large"      // body over MaxBodySize
+	ErrCodeIdempotencyKeyReused = "idempotency_key_reused" // key already used with another body
+	ErrCodeIdempotencyKeyInUse  = "idempotency_key_in_use" // request with the key in progress
+	ErrCodeIdempotencyStoreFull = "idempotency_store_full" // MaxIdempotencyKeys requests in progress
+	ErrCodeInternal             = "internal_error"
+)
+
+// ErrorResponse is the body of error responses.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes why a request failed.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// MessageResponse is the body of successful responses without data.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// writeError sends a JSON error response
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	responseJSON, _ := json.Marshal(ErrorResponse{Error: APIError{Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
+
+// writeMessage sends a JSON message response
+func writeMessage(w http.ResponseWriter, status int, message string) {
+	responseJSON, _ := json.Marshal(MessageResponse{Message: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
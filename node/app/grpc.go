@@ -0,0 +1,225 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+	"github.com/chokey2nv/ultainfinity/node/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer implements the node gRPC service with the application operations.
+type grpcServer struct {
+	grpcapi.UnimplementedNodeServer
+	app *Application
+}
+
+// ServeGRPC serves the node gRPC service on address (e.g. ":9090") in the background.
+func (app *Application) ServeGRPC(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	app.GRPC = grpc.NewServer()
+	grpcapi.RegisterNodeServer(app.GRPC, &grpcServer{app: app})
+	log.Println("Starting gRPC server on " + listener.Addr().String())
+	go func() {
+		if err := app.GRPC.Serve(listener); err != nil {
+			log.Println("gRPC server error:", err)
+		}
+	}()
+	return nil
+}
+
+func (s *grpcServer) GetTip(ctx context.Context, request *grpcapi.GetTipRequest) (*grpcapi.Tip, error) {
+	tip := s.app.Blockchain.Tip()
+	return &grpcapi.Tip{
+		Height:          int64(tip.Height),
+		Hash:            tip.Hash,
+		Timestamp:       tip.Timestamp,
+		FinalizedHeight: int64(tip.FinalizedHeight),
+		FinalizedHash:   tip.FinalizedHash,
+		IsValid:         tip.IsValid,
+		Orphans:         int64(tip.Orphans),
+	}, nil
+}
+
+func (s *grpcServer) GetBlock(ctx context.Context, request *grpcapi.GetBlockRequest) (*grpcapi.Block, error) {
+	var block blockchain.Block
+	var ok bool
+	switch key := request.Key.(type) {
+	case *grpcapi.GetBlockRequest_Height:
+		block, ok = s.app.Blockchain.BlockByHeight(int(key.Height))
+	case *grpcapi.GetBlockRequest_Hash:
+		block, ok = s.app.Blockchain.BlockByHash(key.Hash)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "height or hash required")
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "block not found")
+	}
+	return blockToProto(block), nil
+}
+
+func (s *grpcServer) GetBlocks(ctx context.Context, request *grpcapi.GetBlocksRequest) (*grpcapi.GetBlocksResponse, error) {
+	if request.From < 0 || request.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "negative from or limit")
+	}
+	response := &grpcapi.GetBlocksResponse{From: request.From, Total: int64(len(s.app.Blockchain.GetChain()))}
+	for _, block := range s.app.Blockchain.Blocks(int(request.From), int(request.Limit)) {
+		response.Blocks = append(response.Blocks, blockToProto(block))
+	}
+	return response, nil
+}
+
+func (s *grpcServer) SendTransaction(ctx context.Context, request *grpcapi.SendTransactionRequest) (*grpcapi.TxStatus, error) {
+	if request.Transaction == nil {
+		return nil, status.Error(codes.InvalidArgument, "transaction required")
+	}
+	txStatus, err := s.app.newTransaction(transactionFromProto(request.Transaction))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid transaction: "+err.Error())
+	}
+	return txStatusToProto(txStatus), nil
+}
+
+func (s *grpcServer) GetTransaction(ctx context.Context, request *grpcapi.GetTransactionRequest) (*grpcapi.TxStatus, error) {
+	txStatus, ok := s.app.Blockchain.TransactionStatus(request.Id)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "transaction not found")
+	}
+	return txStatusToProto(txStatus), nil
+}
+
+func (s *grpcServer) ListPendingTransactions(ctx context.Context, request *grpcapi.ListPendingTransactionsRequest) (*grpcapi.ListPendingTransactionsResponse, error) {
+	response := &grpcapi.ListPendingTransactionsResponse{}
+	for _, tx := range s.app.Blockchain.PendingTransactions() {
+		response.Transactions = append(response.Transactions, transactionToProto(tx))
+	}
+	return response, nil
+}
+
+func (s *grpcServer) ListPeers(ctx context.Context, request *grpcapi.ListPeersRequest) (*grpcapi.ListPeersResponse, error) {
+	response := &grpcapi.ListPeersResponse{}
+	for _, peer := range s.app.Peers.PeerList() {
+		response.Peers = append(response.Peers, &grpcapi.Peer{
+			NodeAddress:    peer.NodeAddress,
+			NodeId:         peer.NodeID,
+			Version:        int64(peer.Version),
+			NetworkId:      peer.NetworkID,
+			GenesisHash:    peer.GenesisHash,
+			BestHeight:     int64(peer.BestHeight),
+			BestHash:       peer.BestHash,
+			CumulativeWork: peer.CumulativeWork,
+			LastSeen:       peer.LastSeen,
+			Failures:       int64(peer.Failures),
+			LatencyMs:      peer.LatencyMs,
+			Score:          int64(peer.Score),
+			BannedUntil:    peer.BannedUntil,
+		})
+	}
+	return response, nil
+}
+
+func (s *grpcServer) Mine(ctx context.Context, request *grpcapi.MineRequest) (*grpcapi.MineResponse, error) {
+	result, err := s.app.mine()
+	if errors.Is(err, blockchain.ErrNotInTurn) {
+		return nil, status.Error(codes.FailedPrecondition, "not in turn to seal block")
+	}
+	if err != nil {
+		log.Println("Error mining block:", err)
+		return nil, status.Error(codes.Internal, "mining failed")
+	}
+	response := &grpcapi.MineResponse{Message: result.Message, ChainLength: int64(result.ChainLength)}
+	for _, tx := range result.Transactions {
+		response.Transactions = append(response.Transactions, transactionToProto(tx))
+	}
+	return response, nil
+}
+
+func (s *grpcServer) SubscribeBlocks(request *grpcapi.SubscribeBlocksRequest, stream grpcapi.Node_SubscribeBlocksServer) error {
+	return s.subscribe(stream.Context(), blockchain.EventBlock, func(event blockchain.Event) error {
+		return stream.Send(blockToProto(*event.Block))
+	})
+}
+
+func (s *grpcServer) SubscribeTransactions(request *grpcapi.SubscribeTransactionsRequest, stream grpcapi.Node_SubscribeTransactionsServer) error {
+	return s.subscribe(stream.Context(), blockchain.EventTx, func(event blockchain.Event) error {
+		return stream.Send(transactionToProto(*event.Transaction))
+	})
+}
+
+// subscribe sends the chain events of the type until the stream is closed.
+func (s *grpcServer) subscribe(ctx context.Context, eventType string, send func(event blockchain.Event) error) error {
+	events, unsubscribe := s.app.Blockchain.Events.Subscribe()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			if event.Type != eventType {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func blockToProto(block blockchain.Block) *grpcapi.Block {
+	pb := &grpcapi.Block{
+		Index:        int64(block.Index),
+		Timestamp:    block.Timestamp,
+		PreviousHash: block.PreviousHash,
+		Nonce:        int64(block.Nonce),
+		Validator:    block.Validator,
+		Signature:    block.Signature,
+		Hash:         block.Hash,
+	}
+	for _, tx := range block.Transactions {
+		pb.Transactions = append(pb.Transactions, transactionToProto(tx))
+	}
+	return pb
+}
+
+func transactionToProto(tx blockchain.Transaction) *grpcapi.Transaction {
+	return &grpcapi.Transaction{
+		Id:        tx.ID(),
+		Author:    tx.Author,
+		Content:   tx.Content,
+		Timestamp: tx.Timestamp,
+		Type:      tx.Type,
+		Amount:    tx.Amount,
+		Signature: tx.Signature,
+	}
+}
+
+func transactionFromProto(pb *grpcapi.Transaction) blockchain.Transaction {
+	return blockchain.Transaction{
+		Author:    pb.Author,
+		Content:   pb.Content,
+		Timestamp: pb.Timestamp,
+		Type:      pb.Type,
+		Amount:    pb.Amount,
+		Signature: pb.Signature,
+	}
+}
+
+func txStatusToProto(txStatus blockchain.TxStatus) *grpcapi.TxStatus {
+	return &grpcapi.TxStatus{
+		Id:            txStatus.ID,
+		Status:        txStatus.Status,
+		Transaction:   transactionToProto(txStatus.Transaction),
+		BlockHeight:   int64(txStatus.BlockHeight),
+		BlockHash:     txStatus.BlockHash,
+		Confirmations: int64(txStatus.Confirmations),
+		Finalized:     txStatus.Finalized,
+	}
+}
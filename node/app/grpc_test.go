@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+	"github.com/chokey2nv/ultainfinity/node/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient serves the application gRPC service in memory and returns a client of it.
+func newGRPCClient(t *testing.T, app *Application) grpcapi.NodeClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	grpcapi.RegisterNodeServer(server, &grpcServer{app: app})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return grpcapi.NewNodeClient(conn)
+}
+
+func TestGRPCServer(t *testing.T) {
+	app := newTestApp(t, Config{})
+	client := newGRPCClient(t, app)
+	genesis := app.Blockchain.GetLastBlock()
+	var txID string
+	tests := []struct {
+		name     string
+		call     func(ctx context.Context) error
+		wantCode codes.Code
+	}{
+		{name: "tip", call: func(ctx context.Context) error {
+			tip, err := client.GetTip(ctx, &grpcapi.GetTipRequest{})
+			if err == nil && (tip.Height != 0 || tip.Hash != genesis.Hash || !tip.IsValid) {
+				t.Errorf("tip %v, want the genesis block", tip)
+			}
+			return err
+		}},
+		{name: "block by height", call: func(ctx context.Context) error {
+			block, err := client.GetBlock(ctx, &grpcapi.GetBlockRequest{Key: &grpcapi.GetBlockRequest_Height{Height: 0}})
+			if err == nil && block.Hash != genesis.Hash {
+				t.Errorf("block %s, want %s", block.Hash, genesis.Hash)
+			}
+			return err
+		}},
+		{name: "block by hash", call: func(ctx context.Context) error {
+			block, err := client.GetBlock(ctx, &grpcapi.GetBlockRequest{Key: &grpcapi.GetBlockRequest_Hash{Hash: genesis.Hash}})
+			if err == nil && block.Index != 0 {
+				t.Errorf("block %d, want 0", block.Index)
+			}
+			return err
+		}},
+		{name: "block without key", call: func(ctx context.Context) error {
+			_, err := client.GetBlock(ctx, &grpcapi.GetBlockRequest{})
+			return err
+		}, wantCode: codes.InvalidArgument},
+		{name: "unknown block", call: func(ctx context.Context) error {
+			_, err := client.GetBlock(ctx, &grpcapi.GetBlockRequest{Key: &grpcapi.GetBlockRequest_Height{Height: 5}})
+			return err
+		}, wantCode: codes.NotFound},
+		{name: "negative range", call: func(ctx context.Context) error {
+			_, err := client.GetBlocks(ctx, &grpcapi.GetBlocksRequest{From: -1})
+			return err
+		}, wantCode: codes.InvalidArgument},
+		{name: "no transaction", call: func(ctx context.Context) error {
+			_, err := client.SendTransaction(ctx, &grpcapi.SendTransactionRequest{})
+			return err
+		}, wantCode: codes.InvalidArgument},
+		{name: "invalid transaction", call: func(ctx context.Context) error {
+			_, err := client.SendTransaction(ctx, &grpcapi.SendTransactionRequest{Transaction: &grpcapi.Transaction{Author: "alice"}})
+			return err
+		}, wantCode: codes.InvalidArgument},
+		{name: "send transaction", call: func(ctx context.Context) error {
+			txStatus, err := client.SendTransaction(ctx, &grpcapi.SendTransactionRequest{Transaction: &grpcapi.Transaction{Author: "alice", Content: "hello"}})
+			if err == nil {
+				txID = txStatus.Id
+				if txStatus.Status != "pending" || txStatus.Transaction.Content != "hello" {
+					t.Errorf("sent transaction %v, want pending", txStatus)
+				}
+			}
+			return err
+		}},
+		{name: "pending transactions", call: func(ctx context.Context) error {
+			response, err := client.ListPendingTransactions(ctx, &grpcapi.ListPendingTransactionsRequest{})
+			if err == nil && (len(response.Transactions) != 1 || response.Transactions[0].Id != txID) {
+				t.Errorf("pending %v, want %s", response.Transactions, txID)
+			}
+			return err
+		}},
+		{name: "mine", call: func(ctx context.Context) error {
+			response, err := client.Mine(ctx, &grpcapi.MineRequest{})
+			if err == nil && (response.ChainLength != 2 || len(response.Transactions) != 1) {
+				t.Errorf("mined %v, want a block with the transaction", response)
+			}
+			return err
+		}},
+		{name: "confirmed transaction", call: func(ctx context.Context) error {
+			txStatus, err := client.GetTransaction(ctx, &grpcapi.GetTransactionRequest{Id: txID})
+			if err == nil && (txStatus.Status != "confirmed" || txStatus.BlockHeight != 1 || txStatus.Confirmations != 1) {
+				t.Errorf("transaction %v, want confirmed in block 1", txStatus)
+			}
+			return err
+		}},
+		{name: "unknown transaction", call: func(ctx context.Context) error {
+			_, err := client.GetTransaction(ctx, &grpcapi.GetTransactionRequest{Id: "unknown"})
+			return err
+		}, wantCode: codes.NotFound},
+		{name: "blocks", call: func(ctx context.Context) error {
+			response, err := client.GetBlocks(ctx, &grpcapi.GetBlocksRequest{From: 1})
+			if err == nil && (response.Total != 2 || len(response.Blocks) != 1 || response.Blocks[0].Transactions[0].Id != txID) {
+				t.Errorf("blocks %v, want block 1 of 2", response)
+			}
+			return err
+		}},
+		{name: "peers", call: func(ctx context.Context) error {
+			response, err := client.ListPeers(ctx, &grpcapi.ListPeersRequest{})
+			if err == nil && len(response.Peers) != 0 {
+				t.Errorf("peers %v, want none", response.Peers)
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if code := status.Code(tt.call(ctx)); code != tt.wantCode {
+				t.Errorf("code %s, want %s", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGRPCSubscriptions(t *testing.T) {
+	app := newTestApp(t, Config{})
+	client := newGRPCClient(t, app)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	blocks, err := client.SubscribeBlocks(ctx, &grpcapi.SubscribeBlocksRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err := client.SubscribeTransactions(ctx, &grpcapi.SubscribeTransactionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type received struct {
+		block *grpcapi.Block
+		tx    *grpcapi.Transaction
+		err   error
+	}
+	firstBlock, firstTx := make(chan received, 1), make(chan received, 1)
+	go func() {
+		block, err := blocks.Recv()
+		firstBlock <- received{block: block, err: err}
+	}()
+	go func() {
+		tx, err := txs.Recv()
+		firstTx <- received{tx: tx, err: err}
+	}()
+	// the subscriptions start asynchronously, add blocks until both streams got one
+	var gotBlock, gotTx *received
+	for gotBlock == nil || gotTx == nil {
+		select {
+		case r := <-firstBlock:
+			gotBlock = &r
+		case r := <-firstTx:
+			gotTx = &r
+		case <-ctx.Done():
+			t.Fatal("no block or transaction streamed")
+		case <-time.After(50 * time.Millisecond):
+			if _, err := app.newTransaction(blockchain.Transaction{Author: "alice", Content: "streamed"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := app.mine(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if gotBlock.err != nil || gotTx.err != nil {
+		t.Fatalf("stream errors %v, %v", gotBlock.err, gotTx.err)
+	}
+	if block, ok := app.Blockchain.BlockByHash(gotBlock.block.Hash); !ok || int64(block.Index) != gotBlock.block.Index || block.Index == 0 {
+		t.Errorf("streamed block %d %s not added to the chain", gotBlock.block.Index, gotBlock.block.Hash)
+	}
+	if gotTx.tx.Author != "alice" || gotTx.tx.Content != "streamed" || gotTx.tx.Id == "" {
+		t.Errorf("streamed transaction %v", gotTx.tx)
+	}
+}
@@ -0,0 +1,214 @@
+package app
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MaxBodySize is the size limit in bytes of request bodies.
+const MaxBodySize = 1 << 20
+
+// Idempotency settings.
+const (
+	IdempotencyHeader  = "Idempotency-Key"
+	ReplayedHeader     = "Idempotent-Replayed" // set on replayed responses
+	MaxIdempotencyKey  = 255                   // length of a key
+	IdempotencyKeyTTL  = 24 * time.Hour        // time a response is replayed for
+	MaxIdempotencyKeys = 10000                 // responses kept, the oldest handled are dropped first
+)
+
+// limitBody rejects the requests with a body larger than MaxBodySize.
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > MaxBodySize {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, "Request body too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// idempotentResponse is the response of a request made with an idempotency key.
+type idempotentResponse struct {
+	key         string
+	fingerprint string // hash of the request body
+	done        bool   // false while the request is handled
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+var (
+	errIdempotencyKeyUsed   = errors.New("idempotency key already used")
+	errIdempotencyStoreFull = errors.New("idempotency store full of requests in progress")
+)
+
+// idempotencyStore keeps the responses by method, path and idempotency key, at
+// most max of them. As every key is kept for IdempotencyKeyTTL, the order the keys
+// are added in is the order they expire in.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	max       int
+	responses map[string]*list.Element // of order
+	order     *list.List               // of *idempotentResponse, expiring first in front
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{max: MaxIdempotencyKeys, responses: map[string]*list.Element{}, order: list.New()}
+}
+
+// begin reserves the key for a request with the body fingerprint. If the key is
+// already used it returns a copy of its response and errIdempotencyKeyUsed, and if
+// the store is full of requests in progress errIdempotencyStoreFull.
+func (s *idempotencyStore) begin(key string, fingerprint string) (idempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.expire(now)
+	if element, ok := s.responses[key]; ok {
+		return *element.Value.(*idempotentResponse), errIdempotencyKeyUsed
+	}
+	if len(s.responses) >= s.max && !s.dropOldest() {
+		return idempotentResponse{}, errIdempotencyStoreFull
+	}
+	response := &idempotentResponse{key: key, fingerprint: fingerprint, expires: now.Add(IdempotencyKeyTTL)}
+	s.responses[key] = s.order.PushBack(response)
+	return idempotentResponse{}, nil
+}
+
+// expire removes the responses expired at now, from the front (under lock).
+func (s *idempotencyStore) expire(now time.Time) {
+	for element := s.order.Front(); element != nil && !now.Before(element.Value.(*idempotentResponse).expires); element = s.order.Front() {
+		s.remove(element)
+	}
+}
+
+// dropOldest removes the handled response expiring first, skipping the requests
+// in progress, and reports if there was one (under lock).
+func (s *idempotencyStore) dropOldest() bool {
+	for element := s.order.Front(); element != nil; element = element.Next() {
+		if element.Value.(*idempotentResponse).done {
+			s.remove(element)
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes the response of element (under lock).
+func (s *idempotencyStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.responses, element.Value.(*idempotentResponse).key)
+}
+
+// finish stores the response of the request holding the key.
+func (s *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.responses[key]; ok {
+		response := element.Value.(*idempotentResponse)
+		response.done = true
+		response.status = status
+		response.header = header
+		response.body = body
+	}
+}
+
+// release frees the key, for the request to be retried.
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.responses[key]; ok {
+		s.remove(element)
+	}
+}
+
+// responseRecorder copies the response written to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent handles the requests with an Idempotency-Key header once: a retry with
+// the same key and body gets the first response replayed, so that a retried request
+// (e.g. after a timeout) doesn't mine or add a transaction twice. Server errors aren't
+// kept, the request can be retried with the same key. When MaxIdempotencyKeys requests
+// are in progress, the others are refused until one is handled.
+func (app *Application) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			handler(w, r)
+			return
+		}
+		if len(key) > MaxIdempotencyKey {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Idempotency key too long")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeError(w, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, "Request body too large")
+			} else {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+			}
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		key = r.Method + " " + r.URL.Path + " " + key
+		previous, err := app.idempotency.begin(key, fingerprint)
+		if err != nil {
+			switch {
+			case errors.Is(err, errIdempotencyStoreFull):
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusServiceUnavailable, ErrCodeIdempotencyStoreFull, "Too many requests with an idempotency key in progress")
+			case previous.fingerprint != fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, ErrCodeIdempotencyKeyReused, "Idempotency key already used for another request")
+			case !previous.done:
+				writeError(w, http.StatusConflict, ErrCodeIdempotencyKeyInUse, "A request with this idempotency key is in progress")
+			default:
+				for name, values := range previous.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(previous.status)
+				w.Write(previous.body)
+			}
+			return
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		handler(rec, r)
+		if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+			app.idempotency.release(key)
+			return
+		}
+		app.idempotency.finish(key, rec.status, w.Header().Clone(), rec.body.Bytes())
+	}
+}
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		key          string
+		body         string
+		wantStatus   int
+		wantReplayed bool
+		wantCalls    int // handler calls after the request
+	}{
+		{name: "no key", path: "/a", body: "1", wantStatus: http.StatusCreated, wantCalls: 1},
+		{name: "no key again", path: "/a", body: "1", wantStatus: http.StatusCreated, wantCalls: 2},
+		{name: "first", path: "/a", key: "k", body: "1", wantStatus: http.StatusCreated, wantCalls: 3},
+		{name: "retry", path: "/a", key: "k", body: "1", wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 3},
+		{name: "other body", path: "/a", key: "k", body: "2", wantStatus: http.StatusUnprocessableEntity, wantCalls: 3},
+		{name: "other path", path: "/b", key: "k", body: "2", wantStatus: http.StatusCreated, wantCalls: 4},
+		{name: "client error kept", path: "/a", key: "bad", body: "invalid", wantStatus: http.StatusBadRequest, wantCalls: 5},
+		{name: "client error replayed", path: "/a", key: "bad", body: "invalid", wantStatus: http.StatusBadRequest, wantReplayed: true, wantCalls: 5},
+		{name: "server error", path: "/a", key: "fail", body: "fail", wantStatus: http.StatusInternalServerError, wantCalls: 6},
+		{name: "server error retried", path: "/a", key: "fail", body: "fail", wantStatus: http.StatusInternalServerError, wantCalls: 7},
+		{name: "key too long", path: "/a", key: strings.Repeat("k", MaxIdempotencyKey+1), body: "1", wantStatus: http.StatusBadRequest, wantCalls: 7},
+		{name: "longest key", path: "/a", key: strings.Repeat("k", MaxIdempotencyKey), body: "1", wantStatus: http.StatusCreated, wantCalls: 8},
+	}
+	app := &Application{idempotency: newIdempotencyStore()}
+	calls := 0
+	handler := app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		switch string(body) {
+		case "invalid":
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid")
+		case "fail":
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		default:
+			writeMessage(w, http.StatusCreated, "created "+string(body))
+		}
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.key != "" {
+				r.Header.Set(IdempotencyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed %v, want %v", replayed, tt.wantReplayed)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d handler calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// TestIdempotentInProgress checks a retry while the first request is handled is refused.
+func TestIdempotentInProgress(t *testing.T) {
+	app := &Application{idempotency: newIdempotencyStore()}
+	started, release := make(chan bool), make(chan bool)
+	handler := app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		writeMessage(w, http.StatusOK, "done")
+	})
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/mine", nil)
+		r.Header.Set(IdempotencyHeader, "k")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	var first *httptest.ResponseRecorder
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first = request()
+	}()
+	<-started
+	if w := request(); w.Code != http.StatusConflict {
+		t.Errorf("retry in progress status %d, want %d", w.Code, http.StatusConflict)
+	}
+	release <- true
+	wg.Wait()
+	if first.Code != http.StatusOK {
+		t.Errorf("first status %d, want %d", first.Code, http.StatusOK)
+	}
+	if w := request(); w.Code != http.StatusOK || w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry after status %d replayed %q, want the replayed response", w.Code, w.Header().Get(ReplayedHeader))
+	}
+}
+
+func TestIdempotencyStoreLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string // added in order, with a store of 3 keys
+		done     []string // keys handled, the others in progress
+		expired  []string
+		wantErr  error
+		wantKeys []string // keys kept after adding "new"
+	}{
+		{name: "room left", keys: []string{"a", "b"}, done: []string{"a"}, wantKeys: []string{"a", "b", "new"}},
+		{name: "oldest handled dropped", keys: []string{"a", "b", "c"}, done: []string{"a", "b", "c"}, wantKeys: []string{"b", "c", "new"}},
+		{name: "in progress skipped", keys: []string{"a", "b", "c"}, done: []string{"b", "c"}, wantKeys: []string{"a", "c", "new"}},
+		{name: "expired dropped", keys: []string{"a", "b", "c"}, expired: []string{"a"}, wantKeys: []string{"b", "c", "new"}},
+		{name: "all in progress", keys: []string{"a", "b", "c"}, wantErr: errIdempotencyStoreFull, wantKeys: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newIdempotencyStore()
+			s.max = 3
+			for _, key := range tt.keys {
+				if _, err := s.begin(key, "f"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, key := range tt.done {
+				s.finish(key, http.StatusOK, nil, nil)
+			}
+			for _, key := range tt.expired {
+				s.responses[key].Value.(*idempotentResponse).expires = time.Now()
+			}
+			if _, err := s.begin("new", "f"); err != tt.wantErr {
+				t.Fatalf("begin() error = %v, want %v", err, tt.wantErr)
+			}
+			var kept []string
+			for element := s.order.Front(); element != nil; element = element.Next() {
+				kept = append(kept, element.Value.(*idempotentResponse).key)
+			}
+			if !reflect.DeepEqual(kept, tt.wantKeys) || len(s.responses) != len(tt.wantKeys) {
+				t.Errorf("kept %v (%d responses), want %v", kept, len(s.responses), tt.wantKeys)
+			}
+		})
+	}
+}
+
+// TestIdempotentStoreFull checks requests with a key are refused while the store
+// is full of requests in progress.
+func TestIdempotentStoreFull(t *testing.T) {
+	app := &Application{idempotency: newIdempotencyStore()}
+	app.idempotency.max = 1
+	started, release := make(chan bool), make(chan bool)
+	handler := app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		writeMessage(w, http.StatusOK, "done")
+	})
+	request := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/mine", nil)
+		r.Header.Set(IdempotencyHeader, key)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		request("a")
+	}()
+	<-started
+	if w := request("b"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("store full status %d Retry-After %q, want %d", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	release <- true
+	wg.Wait()
+	go func() { <-started; release <- true }()
+	if w := request("b"); w.Code != http.StatusOK {
+		t.Errorf("status %d once handled, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		chunked    bool // without Content-Length
+		key        string
+		wantStatus int
+	}{
+		{name: "at the limit", size: MaxBodySize, wantStatus: http.StatusOK},
+		{name: "over the limit", size: MaxBodySize + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "chunked over the limit", size: MaxBodySize + 1, chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "idempotent over the limit", size: MaxBodySize + 1, chunked: true, key: "k", wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	app := &Application{idempotency: newIdempotencyStore()}
+	handler := limitBody(app.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, "Request body too large")
+			return
+		}
+		writeMessage(w, http.StatusOK, "read")
+	}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", tt.size)))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			if tt.key != "" {
+				r.Header.Set(IdempotencyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
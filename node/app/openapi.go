@@ -0,0 +1,18 @@
+package app
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 description of the node HTTP API.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+//Endpoint /openapi.yaml handler - returns the OpenAPI specification of the node API
+func (app *Application) HandleGetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
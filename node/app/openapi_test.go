@@ -0,0 +1,681 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+	"github.com/chokey2nv/ultainfinity/node/webhook"
+	"github.com/go-chi/chi"
+)
+
+// yamlLine is a line of the specification, without its indentation.
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+// yamlParser parses the YAML subset the specification is written in: block mappings and
+// sequences, literal block scalars and single line flow collections.
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+// parseYAML returns the document as maps, slices and strings.
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for _, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimLeft(line, " ")
+		if text = strings.TrimRight(text, " \r"); text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{indent: len(line) - len(strings.TrimLeft(line, " ")), text: text})
+	}
+	value, err := p.block(0)
+	if err == nil && p.i < len(p.lines) {
+		err = fmt.Errorf("line %q: unexpected indentation", p.lines[p.i].text)
+	}
+	return value, err
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if strings.HasPrefix(p.lines[p.i].text, "- ") {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && !strings.HasPrefix(p.lines[p.i].text, "- ") {
+		key, rest, ok := splitKey(p.lines[p.i].text)
+		if !ok {
+			return nil, fmt.Errorf("line %q: key expected", p.lines[p.i].text)
+		}
+		p.i++
+		var value interface{}
+		var err error
+		switch {
+		case rest == "|":
+			lines := []string{}
+			for ; p.i < len(p.lines) && p.lines[p.i].indent > indent; p.i++ {
+				lines = append(lines, p.lines[p.i].text)
+			}
+			value = strings.Join(lines, "\n")
+		case rest != "":
+			value, err = parseScalar(rest)
+		case p.i < len(p.lines) && (p.lines[p.i].indent > indent || (p.lines[p.i].indent == indent && strings.HasPrefix(p.lines[p.i].text, "- "))):
+			value, err = p.block(p.lines[p.i].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && strings.HasPrefix(p.lines[p.i].text, "- ") {
+		item := strings.TrimPrefix(p.lines[p.i].text, "- ")
+		var value interface{}
+		var err error
+		if _, _, ok := splitKey(item); ok {
+			// a mapping item, its next keys are indented under the first one
+			p.lines[p.i] = yamlLine{indent: indent + 2, text: item}
+			value, err = p.mapping(indent + 2)
+		} else {
+			value, err = parseScalar(item)
+			p.i++
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// splitKey splits a `key: value` line, reporting false if it isn't one.
+func splitKey(text string) (key string, rest string, ok bool) {
+	if strings.HasPrefix(text, `"`) {
+		end := strings.Index(text[1:], `"`) + 1
+		if end == 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		return text[1:end], strings.TrimSpace(text[end+2:]), true
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") {
+		return "", "", false
+	}
+	if strings.HasSuffix(text, ":") && !strings.Contains(text, ": ") {
+		return strings.TrimSuffix(text, ":"), "", true
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	return "", "", false
+}
+
+// parseScalar parses a flow collection, a quoted string or a plain string.
+func parseScalar(text string) (interface{}, error) {
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") && !strings.HasPrefix(text, `"`) {
+		return text, nil
+	}
+	f := &flowParser{text: text}
+	value, err := f.value(",}]")
+	if err == nil && strings.TrimSpace(f.text[f.i:]) != "" {
+		err = fmt.Errorf("%q: unexpected %q", text, f.text[f.i:])
+	}
+	return value, err
+}
+
+// flowParser parses a flow collection, e.g. `{type: array, items: [a, "b"]}`.
+type flowParser struct {
+	text string
+	i    int
+}
+
+// value parses a collection, or a string ending before one of the stop characters.
+func (f *flowParser) value(stops string) (interface{}, error) {
+	for f.i < len(f.text) && f.text[f.i] == ' ' {
+		f.i++
+	}
+	if f.i >= len(f.text) {
+		return "", nil
+	}
+	switch f.text[f.i] {
+	case '{':
+		m := map[string]interface{}{}
+		err := f.collection('}', func() error {
+			key, err := f.value(":,}")
+			if err != nil {
+				return err
+			}
+			if f.i >= len(f.text) || f.text[f.i] != ':' {
+				return fmt.Errorf("%q: colon expected", f.text)
+			}
+			f.i++
+			value, err := f.value(",}")
+			m[fmt.Sprint(key)] = value
+			return err
+		})
+		return m, err
+	case '[':
+		list := []interface{}{}
+		err := f.collection(']', func() error {
+			value, err := f.value(",]")
+			list = append(list, value)
+			return err
+		})
+		return list, err
+	case '"':
+		end := strings.Index(f.text[f.i+1:], `"`)
+		if end < 0 {
+			return nil, fmt.Errorf("%q: unterminated string", f.text)
+		}
+		value := f.text[f.i+1 : f.i+1+end]
+		f.i += end + 2
+		return value, nil
+	}
+	start := f.i
+	for f.i < len(f.text) && !strings.ContainsRune(stops, rune(f.text[f.i])) {
+		f.i++
+	}
+	return strings.TrimSpace(f.text[start:f.i]), nil
+}
+
+// collection parses the items of a collection up to its end character.
+func (f *flowParser) collection(end byte, item func() error) error {
+	f.i++
+	for {
+		for f.i < len(f.text) && f.text[f.i] == ' ' {
+			f.i++
+		}
+		if f.i < len(f.text) && f.text[f.i] == end {
+			f.i++
+			return nil
+		}
+		if err := item(); err != nil {
+			return err
+		}
+		for f.i < len(f.text) && f.text[f.i] == ' ' {
+			f.i++
+		}
+		switch {
+		case f.i < len(f.text) && f.text[f.i] == ',':
+			f.i++
+		case f.i < len(f.text) && f.text[f.i] == end:
+		default:
+			return fmt.Errorf("%q: %q expected", f.text, end)
+		}
+	}
+}
+
+// openAPI returns the parsed embedded specification.
+func openAPI(t *testing.T) map[string]interface{} {
+	t.Helper()
+	spec, err := parseYAML(openAPISpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec.(map[string]interface{})
+}
+
+// lookup returns the value at the path of keys, nil if there is none.
+func lookup(node interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[key]
+	}
+	return node
+}
+
+// resolve returns the object, or the object it references with `$ref`.
+func resolve(spec map[string]interface{}, object map[string]interface{}) (map[string]interface{}, error) {
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return object, nil
+	}
+	resolved, ok := lookup(spec, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown reference %s", ref)
+	}
+	return resolved, nil
+}
+
+// checkSchema reports how the decoded JSON value doesn't match the schema.
+func checkSchema(spec map[string]interface{}, schema map[string]interface{}, value interface{}, path string) error {
+	schema, err := resolve(spec, schema)
+	if err != nil {
+		return err
+	}
+	if value == nil && schema["nullable"] == "true" {
+		return nil
+	}
+	if alternatives, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, alternative := range alternatives {
+			if checkSchema(spec, alternative.(map[string]interface{}), value, path) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return fmt.Errorf("%s: matches %d schemas of oneOf", path, matched)
+		}
+	}
+	if schemas, ok := schema["allOf"].([]interface{}); ok {
+		for _, s := range schemas {
+			if err := checkSchema(spec, s.(map[string]interface{}), value, path); err != nil {
+				return err
+			}
+		}
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", path, value)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, key := range required {
+			if _, ok := object[key.(string)]; !ok {
+				return fmt.Errorf("%s: required %s missing", path, key)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for key, v := range object {
+			property, ok := properties[key].(map[string]interface{})
+			if !ok {
+				property = additional
+			}
+			if property == nil {
+				continue
+			}
+			if err := checkSchema(spec, property, v, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", path, value)
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, item := range list {
+			if err := checkSchema(spec, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: %v is not a string", path, value)
+		}
+	case "integer":
+		if n, ok := value.(json.Number); !ok || strings.ContainsAny(n.String(), ".eE") {
+			return fmt.Errorf("%s: %v is not an integer", path, value)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: %v is not a number", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", path, value)
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v not in %v", path, value, enum)
+	}
+	return nil
+}
+
+// checkResponse reports how the response doesn't match the response documented for its status.
+func checkResponse(spec map[string]interface{}, response map[string]interface{}, w *httptest.ResponseRecorder) error {
+	response, err := resolve(spec, response)
+	if err != nil {
+		return err
+	}
+	content, ok := response["content"].(map[string]interface{})
+	if !ok {
+		if w.Body.Len() != 0 {
+			return fmt.Errorf("undocumented body %s", w.Body)
+		}
+		return nil
+	}
+	for contentType, media := range content {
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), contentType) {
+			continue
+		}
+		if contentType != "application/json" {
+			return nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("body %s: %v", w.Body, err)
+		}
+		schema, _ := lookup(media, "schema").(map[string]interface{})
+		return checkSchema(spec, schema, value, "body")
+	}
+	return fmt.Errorf("content type %q not documented", w.Header().Get("Content-Type"))
+}
+
+// operations returns the documented "METHOD /path" operations.
+func operations(spec map[string]interface{}) map[string]map[string]interface{} {
+	ops := map[string]map[string]interface{}{}
+	for path, item := range lookup(spec, "paths").(map[string]interface{}) {
+		for method, operation := range item.(map[string]interface{}) {
+			if method != "parameters" {
+				ops[strings.ToUpper(method)+" "+path] = operation.(map[string]interface{})
+			}
+		}
+	}
+	return ops
+}
+
+// routes returns the "METHOD /path" routes of the router.
+func routes(t *testing.T, router chi.Routes) map[string]bool {
+	t.Helper()
+	routes := map[string]bool{}
+	err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := openAPI(t)
+	ops := operations(spec)
+	routed := routes(t, newTestApp(t, Config{}).Router)
+	for route := range routed {
+		if _, ok := ops[route]; !ok {
+			t.Errorf("route %s not documented", route)
+		}
+	}
+	for op, operation := range ops {
+		if !routed[op] {
+			t.Errorf("documented %s not routed", op)
+		}
+		// errors are Error objects
+		for status, response := range lookup(operation, "responses").(map[string]interface{}) {
+			if code, _ := strconv.Atoi(status); code < 400 {
+				continue
+			}
+			response, err := resolve(spec, response.(map[string]interface{}))
+			if err != nil {
+				t.Errorf("%s %s: %v", op, status, err)
+				continue
+			}
+			if ref := lookup(response, "content", "application/json", "schema", "$ref"); ref != "#/components/schemas/Error" {
+				t.Errorf("%s %s response is %v, want an Error", op, status, ref)
+			}
+		}
+	}
+}
+
+// contractApps are applications with each consensus, the proof of work chain has a block
+// with a post.
+type contractApps struct {
+	pow, poa, pos *Application
+}
+
+func newContractApps(t *testing.T) contractApps {
+	t.Helper()
+	keys := []ed25519.PrivateKey{}
+	validators := []string{}
+	for _, seed := range []byte{1, 2} {
+		key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+		keys = append(keys, key)
+		validators = append(validators, hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+	}
+	apps := contractApps{
+		pow: newTestApp(t, Config{}),
+		// the node holds the first key, it is not in turn to seal block 1
+		poa: newTestApp(t, Config{Finality: true, Consensus: blockchain.EngineConfig{
+			Name: blockchain.ConsensusPoA, Validators: validators, PrivateKey: hex.EncodeToString(keys[0].Seed()),
+		}}),
+		pos: newTestApp(t, Config{Consensus: blockchain.EngineConfig{
+			Name:        blockchain.ConsensusPoS,
+			Allocations: map[string]int64{validators[0]: 100},
+			Stakes:      map[string]int64{validators[0]: 10},
+		}}),
+	}
+	apps.pow.Blockchain.AddNewTransaction(&blockchain.Transaction{Author: "alice", Content: "hello world", Timestamp: 1})
+	if _, err := apps.pow.mine(); err != nil {
+		t.Fatal(err)
+	}
+	return apps
+}
+
+// TestOpenAPIContract sends requests to every route and checks the responses match
+// the specification.
+func TestOpenAPIContract(t *testing.T) {
+	spec := openAPI(t)
+	ops := operations(spec)
+	apps := newContractApps(t)
+	app := apps.pow
+	block := app.Blockchain.GetLastBlock()
+	txID := block.Transactions[0].ID()
+	hook, err := app.Webhooks.Register(webhook.Webhook{URL: "http://127.0.0.1:1/hook", Events: []string{webhook.EventBlock}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handshake := func(edit func(h *blockchain.Handshake)) string {
+		h := app.Blockchain.Handshake("http://127.0.0.1:9")
+		h.NodeID = "peer"
+		edit(&h)
+		data, _ := json.Marshal(h)
+		return string(data)
+	}
+	// a node with two blocks, registered with by fresh and pushing its blocks to behind
+	peer := newTestApp(t, Config{})
+	peerServer := httptest.NewServer(peer.Router)
+	defer peerServer.Close()
+	fresh, behind := newTestApp(t, Config{}), newTestApp(t, Config{})
+	peerBlocks := []string{}
+	for _, content := range []string{"first", "second"} {
+		peer.Blockchain.AddNewTransaction(&blockchain.Transaction{Author: "bob", Content: content, Timestamp: 1})
+		if _, err := peer.mine(); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(peer.Blockchain.GetLastBlock())
+		peerBlocks = append(peerBlocks, string(data))
+	}
+	fromPeer := http.Header{}
+	fromPeer.Set(blockchain.NodeIDHeader, "peer")
+	tooLarge := `{"author":"alice","content":"` + strings.Repeat("x", MaxBodySize) + `"}`
+
+	tests := []struct {
+		app        *Application
+		method     string
+		route      string
+		target     string
+		body       string
+		header     http.Header
+		wantStatus int
+	}{
+		{app, "GET", "/openapi.yaml", "/openapi.yaml", "", nil, http.StatusOK},
+		{app, "GET", "/chain", "/chain", "", nil, http.StatusOK},
+		{app, "GET", "/blocks", "/blocks?from=1", "", nil, http.StatusOK},
+		{app, "GET", "/blocks", "/blocks?from=-1", "", nil, http.StatusBadRequest},
+		{app, "GET", "/blocks/{height}", "/blocks/1", "", nil, http.StatusOK},
+		{app, "GET", "/blocks/{height}", "/blocks/x", "", nil, http.StatusBadRequest},
+		{app, "GET", "/blocks/{height}", "/blocks/9", "", nil, http.StatusNotFound},
+		{app, "GET", "/blocks/hash/{hash}", "/blocks/hash/" + block.Hash, "", nil, http.StatusOK},
+		{app, "GET", "/blocks/hash/{hash}", "/blocks/hash/unknown", "", nil, http.StatusNotFound},
+		{app, "GET", "/tip", "/tip", "", nil, http.StatusOK},
+		{app, "GET", "/genesis", "/genesis", "", nil, http.StatusOK},
+		{app, "POST", "/new_transaction", "/new_transaction", `{"author":"alice","content":"pending"}`, http.Header{IdempotencyHeader: {"k1"}}, http.StatusCreated},
+		{app, "POST", "/new_transaction", "/new_transaction", `{"author":"alice","content":"other"}`, http.Header{IdempotencyHeader: {"k1"}}, http.StatusUnprocessableEntity},
+		{app, "POST", "/new_transaction", "/new_transaction", `{"author":`, nil, http.StatusBadRequest},
+		{app, "POST", "/new_transaction", "/new_transaction", `{"author":"alice"}`, nil, http.StatusBadRequest},
+		{app, "POST", "/new_transaction", "/new_transaction", tooLarge, nil, http.StatusRequestEntityTooLarge},
+		{app, "GET", "/pending_tx", "/pending_tx", "", nil, http.StatusOK},
+		{app, "GET", "/tx/{id}", "/tx/" + txID, "", nil, http.StatusOK},
+		{app, "GET", "/tx/{id}", "/tx/unknown", "", nil, http.StatusNotFound},
+		{app, "GET", "/posts", "/posts", "", nil, http.StatusOK},
+		{app, "GET", "/posts", "/posts?since=x", "", nil, http.StatusBadRequest},
+		{app, "GET", "/authors/{author}/posts", "/authors/alice/posts", "", nil, http.StatusOK},
+		{app, "GET", "/authors/{author}/posts", "/authors/alice/posts?limit=x", "", nil, http.StatusBadRequest},
+		{app, "GET", "/search", "/search?q=hello", "", nil, http.StatusOK},
+		{app, "GET", "/search", "/search", "", nil, http.StatusBadRequest},
+		{app, "POST", "/mine", "/mine", "", nil, http.StatusOK},
+		{apps.poa, "POST", "/new_transaction", "/new_transaction", `{"author":"alice","content":"hello"}`, nil, http.StatusCreated},
+		{apps.poa, "POST", "/mine", "/mine", "", nil, http.StatusConflict},
+		{app, "POST", "/register_node", "/register_node", handshake(func(h *blockchain.Handshake) {}), nil, http.StatusOK},
+		{app, "POST", "/register_node", "/register_node", `{}`, nil, http.StatusBadRequest},
+		{app, "POST", "/register_node", "/register_node", handshake(func(h *blockchain.Handshake) { h.NetworkID = "other" }), nil, http.StatusConflict},
+		{app, "POST", "/handshake", "/handshake", handshake(func(h *blockchain.Handshake) {}), nil, http.StatusOK},
+		{app, "POST", "/handshake", "/handshake", `[`, nil, http.StatusBadRequest},
+		{app, "POST", "/handshake", "/handshake", handshake(func(h *blockchain.Handshake) { h.Version = 0 }), nil, http.StatusConflict},
+		{app, "GET", "/peers", "/peers", "", nil, http.StatusOK},
+		{app, "POST", "/peer_exchange", "/peer_exchange", `{"node_address":"http://127.0.0.1:9","addresses":[]}`, nil, http.StatusOK},
+		{app, "POST", "/peer_exchange", "/peer_exchange", `[`, nil, http.StatusBadRequest},
+		{fresh, "POST", "/register_with", "/register_with", `{"node_address":"` + peerServer.URL + `"}`, nil, http.StatusOK},
+		{app, "POST", "/register_with", "/register_with", `{"node_address":""}`, nil, http.StatusBadRequest},
+		{app, "POST", "/register_with", "/register_with", `{"node_address":"http://127.0.0.1:1"}`, nil, http.StatusBadGateway},
+		{behind, "POST", "/add_block", "/add_block", peerBlocks[1], nil, http.StatusAccepted},
+		{behind, "POST", "/add_block", "/add_block", peerBlocks[0], nil, http.StatusCreated},
+		{behind, "POST", "/add_block", "/add_block", `[`, nil, http.StatusBadRequest},
+		{app, "POST", "/add_block", "/add_block", peerBlocks[0], nil, http.StatusBadRequest},
+		{app, "POST", "/inv", "/inv", `{"hash":"` + block.Hash + `"}`, nil, http.StatusOK},
+		{app, "POST", "/inv", "/inv", `{"hash":"unknown"}`, fromPeer, http.StatusAccepted},
+		{app, "POST", "/inv", "/inv", `{"hash":"unknown"}`, nil, http.StatusForbidden},
+		{app, "POST", "/inv", "/inv", `[`, nil, http.StatusBadRequest},
+		{app, "GET", "/headers", "/headers?from=0", "", nil, http.StatusOK},
+		{app, "GET", "/headers", "/headers", "", nil, http.StatusBadRequest},
+		{app, "POST", "/getdata", "/getdata", `{"hashes":["` + block.Hash + `"]}`, nil, http.StatusOK},
+		{app, "POST", "/getdata", "/getdata", `[`, nil, http.StatusBadRequest},
+		{app, "GET", "/sync", "/sync", "", nil, http.StatusOK},
+		{app, "GET", "/p2p", "/p2p", "", nil, http.StatusNotFound},
+		{app, "GET", "/ledger", "/ledger", "", nil, http.StatusNotFound},
+		{apps.pos, "GET", "/ledger", "/ledger", "", nil, http.StatusOK},
+		{app, "GET", "/finality", "/finality", "", nil, http.StatusNotFound},
+		{apps.poa, "GET", "/finality", "/finality", "", nil, http.StatusOK},
+		{app, "POST", "/finality/vote", "/finality/vote", `{}`, nil, http.StatusNotFound},
+		{apps.poa, "POST", "/finality/vote", "/finality/vote", `{}`, nil, http.StatusBadRequest},
+		{app, "GET", "/reorgs", "/reorgs", "", nil, http.StatusOK},
+		{app, "GET", "/events", "/events?types=block", "", nil, http.StatusOK},
+		{app, "POST", "/webhooks", "/webhooks", `{"url":"http://127.0.0.1:1/hook","events":["block"]}`, nil, http.StatusCreated},
+		{app, "POST", "/webhooks", "/webhooks", `{"url":"ftp://host","events":["block"]}`, nil, http.StatusBadRequest},
+		{app, "GET", "/webhooks", "/webhooks", "", nil, http.StatusOK},
+		{app, "GET", "/webhooks/{id}", "/webhooks/" + hook.ID, "", nil, http.StatusOK},
+		{app, "GET", "/webhooks/{id}", "/webhooks/unknown", "", nil, http.StatusNotFound},
+		{app, "GET", "/webhooks/{id}/deliveries", "/webhooks/" + hook.ID + "/deliveries", "", nil, http.StatusOK},
+		{app, "GET", "/webhooks/{id}/deliveries", "/webhooks/unknown/deliveries", "", nil, http.StatusNotFound},
+		{app, "DELETE", "/webhooks/{id}", "/webhooks/" + hook.ID, "", nil, http.StatusNoContent},
+		{app, "DELETE", "/webhooks/{id}", "/webhooks/" + hook.ID, "", nil, http.StatusNotFound},
+		{app, "POST", "/rpc", "/rpc", `{"jsonrpc":"2.0","method":"chain_getTip","id":1}`, nil, http.StatusOK},
+		{app, "POST", "/rpc", "/rpc", `[{"jsonrpc":"2.0","method":"chain_getTip","id":1},{"jsonrpc":"2.0","method":"chain_unknown","id":2}]`, nil, http.StatusOK},
+		{app, "POST", "/rpc", "/rpc", `{"jsonrpc":"2.0","method":"chain_getTip"}`, nil, http.StatusNoContent},
+		{app, "POST", "/rpc", "/rpc", `{"jsonrpc":"2.0","method":"tx_send","params":{"author":"alice","content":"rpc"},"id":1}`, http.Header{IdempotencyHeader: {"k2"}}, http.StatusOK},
+		{app, "POST", "/rpc", "/rpc", `{"jsonrpc":"2.0","method":"mining_start","id":1}`, http.Header{IdempotencyHeader: {"k2"}}, http.StatusUnprocessableEntity},
+		{app, "POST", "/rpc", "/rpc", tooLarge, nil, http.StatusRequestEntityTooLarge},
+	}
+	tested := map[string]bool{}
+	for _, tt := range tests {
+		op := tt.method + " " + tt.route
+		tested[op] = true
+		r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		if tt.body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		for name, values := range tt.header {
+			r.Header[name] = values
+		}
+		if r.Header.Get(blockchain.NodeIDHeader) != "" {
+			r.RemoteAddr = "127.0.0.1:9000" // from the registered peer host
+		}
+		if tt.route == "/events" {
+			// the event stream is served until the client leaves
+			ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		w := httptest.NewRecorder()
+		tt.app.Router.ServeHTTP(w, r)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s status %d, want %d: %s", tt.method, tt.target, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		response, ok := lookup(ops[op], "responses", strconv.Itoa(w.Code)).(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s status %d not documented for %s", tt.method, tt.target, w.Code, op)
+			continue
+		}
+		if err := checkResponse(spec, response, w); err != nil {
+			t.Errorf("%s %s status %d: %v", tt.method, tt.target, w.Code, err)
+		}
+	}
+	untested := []string{}
+	for route := range routes(t, app.Router) {
+		if !tested[route] {
+			untested = append(untested, route)
+		}
+	}
+	sort.Strings(untested)
+	if len(untested) > 0 {
+		t.Errorf("routes without contract test: %v", untested)
+	}
+}
+
+// TestOpenAPIErrors checks the router errors are documented Error objects.
+func TestOpenAPIErrors(t *testing.T) {
+	spec := openAPI(t)
+	errorSchema := lookup(spec, "components", "schemas", "Error").(map[string]interface{})
+	tests := []struct {
+		method     string
+		target     string
+		wantStatus int
+		wantCode   string
+	}{
+		{http.MethodGet, "/unknown", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodDelete, "/chain", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+		{http.MethodGet, "/mine", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+	}
+	app := newTestApp(t, Config{})
+	for _, tt := range tests {
+		w := serve(app, tt.method, tt.target, "", nil)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s status %d, want %d", tt.method, tt.target, w.Code, tt.wantStatus)
+			continue
+		}
+		if err := checkResponse(spec, map[string]interface{}{"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": errorSchema},
+		}}, w); err != nil {
+			t.Errorf("%s %s: %v", tt.method, tt.target, err)
+		}
+		var response ErrorResponse
+		if json.Unmarshal(w.Body.Bytes(), &response); response.Error.Code != tt.wantCode {
+			t.Errorf("%s %s code %q, want %q", tt.method, tt.target, response.Error.Code, tt.wantCode)
+		}
+	}
+}
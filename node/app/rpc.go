@@ -0,0 +1,327 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// JSON-RPC 2.0 error codes, -32000 to -32099 are ours.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCNotFound       = -32000 // the block or transaction doesn't exist
+	RPCRejected       = -32001 // the node can't serve the request now (e.g. not in turn to seal)
+)
+
+// MaxRPCBatch is the number of requests in a batch.
+const MaxRPCBatch = 100
+
+// RPCRequest is a JSON-RPC 2.0 request, a request without id is a notification.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCResponse is a JSON-RPC 2.0 response, holding either a result or an error.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// RPCError is a JSON-RPC 2.0 error.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// rpcMethod runs a method with the request params, returning its result.
+type rpcMethod func(app *Application, params json.RawMessage) (interface{}, error)
+
+// rpcMethods are the methods served on /rpc.
+var rpcMethods = map[string]rpcMethod{
+	"chain_getBlock":  (*Application).rpcGetBlock,
+	"chain_getBlocks": (*Application).rpcGetBlocks,
+	"chain_getTip":    (*Application).rpcGetTip,
+	"tx_send":         (*Application).rpcSendTransaction,
+	"tx_get":          (*Application).rpcGetTransaction,
+	"mempool_list":    (*Application).rpcListMempool,
+	"peers_list":      (*Application).rpcListPeers,
+	"mining_start":    (*Application).rpcStartMining,
+}
+
+//Endpoint /rpc handler - serves JSON-RPC 2.0 requests, single or batched. The body is
+//limited to MaxBodySize by limitBody
+func (app *Application) HandleRPC(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, "Request body too large")
+		} else {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		}
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		if !json.Valid(body) {
+			app.writeRPC(w, rpcErrorResponse(nil, RPCParseError, "Parse error"))
+			return
+		}
+		request, ok := decodeRPCRequest(body)
+		if !ok {
+			app.writeRPC(w, rpcErrorResponse(nil, RPCInvalidRequest, "Invalid request"))
+			return
+		}
+		if response, ok := app.callRPC(request); ok {
+			app.writeRPC(w, response)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+	// batch
+	var requests []json.RawMessage
+	if err := json.Unmarshal(body, &requests); err != nil {
+		app.writeRPC(w, rpcErrorResponse(nil, RPCParseError, "Parse error"))
+		return
+	}
+	if len(requests) == 0 || len(requests) > MaxRPCBatch {
+		app.writeRPC(w, rpcErrorResponse(nil, RPCInvalidRequest, "Invalid batch size"))
+		return
+	}
+	responses := []RPCResponse{}
+	for _, raw := range requests {
+		request, ok := decodeRPCRequest(raw)
+		if !ok {
+			responses = append(responses, rpcErrorResponse(nil, RPCInvalidRequest, "Invalid request"))
+			continue
+		}
+		if response, ok := app.callRPC(request); ok {
+			responses = append(responses, response)
+		}
+	}
+	// a batch of notifications has no response
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	app.writeRPC(w, responses)
+}
+
+// decodeRPCRequest decodes a request, which must be a JSON object (`null` or `1` are
+// invalid requests, not notifications).
+func decodeRPCRequest(raw []byte) (RPCRequest, bool) {
+	var request RPCRequest
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] != '{' || json.Unmarshal(raw, &request) != nil {
+		return RPCRequest{}, false
+	}
+	return request, true
+}
+
+// callRPC runs the request method, it reports false for notifications which get no response.
+func (app *Application) callRPC(request RPCRequest) (RPCResponse, bool) {
+	notification := len(request.ID) == 0
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return rpcErrorResponse(request.ID, RPCInvalidRequest, "Invalid request"), !notification
+	}
+	method, ok := rpcMethods[request.Method]
+	if !ok {
+		return rpcErrorResponse(request.ID, RPCMethodNotFound, "Method not found"), !notification
+	}
+	result, err := method(app, request.Params)
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			log.Printf("RPC %s error: %v", request.Method, err)
+			rpcErr = &RPCError{Code: RPCInternalError, Message: "Internal error"}
+		}
+		return rpcErrorResponse(request.ID, rpcErr.Code, rpcErr.Message), !notification
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("RPC %s error: %v", request.Method, err)
+		return rpcErrorResponse(request.ID, RPCInternalError, "Internal error"), !notification
+	}
+	return RPCResponse{JSONRPC: "2.0", Result: resultJSON, ID: request.ID}, !notification
+}
+
+// rpcErrorResponse returns an error response, a nil id is sent as null.
+func rpcErrorResponse(id json.RawMessage, code int, message string) RPCResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: code, Message: message}, ID: id}
+}
+
+// writeRPC sends the response (or batch of responses) as json
+func (app *Application) writeRPC(w http.ResponseWriter, response interface{}) {
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		log.Println("Error marshaling rpc response:", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseJSON)
+}
+
+// decodeParams decodes params given by name (an object) into named, or by position
+// (an array) into the positional values. Missing params are left unset.
+func decodeParams(params json.RawMessage, named interface{}, positional ...interface{}) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || bytes.Equal(params, []byte("null")) {
+		return nil
+	}
+	if params[0] == '[' {
+		var values []json.RawMessage
+		if err := json.Unmarshal(params, &values); err != nil || len(values) > len(positional) {
+			return &RPCError{Code: RPCInvalidParams, Message: "Invalid params"}
+		}
+		for i, value := range values {
+			if err := json.Unmarshal(value, positional[i]); err != nil {
+				return &RPCError{Code: RPCInvalidParams, Message: "Invalid params: " + err.Error()}
+			}
+		}
+		return nil
+	}
+	if err := json.Unmarshal(params, named); err != nil {
+		return &RPCError{Code: RPCInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+// chain_getBlock {"height": n} or {"hash": h}, [height] or [hash] - gets a block of our chain
+func (app *Application) rpcGetBlock(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Height *int   `json:"height"`
+		Hash   string `json:"hash"`
+	}
+	var key interface{}
+	if err := decodeParams(params, &p, &key); err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case float64:
+		height := int(key)
+		p.Height = &height
+	case string:
+		p.Hash = key
+	}
+	var block blockchain.Block
+	var ok bool
+	switch {
+	case p.Hash != "":
+		block, ok = app.Blockchain.BlockByHash(p.Hash)
+	case p.Height != nil:
+		block, ok = app.Blockchain.BlockByHeight(*p.Height)
+	default:
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid params: height or hash required"}
+	}
+	if !ok {
+		return nil, &RPCError{Code: RPCNotFound, Message: "Block not found"}
+	}
+	return block, nil
+}
+
+// chain_getBlocks {"from": height, "limit": n} or [from, limit] - gets a range of blocks, as /blocks
+func (app *Application) rpcGetBlocks(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		From  int `json:"from"`
+		Limit int `json:"limit"`
+	}
+	if err := decodeParams(params, &p, &p.From, &p.Limit); err != nil {
+		return nil, err
+	}
+	if p.From < 0 || p.Limit < 0 {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid params: negative from or limit"}
+	}
+	return struct {
+		From   int                `json:"from"`
+		Total  int                `json:"total"`
+		Blocks []blockchain.Block `json:"blocks"`
+	}{
+		From:   p.From,
+		Total:  len(app.Blockchain.GetChain()),
+		Blocks: app.Blockchain.Blocks(p.From, p.Limit),
+	}, nil
+}
+
+// chain_getTip - gets the description of our last block, as /tip
+func (app *Application) rpcGetTip(params json.RawMessage) (interface{}, error) {
+	return app.Blockchain.Tip(), nil
+}
+
+// tx_send {transaction} or [transaction] - adds a new transaction, as /new_transaction
+func (app *Application) rpcSendTransaction(params json.RawMessage) (interface{}, error) {
+	var transaction blockchain.Transaction
+	if err := decodeParams(params, &transaction, &transaction); err != nil {
+		return nil, err
+	}
+	status, err := app.newTransaction(transaction)
+	if err != nil {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid transaction: " + err.Error()}
+	}
+	return status, nil
+}
+
+// tx_get {"id": id} or [id] - gets the status of a transaction, as /tx/{id}
+func (app *Application) rpcGetTransaction(params json.RawMessage) (interface{}, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := decodeParams(params, &p, &p.ID); err != nil {
+		return nil, err
+	}
+	if p.ID == "" {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Invalid params: id required"}
+	}
+	status, ok := app.Blockchain.TransactionStatus(p.ID)
+	if !ok {
+		return nil, &RPCError{Code: RPCNotFound, Message: "Transaction not found"}
+	}
+	return status, nil
+}
+
+// mempool_list - gets the pending transactions with their ids
+func (app *Application) rpcListMempool(params json.RawMessage) (interface{}, error) {
+	pending := []blockchain.TxStatus{}
+	for _, tx := range app.Blockchain.PendingTransactions() {
+		pending = append(pending, blockchain.TxStatus{ID: tx.ID(), Status: blockchain.TxStatusPending, Transaction: tx})
+	}
+	return pending, nil
+}
+
+// peers_list - gets our peers with their health, as /peers
+func (app *Application) rpcListPeers(params json.RawMessage) (interface{}, error) {
+	return app.Peers.PeerList(), nil
+}
+
+// mining_start - mines the pending transactions, as /mine
+func (app *Application) rpcStartMining(params json.RawMessage) (interface{}, error) {
+	result, err := app.mine()
+	if errors.Is(err, blockchain.ErrNotInTurn) {
+		return nil, &RPCError{Code: RPCRejected, Message: "Not in turn to seal block"}
+	}
+	return result, err
+}
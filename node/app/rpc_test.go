@@ -0,0 +1,138 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHandleRPC(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantBatch  bool
+		wantCodes  []int    // error codes of the responses, 0 for a result
+		wantIDs    []string // ids of the responses
+	}{
+		{name: "request", body: `{"jsonrpc":"2.0","method":"chain_getTip","id":1}`, wantStatus: http.StatusOK, wantCodes: []int{0}, wantIDs: []string{"1"}},
+		{name: "string id", body: `{"jsonrpc":"2.0","method":"chain_getBlock","params":[0],"id":"a"}`, wantStatus: http.StatusOK, wantCodes: []int{0}, wantIDs: []string{`"a"`}},
+		{name: "named params", body: `{"jsonrpc":"2.0","method":"chain_getBlocks","params":{"from":0,"limit":1},"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{0}, wantIDs: []string{"1"}},
+		{name: "notification", body: `{"jsonrpc":"2.0","method":"chain_getTip"}`, wantStatus: http.StatusNoContent},
+		{name: "parse error", body: `{"jsonrpc":`, wantStatus: http.StatusOK, wantCodes: []int{RPCParseError}, wantIDs: []string{"null"}},
+		{name: "empty body", body: ``, wantStatus: http.StatusOK, wantCodes: []int{RPCParseError}, wantIDs: []string{"null"}},
+		{name: "null", body: `null`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"null"}},
+		{name: "not an object", body: `1`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"null"}},
+		{name: "invalid field", body: `{"jsonrpc":"2.0","method":1,"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"null"}},
+		{name: "no version", body: `{"method":"chain_getTip","id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"1"}},
+		{name: "no method", body: `{"jsonrpc":"2.0","id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"1"}},
+		{name: "unknown method", body: `{"jsonrpc":"2.0","method":"chain_unknown","id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCMethodNotFound}, wantIDs: []string{"1"}},
+		{name: "unknown method notification", body: `{"jsonrpc":"2.0","method":"chain_unknown"}`, wantStatus: http.StatusNoContent},
+		{name: "invalid params", body: `{"jsonrpc":"2.0","method":"chain_getBlock","params":{"height":"x"},"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidParams}, wantIDs: []string{"1"}},
+		{name: "missing params", body: `{"jsonrpc":"2.0","method":"chain_getBlock","id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidParams}, wantIDs: []string{"1"}},
+		{name: "too many params", body: `{"jsonrpc":"2.0","method":"tx_get","params":["a","b"],"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidParams}, wantIDs: []string{"1"}},
+		{name: "negative params", body: `{"jsonrpc":"2.0","method":"chain_getBlocks","params":[-1],"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidParams}, wantIDs: []string{"1"}},
+		{name: "invalid transaction", body: `{"jsonrpc":"2.0","method":"tx_send","params":{"author":"alice"},"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidParams}, wantIDs: []string{"1"}},
+		{name: "block not found", body: `{"jsonrpc":"2.0","method":"chain_getBlock","params":[5],"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCNotFound}, wantIDs: []string{"1"}},
+		{name: "transaction not found", body: `{"jsonrpc":"2.0","method":"tx_get","params":{"id":"unknown"},"id":1}`, wantStatus: http.StatusOK, wantCodes: []int{RPCNotFound}, wantIDs: []string{"1"}},
+		{
+			name:       "batch",
+			body:       `[{"jsonrpc":"2.0","method":"chain_getTip","id":1},{"jsonrpc":"2.0","method":"chain_getTip"},null,{"jsonrpc":"2.0","method":"chain_unknown","id":2}]`,
+			wantStatus: http.StatusOK,
+			wantBatch:  true,
+			wantCodes:  []int{0, RPCInvalidRequest, RPCMethodNotFound},
+			wantIDs:    []string{"1", "null", "2"},
+		},
+		{name: "batch of notifications", body: `[{"jsonrpc":"2.0","method":"chain_getTip"},{"jsonrpc":"2.0","method":"peers_list"}]`, wantStatus: http.StatusNoContent},
+		{name: "empty batch", body: `[]`, wantStatus: http.StatusOK, wantCodes: []int{RPCInvalidRequest}, wantIDs: []string{"null"}},
+		{name: "batch parse error", body: `[{"jsonrpc":"2.0"`, wantStatus: http.StatusOK, wantCodes: []int{RPCParseError}, wantIDs: []string{"null"}},
+		{
+			name:       "batch too large",
+			body:       "[" + strings.TrimSuffix(strings.Repeat(`{"jsonrpc":"2.0","method":"chain_getTip","id":1},`, MaxRPCBatch+1), ",") + "]",
+			wantStatus: http.StatusOK,
+			wantCodes:  []int{RPCInvalidRequest},
+			wantIDs:    []string{"null"},
+		},
+		{name: "body too large", body: `{"jsonrpc":"2.0","method":"chain_getTip","id":"` + strings.Repeat("x", MaxBodySize) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	app := newTestApp(t, Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(app, http.MethodPost, "/rpc", tt.body, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var responses []RPCResponse
+			if tt.wantBatch {
+				if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+					t.Fatalf("batch response %s: %v", w.Body, err)
+				}
+			} else {
+				var response RPCResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatalf("response %s: %v", w.Body, err)
+				}
+				responses = append(responses, response)
+			}
+			if len(responses) != len(tt.wantCodes) {
+				t.Fatalf("%d responses, want %d: %s", len(responses), len(tt.wantCodes), w.Body)
+			}
+			for i, response := range responses {
+				code := 0
+				if response.Error != nil {
+					code = response.Error.Code
+				}
+				if code != tt.wantCodes[i] || string(response.ID) != tt.wantIDs[i] || response.JSONRPC != "2.0" {
+					t.Errorf("response %d %s, want code %d and id %s", i, w.Body, tt.wantCodes[i], tt.wantIDs[i])
+				}
+				if (code == 0) == (response.Result == nil) {
+					t.Errorf("response %d holds a result and an error, or neither", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRPCIdempotency(t *testing.T) {
+	send := func(content string) string {
+		return fmt.Sprintf(`{"jsonrpc":"2.0","method":"tx_send","params":{"author":"alice","content":%q},"id":1}`, content)
+	}
+	tests := []struct {
+		name         string
+		key          string
+		body         string
+		wantStatus   int
+		wantReplayed bool
+		wantPending  int
+	}{
+		{name: "first", key: "k1", body: send("hello"), wantStatus: http.StatusOK, wantPending: 1},
+		{name: "retry", key: "k1", body: send("hello"), wantStatus: http.StatusOK, wantReplayed: true, wantPending: 1},
+		{name: "other body", key: "k1", body: send("bye"), wantStatus: http.StatusUnprocessableEntity, wantPending: 1},
+		{name: "other key", key: "k2", body: send("hello again"), wantStatus: http.StatusOK, wantPending: 2},
+		{name: "mining", key: "k3", body: `{"jsonrpc":"2.0","method":"mining_start","id":1}`, wantStatus: http.StatusOK, wantPending: 0},
+		{name: "mining retry", key: "k3", body: `{"jsonrpc":"2.0","method":"mining_start","id":1}`, wantStatus: http.StatusOK, wantReplayed: true, wantPending: 0},
+	}
+	app := newTestApp(t, Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(app, http.MethodPost, "/rpc", tt.body, http.Header{IdempotencyHeader: {tt.key}})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if replayed := w.Header().Get(ReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed %v, want %v", replayed, tt.wantReplayed)
+			}
+			if pending := len(app.Blockchain.PendingTransactions()); pending != tt.wantPending {
+				t.Errorf("%d pending transactions, want %d", pending, tt.wantPending)
+			}
+		})
+	}
+	if height := app.Blockchain.GetLastBlock().Index; height != 1 {
+		t.Errorf("chain height %d, want 1 (mined once)", height)
+	}
+}
@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PeerAddress is the canonical address of a node: scheme://host:port.
+type PeerAddress struct {
+	Scheme string
+	Host   string
+	Port   int
+}
+
+// ParsePeerAddress validates and normalizes a node address. The scheme defaults
+// to http and the port to the scheme default port, paths and queries are not allowed.
+func ParsePeerAddress(raw string) (PeerAddress, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return PeerAddress{}, fmt.Errorf("empty node address")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return PeerAddress{}, fmt.Errorf("invalid node address %q: %v", raw, err)
+	}
+	address := PeerAddress{Scheme: strings.ToLower(parsed.Scheme), Host: strings.ToLower(parsed.Hostname())}
+	switch address.Scheme {
+	case "http":
+		address.Port = 80
+	case "https":
+		address.Port = 443
+	default:
+		return PeerAddress{}, fmt.Errorf("invalid node address %q: unsupported scheme", raw)
+	}
+	if address.Host == "" {
+		return PeerAddress{}, fmt.Errorf("invalid node address %q: missing host", raw)
+	}
+	if parsed.User != nil || strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return PeerAddress{}, fmt.Errorf("invalid node address %q: only scheme, host and port allowed", raw)
+	}
+	if port := parsed.Port(); port != "" {
+		address.Port, err = strconv.Atoi(port)
+		if err != nil || address.Port <= 0 || address.Port > 65535 {
+			return PeerAddress{}, fmt.Errorf("invalid node address %q: invalid port", raw)
+		}
+	}
+	return address, nil
+}
+
+// String returns the canonical form of the address.
+func (a PeerAddress) String() string {
+	return a.Scheme + "://" + net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// URL returns the url of path on the node.
+func (a PeerAddress) URL(path string) string {
+	return a.String() + path
+}
+
+// NormalizeAddress returns the canonical form of a node address.
+func NormalizeAddress(raw string) (string, error) {
+	address, err := ParsePeerAddress(raw)
+	if err != nil {
+		return "", err
+	}
+	return address.String(), nil
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "127.0.0.1:8000", want: "http://127.0.0.1:8000"},
+		{raw: " http://Node.Example:8000/ ", want: "http://node.example:8000"},
+		{raw: "HTTPS://node.example", want: "https://node.example:443"},
+		{raw: "node.example", want: "http://node.example:80"},
+		{raw: "[::1]:8000", want: "http://[::1]:8000"},
+		{raw: "", wantErr: true},
+		{raw: "ftp://node.example", wantErr: true},
+		{raw: "http://:8000", wantErr: true},
+		{raw: "http://node.example:0", wantErr: true},
+		{raw: "http://node.example:70000", wantErr: true},
+		{raw: "http://node.example:8000/api", wantErr: true},
+		{raw: "http://node.example:8000?x=1", wantErr: true},
+		{raw: "http://user@node.example:8000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeAddress(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeAddress(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeAddress(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestAddNodePeer(t *testing.T) {
+	known := NodePeer{NodeAddress: "http://127.0.0.1:8001", NodeID: "a", Score: 40, Failures: 2}
+	tests := []struct {
+		name      string
+		peer      NodePeer
+		wantErr   error
+		wantPeers int
+		wantID    string
+	}{
+		{name: "new peer", peer: NodePeer{NodeAddress: "127.0.0.1:8002"}, wantPeers: 2, wantID: "a"},
+		{name: "same address other form", peer: NodePeer{NodeAddress: "HTTP://127.0.0.1:8001/"}, wantPeers: 1, wantID: "a"},
+		{name: "handshake updates metadata", peer: NodePeer{NodeAddress: "127.0.0.1:8001", NodeID: "b", Version: 1}, wantPeers: 1, wantID: "b"},
+		{name: "self by id", peer: NodePeer{NodeAddress: "127.0.0.1:8002", NodeID: "self"}, wantErr: ErrSelfConnection, wantPeers: 1, wantID: "a"},
+		{name: "self by address", peer: NodePeer{NodeAddress: "localhost:8000"}, wantErr: ErrSelfConnection, wantPeers: 1, wantID: "a"},
+		{name: "invalid address", peer: NodePeer{NodeAddress: "ftp://x"}, wantErr: errors.New("invalid"), wantPeers: 1, wantID: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &PeerManager{NodeID: "self", AdvertiseAddr: "http://localhost:8000"}
+			pm.SetPeers([]NodePeer{known})
+			err := pm.AddNodePeer(&tt.peer)
+			if (err != nil) != (tt.wantErr != nil) || (tt.wantErr == ErrSelfConnection && !errors.Is(err, ErrSelfConnection)) {
+				t.Fatalf("AddNodePeer() error = %v, want %v", err, tt.wantErr)
+			}
+			peers := pm.PeerList()
+			if len(peers) != tt.wantPeers {
+				t.Fatalf("%d peers, want %d", len(peers), tt.wantPeers)
+			}
+			// health state is kept on updates
+			if peers[0].NodeID != tt.wantID || peers[0].Score != known.Score || peers[0].Failures != known.Failures {
+				t.Errorf("peer %+v", peers[0])
+			}
+		})
+	}
+}
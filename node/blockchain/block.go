@@ -12,6 +12,8 @@ type Block struct {
 	Timestamp    int64         `json:"timestamp"`
 	PreviousHash string        `json:"previous_hash"`
 	Nonce        int           `json:"nonce"`
+	Validator    string        `json:"validator,omitempty"`
+	Signature    string        `json:"signature,omitempty"`
 	Hash         string        `json:"hash"`
 }
 
@@ -20,8 +22,17 @@ type Transaction struct {
 	Author    string `json:"author"`
 	Content   string `json:"content"`
 	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type,omitempty"`
+	Amount    int64  `json:"amount,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
+// Transaction types, posts have no type.
+const (
+	TxTypePost  = ""
+	TxTypeStake = "stake"
+)
+
 //A function that return the hash of the block contents.
 func (bk *Block) ComputeHash() (string, error) {
 	bytes, err := json.Marshal(bk)
@@ -30,3 +41,39 @@ func (bk *Block) ComputeHash() (string, error) {
 	}
 	return fmt.Sprintf("%x", sha256.Sum256(bytes)), nil
 }
+
+// SigningHash returns the hash of the block contents without its hash and signature,
+// which is the message signed by validators.
+func (bk Block) SigningHash() (string, error) {
+	bk.Hash = ""
+	bk.Signature = ""
+	return bk.ComputeHash()
+}
+
+// SigningHash returns the hash of the transaction without its signature.
+func (tx Transaction) SigningHash() (string, error) {
+	tx.Signature = ""
+	bytes, err := json.Marshal(tx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(bytes)), nil
+}
+
+// Validate checks the transaction fields according to its type,
+// stake transactions must be signed by the author key.
+func (tx Transaction) Validate() error {
+	switch tx.Type {
+	case TxTypePost:
+		if tx.Author == "" || tx.Content == "" {
+			return fmt.Errorf("post requires author and content")
+		}
+		return nil
+	case TxTypeStake:
+		if tx.Amount <= 0 {
+			return fmt.Errorf("stake amount must be positive")
+		}
+		return VerifyTransactionSignature(tx)
+	}
+	return fmt.Errorf("unknown transaction type %q", tx.Type)
+}
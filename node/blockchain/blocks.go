@@ -0,0 +1,132 @@
+package blockchain
+
+// Chain query settings.
+const (
+	DefaultBlocksLimit = 20  // blocks returned by a range query without limit
+	MaxBlocksLimit     = 100 // most blocks returned by a range query
+)
+
+// Tip describes the last block of the chain.
+type Tip struct {
+	Height          int    `json:"height"`
+	Hash            string `json:"hash"`
+	Timestamp       int64  `json:"timestamp"`
+	FinalizedHeight int    `json:"finalized_height"`
+	FinalizedHash   string `json:"finalized_hash,omitempty"`
+	IsValid         bool   `json:"is_valid"`
+	Orphans         int    `json:"orphans"`
+}
+
+// chainCache holds the chain validity, block hash and transaction indexes, computed for
+// the chain ending with tipHash at height. They are extended when blocks are added to
+// that chain and recomputed when it is replaced.
+type chainCache struct {
+	height  int
+	tipHash string
+	valid   bool
+	heights map[string]int     // block hash -> height
+	txs     map[string]txRef   // transaction id -> location
+	authors map[string][]txRef // author -> posts, in chain order
+	byTime  []txRef            // posts by timestamp, then chain order
+	words   map[string][]txRef // word of the content -> posts, in chain order
+}
+
+// refreshCache brings the cache up to date with the chain (under lock), returning the
+// chain it was computed for.
+func (bc *Blockchain) refreshCache() []Block {
+	cache := &bc.cache
+	chain := bc.GetChain()
+	tip := len(chain) - 1
+	if cache.heights != nil && cache.height == tip && cache.tipHash == chain[tip].Hash {
+		return chain
+	}
+	// the cached chain is a prefix of ours: only check the new blocks
+	from := 1
+	if cache.heights != nil && cache.height < tip && chain[cache.height].Hash == cache.tipHash {
+		from = cache.height + 1
+	} else {
+		cache.valid = true
+		cache.heights = map[string]int{chain[0].Hash: 0}
+		cache.txs, cache.authors, cache.byTime = map[string]txRef{}, map[string][]txRef{}, nil
+		cache.words = map[string][]txRef{}
+		cache.indexTransactions(chain[0], 0)
+	}
+	for height := from; height <= tip; height++ {
+		block := chain[height]
+		if cache.valid && (block.Index != height || block.PreviousHash != chain[height-1].Hash || !bc.isValidProofAt(chain[:height], block, block.Hash)) {
+			cache.valid = false
+		}
+		cache.heights[block.Hash] = height
+		cache.indexTransactions(block, height)
+	}
+	cache.height, cache.tipHash = tip, chain[tip].Hash
+	return chain
+}
+
+// IsValid returns the validity of the chain, as CheckChainValidity, checking only
+// the blocks added since the last call.
+func (bc *Blockchain) IsValid() bool {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	bc.refreshCache()
+	return bc.cache.valid
+}
+
+// BlockByHash returns the block of our chain with the given hash.
+func (bc *Blockchain) BlockByHash(hash string) (Block, bool) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	chain := bc.refreshCache()
+	height, ok := bc.cache.heights[hash]
+	if !ok {
+		return Block{}, false
+	}
+	return chain[height], true
+}
+
+// BlockByHeight returns the block of our chain at height.
+func (bc *Blockchain) BlockByHeight(height int) (Block, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height < 0 || height >= len(bc.Chain) {
+		return Block{}, false
+	}
+	return bc.Chain[height], true
+}
+
+// Blocks returns up to limit blocks starting at height from, limit is
+// DefaultBlocksLimit when not positive and at most MaxBlocksLimit.
+func (bc *Blockchain) Blocks(from int, limit int) []Block {
+	if limit <= 0 {
+		limit = DefaultBlocksLimit
+	}
+	if limit > MaxBlocksLimit {
+		limit = MaxBlocksLimit
+	}
+	chain := bc.GetChain()
+	if from < 0 || from >= len(chain) {
+		return []Block{}
+	}
+	to := from + limit
+	if to > len(chain) {
+		to = len(chain)
+	}
+	return append([]Block{}, chain[from:to]...)
+}
+
+// Tip returns the description of our last block.
+func (bc *Blockchain) Tip() Tip {
+	bc.mu.RLock()
+	lastBlock := bc.Chain[len(bc.Chain)-1]
+	finalizedHeight, finalizedHash := bc.FinalizedHeight, bc.FinalizedHash
+	bc.mu.RUnlock()
+	return Tip{
+		Height:          lastBlock.Index,
+		Hash:            lastBlock.Hash,
+		Timestamp:       lastBlock.Timestamp,
+		FinalizedHeight: finalizedHeight,
+		FinalizedHash:   finalizedHash,
+		IsValid:         bc.IsValid(),
+		Orphans:         bc.orphans.Len(),
+	}
+}
@@ -0,0 +1,93 @@
+package blockchain
+
+import "testing"
+
+func TestBlocks(t *testing.T) {
+	bc := newPoWChain(t, 30)
+	tests := []struct {
+		name      string
+		from      int
+		limit     int
+		wantFirst int
+		wantLen   int
+	}{
+		{"default limit", 0, 0, 0, DefaultBlocksLimit},
+		{"limit", 5, 3, 5, 3},
+		{"end of chain", 28, 10, 28, 3},
+		{"last block", 30, 1, 30, 1},
+		{"past the end", 31, 5, 0, 0},
+		{"negative from", -1, 5, 0, 0},
+		{"negative limit", 0, -1, 0, DefaultBlocksLimit},
+		{"max limit", 0, MaxBlocksLimit + 1, 0, 31},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := bc.Blocks(tt.from, tt.limit)
+			if len(blocks) != tt.wantLen || (len(blocks) > 0 && blocks[0].Index != tt.wantFirst) {
+				t.Errorf("Blocks(%d, %d) has %d blocks, want %d from %d", tt.from, tt.limit, len(blocks), tt.wantLen, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestBlockLookup(t *testing.T) {
+	bc := newPoWChain(t, 3)
+	tests := []struct {
+		name   string
+		height int
+		hash   string
+		want   bool
+	}{
+		{"genesis", 0, bc.Chain[0].Hash, true},
+		{"tip", 3, bc.Chain[3].Hash, true},
+		{"past the tip", 4, "unknown", false},
+		{"negative", -1, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, ok := bc.BlockByHeight(tt.height)
+			if ok != tt.want || (ok && block.Hash != tt.hash) {
+				t.Errorf("BlockByHeight(%d) = %s, %v", tt.height, block.Hash, ok)
+			}
+			block, ok = bc.BlockByHash(tt.hash)
+			if ok != tt.want || (ok && block.Index != tt.height) {
+				t.Errorf("BlockByHash(%s) = %d, %v", tt.hash, block.Index, ok)
+			}
+		})
+	}
+}
+
+func TestTip(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    func(bc *Blockchain)
+		wantValid bool
+	}{
+		{"valid", func(bc *Blockchain) {}, true},
+		{"extended", func(bc *Blockchain) {
+			block := nextBlock(bc)
+			bc.ProofOfWork(&block)
+			bc.AddBlock(block)
+		}, true},
+		{"tampered", func(bc *Blockchain) {
+			bc.Chain[2].Transactions = []Transaction{{Author: "mallory", Content: "changed"}}
+			// a new tip makes the cache check the chain again
+			bc.Chain = append([]Block{}, bc.Chain[:3]...)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 3)
+			bc.IsValid()
+			tt.update(bc)
+			tip := bc.Tip()
+			last := bc.GetLastBlock()
+			if tip.Height != last.Index || tip.Hash != last.Hash || tip.IsValid != tt.wantValid {
+				t.Errorf("Tip() = %+v, want height %d valid %v", tip, last.Index, tt.wantValid)
+			}
+			if tip.IsValid != bc.CheckChainValidity() {
+				t.Errorf("cached validity %v, CheckChainValidity() %v", tip.IsValid, bc.CheckChainValidity())
+			}
+		})
+	}
+}
@@ -1,38 +1,83 @@
 package blockchain
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// NodePeer is a known node, with the metadata exchanged in its last handshake.
 type NodePeer struct {
-	NodeAddress string `json:"node_address"`
+	NodeAddress    string `json:"node_address"`
+	NodeID         string `json:"node_id,omitempty"`
+	Version        int    `json:"version,omitempty"`
+	NetworkID      string `json:"network_id,omitempty"`
+	GenesisHash    string `json:"genesis_hash,omitempty"`
+	BestHeight     int    `json:"best_height,omitempty"`
+	BestHash       string `json:"best_hash,omitempty"`
+	CumulativeWork uint64 `json:"cumulative_work,omitempty"`
+	LastSeen       int64  `json:"last_seen,omitempty"`
+	Failures       int    `json:"failures"`
+	LatencyMs      int64  `json:"latency_ms"`
+	Score          int    `json:"score"`
+	BannedUntil    int64  `json:"banned_until,omitempty"`
 }
 
 // Blockchain represents the blockchain and related operations.
 type Blockchain struct {
-	Difficulty              int           `json:"difficulty"`
-	UnconfirmedTransactions []Transaction `json:"unconfirmed_transactions"`
-	Chain                   []Block       `json:"chain"`
-	Peers                   []NodePeer    `json:"peers"`
+	NetworkID               string          `json:"network_id,omitempty"`
+	ConsensusType           string          `json:"consensus,omitempty"`
+	Difficulty              int             `json:"difficulty"`
+	UnconfirmedTransactions []Transaction   `json:"unconfirmed_transactions"`
+	Chain                   []Block         `json:"chain"`
+	Peers                   *PeerManager    `json:"-"`
+	Events                  *EventHub       `json:"-"` // nil if events are not published
+	FinalizedHeight         int             `json:"finalized_height"`
+	FinalizedHash           string          `json:"finalized_hash,omitempty"`
+	Engine                  Engine          `json:"-"`
+	Checkpoints             map[int]string  `json:"-"` // height -> block hash
+	MaxReorgDepth           int             `json:"-"` // 0 for unlimited
+	RejectedReorgs          []RejectedReorg `json:"-"`
+	mu                      sync.RWMutex    // guards the chain, pending transactions, finalized block and rejected reorgs
+	syncMu                  sync.Mutex      // one sync at a time
+	cache                   chainCache      // validity and hash index of the chain
+	orphans                 orphanPool      // blocks with unknown parent
+	cacheMu                 sync.Mutex
 }
 
+// ErrPreviousHash is returned when a block doesn't extend our last block.
+var ErrPreviousHash = errors.New("previous hash incorrect")
+
+// ErrBlockIndex is returned when a block index doesn't follow its parent index.
+var ErrBlockIndex = errors.New("block index incorrect")
+
 // NewBlockchain creates a new blockchain with a genesis block.
 func NewBlockchain() (*Blockchain, error) {
+	return NewBlockchainFromGenesis(nil)
+}
+
+// NewBlockchainFromGenesis creates a new blockchain with the genesis block of the given network config,
+// the default genesis block is used when genesis is nil.
+func NewBlockchainFromGenesis(genesis *Genesis) (*Blockchain, error) {
 	bc := &Blockchain{
-		Difficulty: 2,
+		Difficulty: DefaultDifficulty,
 		Chain:      []Block{},
+		Peers:      &PeerManager{},
+	}
+	if genesis != nil {
+		bc.NetworkID = genesis.NetworkID
+		bc.Difficulty = genesis.Difficulty
 	}
-	err := bc.CreateGenesisBlock()
+	genesisBlock, err := genesis.Block()
 	if err != nil {
 		return nil, err
 	}
+	bc.Chain = append(bc.Chain, genesisBlock)
 	return bc, nil
 }
 
@@ -45,7 +90,7 @@ func CreateChainFromFile(dump string) (*Blockchain, error) {
 	}
 	defer file.Close()
 
-	var blockchain Blockchain
+	blockchain := Blockchain{Peers: &PeerManager{}}
 	err = json.NewDecoder(file).Decode(&blockchain)
 	if err != nil {
 		return nil, err
@@ -53,12 +98,27 @@ func CreateChainFromFile(dump string) (*Blockchain, error) {
 	return &blockchain, nil
 }
 
-// createChainFromDump creates a new blockchain by loading the blockchain data from a dump.
-func CreateChainFromDump(chainDump []map[string]interface{}, nodeAddresses []string) (*Blockchain, error) {
-	generatedBlockchain, err := NewBlockchain()
-	if err != nil {
-		return nil, err
+// MarshalJSON encodes the blockchain under lock.
+func (bc *Blockchain) MarshalJSON() ([]byte, error) {
+	type blockchain Blockchain
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return json.Marshal((*blockchain)(bc))
+}
+
+// createChainFromDump creates a new blockchain by loading the blockchain data from a dump,
+// the dump must start with the genesis block of base and its blocks are verified with the base consensus.
+func CreateChainFromDump(chainDump []map[string]interface{}, nodeAddresses []string, base *Blockchain) (*Blockchain, error) {
+	if len(chainDump) == 0 || chainDump[0]["hash"] != base.GenesisHash() {
+		return nil, fmt.Errorf("genesis block mismatch")
+	}
+	generatedBlockchain := &Blockchain{
+		NetworkID:  base.NetworkID,
+		Difficulty: base.Difficulty,
+		Chain:      []Block{base.GetChain()[0]},
+		Peers:      &PeerManager{},
 	}
+	generatedBlockchain.SetEngine(base.Engine)
 
 	for idx, blockData := range chainDump {
 		if idx == 0 {
@@ -73,17 +133,18 @@ func CreateChainFromDump(chainDump []map[string]interface{}, nodeAddresses []str
 			Nonce:        int(blockData["nonce"].(float64)),
 			Hash:         blockData["hash"].(string),
 		}
+		// sealing fields are only present on signed (non-pow) blocks
+		block.Validator, _ = blockData["validator"].(string)
+		block.Signature, _ = blockData["signature"].(string)
 
 		err := generatedBlockchain.AddBlock(block)
 		if err != nil {
 			return nil, err
 		}
 	}
-	nodePeers := []NodePeer{}
 	for _, nodeAddress := range nodeAddresses {
-		nodePeers = append(nodePeers, NodePeer{NodeAddress: nodeAddress})
+		generatedBlockchain.Peers.AddNodePeer(&NodePeer{NodeAddress: nodeAddress})
 	}
-	generatedBlockchain.Peers = nodePeers
 	return generatedBlockchain, nil
 }
 
@@ -97,35 +158,55 @@ func ParseTransactions(transactionsData []interface{}) []Transaction {
 			Content:   transactionData.(map[string]interface{})["content"].(string),
 			Timestamp: int64(transactionData.(map[string]interface{})["timestamp"].(float64)),
 		}
+		// optional fields of non-post transactions
+		transaction.Type, _ = transactionData.(map[string]interface{})["type"].(string)
+		amount, _ := transactionData.(map[string]interface{})["amount"].(float64)
+		transaction.Amount = int64(amount)
+		transaction.Signature, _ = transactionData.(map[string]interface{})["signature"].(string)
 		transactions = append(transactions, transaction)
 	}
 
 	return transactions
 }
 
-// create genesis block
-func (bc *Blockchain) CreateGenesisBlock() error {
-	genesisBlock := Block{
-		Index:        0,
-		Transactions: []Transaction{},
-		Timestamp:    0,
-		PreviousHash: "0",
-		Nonce:        0,
+// SetEngine sets the consensus engine, recording its name as the chain consensus.
+func (bc *Blockchain) SetEngine(engine Engine) {
+	bc.Engine = engine
+	if engine != nil && engine.Name() != ConsensusPoW {
+		bc.ConsensusType = engine.Name()
 	}
-	computedHash, err := genesisBlock.ComputeHash()
-	if err != nil {
-		return err
+}
+
+// ConsensusEngine returns the engine used to seal and verify blocks, proof of work by default.
+func (bc *Blockchain) ConsensusEngine() Engine {
+	if bc.Engine == nil {
+		return &ProofOfWorkEngine{}
 	}
-	genesisBlock.Hash = computedHash
-	bc.Chain = append(bc.Chain, genesisBlock)
-	return nil
+	return bc.Engine
 }
 
 // get last block in the chain
 func (bc *Blockchain) GetLastBlock() Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	return bc.Chain[len(bc.Chain)-1]
 }
 
+// GetChain returns the blocks of the chain. Blocks are never modified once in the chain,
+// so the returned slice can be read while blocks are added or the chain is replaced.
+func (bc *Blockchain) GetChain() []Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.Chain[:len(bc.Chain):len(bc.Chain)]
+}
+
+// PendingTransactions returns a copy of the transactions waiting to be mined.
+func (bc *Blockchain) PendingTransactions() []Transaction {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]Transaction{}, bc.UnconfirmedTransactions...)
+}
+
 /**
 A function that adds the block to the chain after verification.
 Verification includes:
@@ -134,16 +215,41 @@ Verification includes:
 	in the chain match.
 */
 func (bc *Blockchain) AddBlock(block Block) error {
+	if err := bc.verifyBlock(block); err != nil {
+		return err
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.appendBlock(block)
+}
 
+// verifyBlock checks the block on top of our last block, without holding the lock
+// as the consensus engine may take a while.
+func (bc *Blockchain) verifyBlock(block Block) error {
+	chain := bc.GetChain()
 	//compare the previous hash
-	if bc.GetLastBlock().Hash != block.PreviousHash {
-		return fmt.Errorf("previous hash incorrect")
+	if chain[len(chain)-1].Hash != block.PreviousHash {
+		return ErrPreviousHash
+	}
+	if block.Index != chain[len(chain)-1].Index+1 {
+		return ErrBlockIndex
 	}
 	//
-	if !bc.IsValidProof(block, block.Hash) {
-		return fmt.Errorf("block proof invalid")
+	if err := bc.verifySealAt(chain, block); err != nil {
+		return fmt.Errorf("block proof invalid: %w", err)
+	}
+	return bc.checkCheckpoint(block)
+}
+
+// appendBlock adds a verified block to the chain (under lock), the chain may have
+// changed since the block was verified.
+func (bc *Blockchain) appendBlock(block Block) error {
+	if bc.Chain[len(bc.Chain)-1].Hash != block.PreviousHash {
+		return ErrPreviousHash
 	}
 	bc.Chain = append(bc.Chain, block)
+	bc.removeConfirmed([]Block{block})
+	bc.Events.Publish(Event{Type: EventBlock, Block: &block})
 	return nil
 }
 
@@ -153,30 +259,119 @@ by adding them to the block
 and figuring out Proof Of Work.
 */
 func (bc *Blockchain) MineBlock() (bool, error) {
-	if len(bc.UnconfirmedTransactions) == 0 {
+	// the block is sealed without holding the lock, transactions added meanwhile
+	// stay pending and the block is dropped if the chain changed
+	bc.mu.RLock()
+	pending := append([]Transaction{}, bc.UnconfirmedTransactions...)
+	chain := bc.Chain[:len(bc.Chain):len(bc.Chain)]
+	bc.mu.RUnlock()
+	if len(pending) == 0 {
 		return false, nil
 	}
 
-	lastBlock := bc.GetLastBlock()
+	lastBlock := chain[len(chain)-1]
 	index := lastBlock.Index + 1
 	timestamp := time.Now().Unix()
 	previousHash := lastBlock.Hash
 
-	newBlock := Block{index, bc.UnconfirmedTransactions, timestamp, previousHash, 0, ""}
+	newBlock := Block{
+		Index:        index,
+		Transactions: pending,
+		Timestamp:    timestamp,
+		PreviousHash: previousHash,
+	}
 
-	err := bc.ProofOfWork(&newBlock)
+	err := bc.ConsensusEngine().Seal(bc, chain, &newBlock)
+	if err != nil {
+		return false, err
+	}
+	// transactions left out by the engine (e.g. stakes over the balance) are never
+	// mined, they are dropped from the pending transactions
+	if len(newBlock.Transactions) < len(pending) {
+		included := map[string]bool{}
+		for _, tx := range newBlock.Transactions {
+			included[tx.ID()] = true
+		}
+		dropped := map[string]bool{}
+		for _, tx := range pending {
+			if !included[tx.ID()] {
+				dropped[tx.ID()] = true
+			}
+		}
+		bc.mu.Lock()
+		bc.removeTransactions(dropped)
+		bc.mu.Unlock()
+		if len(newBlock.Transactions) == 0 {
+			return false, nil
+		}
+	}
+	err = bc.AddBlock(newBlock)
 	if err != nil {
 		return false, err
 	}
-	bc.AddBlock(newBlock)
-	bc.UnconfirmedTransactions = []Transaction{}
 	return true, nil
 }
-func (bc *Blockchain) AddNodePeer(node *NodePeer) {
-	bc.Peers = append(bc.Peers, *node)
+
+// removeConfirmed drops the transactions of the blocks from the pending transactions (under lock).
+func (bc *Blockchain) removeConfirmed(blocks []Block) {
+	confirmed := map[string]bool{}
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			confirmed[tx.ID()] = true
+		}
+	}
+	bc.removeTransactions(confirmed)
+}
+
+// removeTransactions drops the transactions with the given ids from the pending
+// transactions (under lock).
+func (bc *Blockchain) removeTransactions(ids map[string]bool) {
+	pending := []Transaction{}
+	for _, tx := range bc.UnconfirmedTransactions {
+		if !ids[tx.ID()] {
+			pending = append(pending, tx)
+		}
+	}
+	bc.UnconfirmedTransactions = pending
 }
+
+// restorePending puts the transactions of reverted blocks back in front of the pending
+// transactions, skipping the ones already pending (under lock).
+func (bc *Blockchain) restorePending(blocks []Block) {
+	pending := map[string]bool{}
+	for _, tx := range bc.UnconfirmedTransactions {
+		pending[tx.ID()] = true
+	}
+	restored := []Transaction{}
+	for _, block := range blocks {
+		for _, tx := range block.Transactions {
+			if !pending[tx.ID()] {
+				pending[tx.ID()] = true
+				restored = append(restored, tx)
+			}
+		}
+	}
+	bc.UnconfirmedTransactions = append(restored, bc.UnconfirmedTransactions...)
+}
+
+// HasPendingTransaction reports if the transaction is already waiting to be mined.
+func (bc *Blockchain) HasPendingTransaction(transaction Transaction) bool {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	for _, pending := range bc.UnconfirmedTransactions {
+		if pending == transaction {
+			return true
+		}
+	}
+	return false
+}
+
 func (bc *Blockchain) AddNewTransaction(transaction *Transaction) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
 	bc.UnconfirmedTransactions = append(bc.UnconfirmedTransactions, *transaction)
+	tx := *transaction
+	bc.Events.Publish(Event{Type: EventTx, Transaction: &tx})
 }
 
 /**
@@ -204,89 +399,38 @@ func (bc *Blockchain) ProofOfWork(block *Block) error {
 	return nil
 }
 
-/**
-A function to announce to the network once a block has been mined.
-    Other blocks can simply verify the proof of work and add it to their
-    respective chains.
-*/
-func (bc *Blockchain) AnnounceNewBlock() {
-	for _, peer := range bc.Peers {
-		url := peer.NodeAddress + "/add_block"
-
-		blockData, err := json.Marshal(bc.GetLastBlock())
-		if err != nil {
-			// Handle error
-			continue
-		}
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(blockData))
-		if err != nil {
-			log.Printf("Failed to add block to node %s: %v", peer.NodeAddress, err)
-			continue
-		}
-		log.Printf("block added to node %s", peer.NodeAddress)
-		defer resp.Body.Close()
-	}
+// IsValidProof checks if the given block hash is a valid seal of the block on top of the current chain,
+// as defined by the consensus engine (e.g. satisfies the proof of work difficulty criteria).
+func (bc *Blockchain) IsValidProof(block Block, blockHash string) bool {
+	return bc.isValidProofAt(bc.GetChain(), block, blockHash)
 }
 
-// perform consensus - If a longer valid chain is
-//found, our chain is replaced with it.
-func (bc *Blockchain) Consensus() bool {
-	currentLen := int64(len(bc.Chain))
-	var (
-		longestChain  []map[string]interface{}
-		newBlockchain *Blockchain
-	)
-
-	for _, node := range bc.Peers {
-		response, err := http.Get(node.NodeAddress + "/chain")
-		if err != nil {
-			log.Printf("Failed to get chain from node %s: %v", node.NodeAddress, err)
-			continue
-		}
-		defer response.Body.Close()
-
-		var chainData struct {
-			Length int64                    `json:"length"`
-			Chain  []map[string]interface{} `json:"chain"`
-		}
-
-		err = json.NewDecoder(response.Body).Decode(&chainData)
-		if err != nil {
-			log.Printf("Failed to decode chain data from node %s: %v", node.NodeAddress, err)
-			continue
-		}
-		newBlockchain, err = CreateChainFromDump(chainData.Chain, []string{})
-		if err != nil {
-			log.Printf("Failed to create blockchain (%s) from dump: %v", node.NodeAddress, err)
-			continue
-		}
-		if chainData.Length > currentLen && newBlockchain.CheckChainValidity() {
-			currentLen = chainData.Length
-			longestChain = chainData.Chain
-		}
-	}
-
-	if longestChain != nil {
-		bc.Chain = newBlockchain.Chain
-		return true
+// isValidProofAt checks the block seal on top of the given parent blocks.
+func (bc *Blockchain) isValidProofAt(parents []Block, block Block, blockHash string) bool {
+	block.Hash = blockHash
+	err := bc.verifySealAt(parents, block)
+	if err != nil {
+		log.Printf("Invalid proof for block %d: %v", block.Index, err)
+		return false
 	}
-
-	return false
+	return true
 }
 
-// IsValidProof checks if the given block hash is a valid proof of work and satisfies the difficulty criteria.
-func (bc *Blockchain) IsValidProof(block Block, blockHash string) bool {
-	block.Hash = "" // Remove the hash field to recompute the hash
-	hash, _ := block.ComputeHash()
-	return strings.HasPrefix(blockHash, strings.Repeat("0", bc.Difficulty)) && blockHash == hash
+// verifySealAt returns the error of the block seal on top of the given parent blocks.
+func (bc *Blockchain) verifySealAt(parents []Block, block Block) error {
+	return bc.ConsensusEngine().VerifySeal(bc, parents, block)
 }
 
 // CheckChainValidity checks the validity of the blockchain by verifying each block and its hash.
 func (bc *Blockchain) CheckChainValidity() bool {
 	previousHash := "0"
 
-	for index, block := range bc.Chain {
-		if index != 0 && (!bc.IsValidProof(block, block.Hash) || previousHash != block.PreviousHash) {
+	chain := bc.GetChain()
+	for index, block := range chain {
+		if block.Index != index {
+			return false
+		}
+		if index != 0 && (!bc.isValidProofAt(chain[:index], block, block.Hash) || previousHash != block.PreviousHash) {
 			return false
 		}
 		previousHash = block.Hash
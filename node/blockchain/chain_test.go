@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMineBlock(t *testing.T) {
+	tests := []struct {
+		name       string
+		pending    int
+		wantMined  bool
+		wantHeight int
+	}{
+		{"no transaction", 0, false, 1},
+		{"transactions", 3, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			for i := 0; i < tt.pending; i++ {
+				bc.AddNewTransaction(&Transaction{Author: "alice", Content: fmt.Sprint(i), Timestamp: 1})
+			}
+			mined, err := bc.MineBlock()
+			if err != nil || mined != tt.wantMined {
+				t.Fatalf("MineBlock() = %v, %v, want %v", mined, err, tt.wantMined)
+			}
+			if last := bc.GetLastBlock(); last.Index != tt.wantHeight || len(last.Transactions) != tt.pending && tt.wantMined {
+				t.Errorf("last block %d with %d transactions, want %d", last.Index, len(last.Transactions), tt.wantHeight)
+			}
+			if pending := bc.PendingTransactions(); len(pending) != 0 {
+				t.Errorf("%d pending transactions after mining", len(pending))
+			}
+		})
+	}
+}
+
+func TestBlockIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		index     int
+		wantErr   error
+		wantValid bool
+	}{
+		{"next", 2, nil, true},
+		{"same as parent", 1, ErrBlockIndex, false},
+		{"skipped", 3, ErrBlockIndex, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			block := nextBlock(bc)
+			block.Index = tt.index
+			if err := bc.ProofOfWork(&block); err != nil {
+				t.Fatal(err)
+			}
+			if err := bc.AddBlock(block); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AddBlock() error = %v, want %v", err, tt.wantErr)
+			}
+			// a chain holding the block is only valid with the right index
+			bc.Chain = append(bc.Chain[:2:2], block)
+			if valid := bc.CheckChainValidity(); valid != tt.wantValid {
+				t.Errorf("CheckChainValidity() = %v, want %v", valid, tt.wantValid)
+			}
+			if valid := bc.IsValid(); valid != tt.wantValid {
+				t.Errorf("IsValid() = %v, want %v", valid, tt.wantValid)
+			}
+		})
+	}
+}
+
+// TestConcurrentAccess reads the chain while it is changed in the background, run with -race.
+func TestConcurrentAccess(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, bc *Blockchain, i int)
+	}{
+		{"mine", func(t *testing.T, bc *Blockchain, i int) {
+			bc.AddNewTransaction(&Transaction{Author: "alice", Content: fmt.Sprint(i), Timestamp: 1})
+			if _, err := bc.MineBlock(); err != nil {
+				t.Error(err)
+			}
+		}},
+		{"add block", func(t *testing.T, bc *Blockchain, i int) {
+			block := nextBlock(bc)
+			bc.ProofOfWork(&block)
+			bc.AddBlock(block)
+		}},
+		{"replace chain", func(t *testing.T, bc *Blockchain, i int) {
+			bc.ReplaceChain(forkChain(t, bc, 1, 2+i%2))
+			bc.ReplaceChainIfAllowed(forkChain(t, bc, 1, 3))
+		}},
+		{"reorgs and finality", func(t *testing.T, bc *Blockchain, i int) {
+			bc.RecordRejectedReorg("peer", nil, fmt.Errorf("rejected"))
+			bc.setFinalized(i, fmt.Sprint(i))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 2)
+			bc.Events = NewEventHub()
+			const writes = 20
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < writes; i++ {
+					tt.write(t, bc, i)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for i := 0; i < writes; i++ {
+					bc.Tip()
+					bc.Blocks(0, MaxBlocksLimit)
+					bc.Headers(0)
+					bc.HasBlock(bc.GenesisHash())
+					bc.TransactionStatus("unknown")
+					bc.PendingTransactions()
+					bc.PostsByAuthor("alice", 0, 0)
+					bc.CanReorganizeTo(bc.GetChain())
+					bc.RejectedReorgList()
+					bc.CheckChainValidity()
+					if _, err := json.Marshal(bc); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+			wg.Wait()
+			if !bc.CheckChainValidity() {
+				t.Error("chain invalid after concurrent access")
+			}
+		})
+	}
+}
+
+// TestMineConcurrentTransactions checks that transactions added while a block is sealed are not lost.
+func TestMineConcurrentTransactions(t *testing.T) {
+	bc := newPoWChain(t, 0)
+	const txs = 50
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < txs; i++ {
+			bc.AddNewTransaction(&Transaction{Author: "alice", Content: fmt.Sprint(i), Timestamp: 1})
+		}
+		close(done)
+	}()
+	for mining := true; mining; {
+		select {
+		case <-done:
+			mining = false
+		default:
+		}
+		if _, err := bc.MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := len(bc.PendingTransactions())
+	for _, block := range bc.GetChain()[1:] {
+		count += len(block.Transactions)
+	}
+	if count != txs {
+		t.Errorf("%d transactions in the chain and pending, want %d", count, txs)
+	}
+}
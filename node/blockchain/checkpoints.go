@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// DefaultMaxReorgDepth is the number of blocks Consensus may revert when no limit is configured.
+const DefaultMaxReorgDepth = 100
+
+// maxRejectedReorgs bounds the number of rejected reorganizations kept in memory.
+const maxRejectedReorgs = 100
+
+// DefaultCheckpoints are the hard-coded block hashes (by height) every chain of the network must contain.
+var DefaultCheckpoints = map[int]string{
+	0: "070d497a294c71c77b08d8bfa70b4c4f0b457f97efefb47520cdfcb7bfed1301",
+}
+
+// ReorgError describes why replacing our chain with another one was refused.
+type ReorgError struct {
+	ForkHeight int    `json:"fork_height"`
+	Depth      int    `json:"depth"`
+	Reason     string `json:"reason"`
+}
+
+func (e *ReorgError) Error() string {
+	return fmt.Sprintf("reorg from height %d (depth %d) rejected: %s", e.ForkHeight, e.Depth, e.Reason)
+}
+
+// RejectedReorg is a logged reorganization refused by Consensus.
+type RejectedReorg struct {
+	Peer      string `json:"peer"`
+	Time      int64  `json:"time"`
+	NewLength int    `json:"new_length"`
+	ReorgError
+}
+
+// ForkHeight returns the height of the first block that differs between our chain and the given chain.
+func (bc *Blockchain) ForkHeight(chain []Block) int {
+	return forkHeight(bc.GetChain(), chain)
+}
+
+// forkHeight returns the height of the first block that differs between the chains.
+func forkHeight(ours []Block, chain []Block) int {
+	height := 0
+	for height < len(ours) && height < len(chain) && ours[height].Hash == chain[height].Hash {
+		height++
+	}
+	return height
+}
+
+// CanReorganizeTo checks that our chain can be replaced by the given chain:
+// it must contain the checkpoints and the finalized block, and not revert
+// more than MaxReorgDepth blocks.
+func (bc *Blockchain) CanReorganizeTo(chain []Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.canReorganizeTo(chain)
+}
+
+// ReplaceChainIfAllowed replaces our chain with chain when CanReorganizeTo allows it,
+// checking against our current chain under the same lock as the replacement, so
+// blocks added or finalized meanwhile are never reverted.
+func (bc *Blockchain) ReplaceChainIfAllowed(chain []Block) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if err := bc.canReorganizeTo(chain); err != nil {
+		return err
+	}
+	bc.replaceChain(chain)
+	return nil
+}
+
+// canReorganizeTo is CanReorganizeTo with bc.mu held.
+func (bc *Blockchain) canReorganizeTo(chain []Block) error {
+	fork := forkHeight(bc.Chain, chain)
+	reorgErr := &ReorgError{ForkHeight: fork, Depth: len(bc.Chain) - fork}
+
+	for height, hash := range bc.Checkpoints {
+		if height < len(chain) && chain[height].Hash != hash {
+			reorgErr.Reason = fmt.Sprintf("chain conflicts with checkpoint %d", height)
+			return reorgErr
+		}
+	}
+	if bc.FinalizedHeight > 0 && (len(chain) <= bc.FinalizedHeight || chain[bc.FinalizedHeight].Hash != bc.FinalizedHash) {
+		reorgErr.Reason = fmt.Sprintf("chain conflicts with finalized block %d", bc.FinalizedHeight)
+		return reorgErr
+	}
+	if bc.MaxReorgDepth > 0 && reorgErr.Depth > bc.MaxReorgDepth {
+		reorgErr.Reason = fmt.Sprintf("exceeds max reorg depth %d", bc.MaxReorgDepth)
+		return reorgErr
+	}
+	return nil
+}
+
+// RejectedReorgList returns a copy of the rejected reorganizations, oldest first.
+func (bc *Blockchain) RejectedReorgList() []RejectedReorg {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]RejectedReorg{}, bc.RejectedReorgs...)
+}
+
+// checkCheckpoint verifies a new block against the checkpoint at its height.
+func (bc *Blockchain) checkCheckpoint(block Block) error {
+	if hash, ok := bc.Checkpoints[block.Index]; ok && hash != block.Hash {
+		return fmt.Errorf("block %d conflicts with checkpoint", block.Index)
+	}
+	return nil
+}
+
+// RecordRejectedReorg logs a reorganization refused for the chain received from peer.
+func (bc *Blockchain) RecordRejectedReorg(peer string, chain []Block, err error) {
+	log.Printf("Rejected chain from node %s: %v", peer, err)
+	rejected := RejectedReorg{
+		Peer:      peer,
+		Time:      time.Now().Unix(),
+		NewLength: len(chain),
+	}
+	if reorgErr, ok := err.(*ReorgError); ok {
+		rejected.ReorgError = *reorgErr
+	} else {
+		rejected.Reason = err.Error()
+	}
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.RejectedReorgs = append(bc.RejectedReorgs, rejected)
+	if len(bc.RejectedReorgs) > maxRejectedReorgs {
+		bc.RejectedReorgs = bc.RejectedReorgs[len(bc.RejectedReorgs)-maxRejectedReorgs:]
+	}
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// forkChain returns the blocks of bc up to height from, extended with length other blocks.
+func forkChain(t *testing.T, bc *Blockchain, from int, length int) []Block {
+	t.Helper()
+	fork := &Blockchain{Difficulty: bc.Difficulty, Chain: append([]Block{}, bc.Chain[:from]...)}
+	for i := 0; i < length; i++ {
+		block := nextBlock(fork)
+		block.Transactions = []Transaction{{Author: "mallory", Content: fmt.Sprint(i), Timestamp: 2}}
+		if err := fork.ProofOfWork(&block); err != nil {
+			t.Fatal(err)
+		}
+		if err := fork.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fork.Chain
+}
+
+func TestCanReorganizeTo(t *testing.T) {
+	tests := []struct {
+		name       string
+		forkFrom   int // first height of the other chain
+		forkLength int
+		maxDepth   int
+		checkpoint int // height of a checkpoint on our chain, 0 for none
+		finalized  int
+		wantErr    bool
+		wantForkAt int
+		wantDepth  int
+	}{
+		{name: "extension", forkFrom: 6, forkLength: 2, maxDepth: 3, wantForkAt: 6},
+		{name: "shallow reorg", forkFrom: 4, forkLength: 4, maxDepth: 3, wantForkAt: 4, wantDepth: 2},
+		{name: "max depth", forkFrom: 3, forkLength: 5, maxDepth: 3, wantForkAt: 3, wantDepth: 3},
+		{name: "too deep", forkFrom: 2, forkLength: 6, maxDepth: 3, wantErr: true, wantForkAt: 2, wantDepth: 4},
+		{name: "unlimited depth", forkFrom: 1, forkLength: 7, wantForkAt: 1, wantDepth: 5},
+		{name: "checkpoint kept", forkFrom: 4, forkLength: 4, checkpoint: 3, wantForkAt: 4, wantDepth: 2},
+		{name: "checkpoint reverted", forkFrom: 2, forkLength: 6, checkpoint: 3, wantErr: true, wantForkAt: 2, wantDepth: 4},
+		{name: "finalized kept", forkFrom: 4, forkLength: 4, finalized: 3, wantForkAt: 4, wantDepth: 2},
+		{name: "finalized reverted", forkFrom: 3, forkLength: 5, finalized: 3, wantErr: true, wantForkAt: 3, wantDepth: 3},
+		{name: "shorter than finalized", forkFrom: 6, forkLength: 0, finalized: 6, wantErr: true, wantForkAt: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 5)
+			bc.MaxReorgDepth = tt.maxDepth
+			bc.Checkpoints = map[int]string{0: bc.GenesisHash()}
+			if tt.checkpoint > 0 {
+				bc.Checkpoints[tt.checkpoint] = bc.Chain[tt.checkpoint].Hash
+			}
+			if tt.finalized > 0 && tt.finalized < len(bc.Chain) {
+				bc.FinalizedHeight, bc.FinalizedHash = tt.finalized, bc.Chain[tt.finalized].Hash
+			} else if tt.finalized > 0 {
+				bc.FinalizedHeight, bc.FinalizedHash = tt.finalized, "future"
+			}
+			chain := forkChain(t, bc, tt.forkFrom, tt.forkLength)
+			err := bc.CanReorganizeTo(chain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CanReorganizeTo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var reorgErr *ReorgError
+			if errors.As(err, &reorgErr) && (reorgErr.ForkHeight != tt.wantForkAt || reorgErr.Depth != tt.wantDepth) {
+				t.Errorf("fork at %d depth %d, want %d %d", reorgErr.ForkHeight, reorgErr.Depth, tt.wantForkAt, tt.wantDepth)
+			}
+			if err == nil && bc.ForkHeight(chain) != tt.wantForkAt {
+				t.Errorf("ForkHeight() = %d, want %d", bc.ForkHeight(chain), tt.wantForkAt)
+			}
+		})
+	}
+}
+
+func TestReplaceChainIfAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		meanwhile func(t *testing.T, bc *Blockchain) // changes our chain after the candidate was checked
+		wantErr   bool
+	}{
+		{name: "unchanged", meanwhile: func(t *testing.T, bc *Blockchain) {}},
+		{name: "finalized meanwhile", meanwhile: func(t *testing.T, bc *Blockchain) {
+			bc.setFinalized(4, bc.Chain[4].Hash)
+		}, wantErr: true},
+		{name: "grown past max depth meanwhile", meanwhile: func(t *testing.T, bc *Blockchain) {
+			bc.ReplaceChain(forkChain(t, bc, len(bc.Chain), 2))
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 5)
+			bc.MaxReorgDepth = 3
+			chain := forkChain(t, bc, 4, 4)
+			if err := bc.CanReorganizeTo(chain); err != nil {
+				t.Fatalf("CanReorganizeTo() error = %v", err)
+			}
+			tt.meanwhile(t, bc)
+			before := bc.GetLastBlock()
+			err := bc.ReplaceChainIfAllowed(chain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReplaceChainIfAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			wantTip := chain[len(chain)-1].Hash
+			if tt.wantErr {
+				wantTip = before.Hash
+			}
+			if tip := bc.GetLastBlock().Hash; tip != wantTip {
+				t.Errorf("tip %s, want %s", tip, wantTip)
+			}
+		})
+	}
+}
+
+func TestAddBlockCheckpoint(t *testing.T) {
+	bc := newPoWChain(t, 1)
+	other := forkChain(t, bc, 2, 1)[2]
+	tests := []struct {
+		name       string
+		checkpoint string
+		wantErr    bool
+	}{
+		{"no checkpoint", "", false},
+		{"matching checkpoint", other.Hash, false},
+		{"conflicting checkpoint", "0000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			bc.Checkpoints = map[int]string{}
+			if tt.checkpoint != "" {
+				bc.Checkpoints[2] = tt.checkpoint
+			}
+			err := bc.AddBlock(other)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AddBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRecordRejectedReorg(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		records    int
+		wantLen    int
+		wantReason string
+	}{
+		{"reorg error", &ReorgError{ForkHeight: 1, Depth: 4, Reason: "too deep"}, 1, 1, "too deep"},
+		{"other error", errors.New("invalid chain"), 1, 1, "invalid chain"},
+		{"bounded", errors.New("invalid chain"), maxRejectedReorgs + 5, maxRejectedReorgs, "invalid chain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 0)
+			for i := 0; i < tt.records; i++ {
+				bc.RecordRejectedReorg("http://peer", bc.Chain, tt.err)
+			}
+			if len(bc.RejectedReorgs) != tt.wantLen {
+				t.Fatalf("%d rejected reorgs, want %d", len(bc.RejectedReorgs), tt.wantLen)
+			}
+			last := bc.RejectedReorgs[len(bc.RejectedReorgs)-1]
+			if last.Reason != tt.wantReason || last.Peer != "http://peer" || last.NewLength != 1 {
+				t.Errorf("rejected reorg %+v", last)
+			}
+		})
+	}
+}
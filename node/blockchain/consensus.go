@@ -0,0 +1,237 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ConsensusPoW = "pow"
+	ConsensusPoA = "poa"
+	ConsensusPoS = "pos"
+)
+
+// ErrNotInTurn is returned when the local node is not allowed to seal the next block.
+var ErrNotInTurn = errors.New("not in turn to seal block")
+
+// ErrForgedSeal is returned for a block whose hash doesn't match its content or
+// difficulty, or whose signature is invalid. Unlike other invalid blocks, which an
+// honest node may send (clock skew, a ledger or checkpoint we don't share), only a
+// misbehaving node sends one.
+var ErrForgedSeal = errors.New("forged block seal")
+
+// Engine is a pluggable consensus algorithm used to seal new blocks
+// and to verify blocks received from other nodes.
+type Engine interface {
+	// Name returns the consensus identifier (pow, poa, ...).
+	Name() string
+	// Seal completes the block (nonce, signature, hash) on top of parents.
+	Seal(bc *Blockchain, parents []Block, block *Block) error
+	// VerifySeal checks that the block was sealed correctly on top of parents.
+	VerifySeal(bc *Blockchain, parents []Block, block Block) error
+}
+
+// ProofOfWorkEngine is the default engine, sealing blocks by finding a nonce
+// whose hash satisfies the chain difficulty.
+type ProofOfWorkEngine struct{}
+
+func (e *ProofOfWorkEngine) Name() string {
+	return ConsensusPoW
+}
+
+func (e *ProofOfWorkEngine) Seal(bc *Blockchain, parents []Block, block *Block) error {
+	return bc.ProofOfWork(block)
+}
+
+func (e *ProofOfWorkEngine) VerifySeal(bc *Blockchain, parents []Block, block Block) error {
+	blockHash := block.Hash
+	block.Hash = "" // Remove the hash field to recompute the hash
+	hash, err := block.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if blockHash != hash {
+		return fmt.Errorf("%w: block hash mismatch", ErrForgedSeal)
+	}
+	if !strings.HasPrefix(blockHash, strings.Repeat("0", bc.Difficulty)) {
+		return fmt.Errorf("%w: block hash does not satisfy difficulty", ErrForgedSeal)
+	}
+	return nil
+}
+
+// ProofOfAuthorityEngine seals blocks by signature of a configured set
+// of validators, taking turns in round-robin order by block height.
+type ProofOfAuthorityEngine struct {
+	Validators []ed25519.PublicKey
+	key        ed25519.PrivateKey
+}
+
+// NewProofOfAuthorityEngine creates a PoA engine from hex encoded validator public keys
+// and an optional hex encoded private key (seed) used to seal blocks on this node.
+func NewProofOfAuthorityEngine(validators []string, privateKey string) (*ProofOfAuthorityEngine, error) {
+	if len(validators) == 0 {
+		return nil, fmt.Errorf("poa: empty validator set")
+	}
+	engine := &ProofOfAuthorityEngine{}
+	for _, validator := range validators {
+		publicKey, err := ParsePublicKey(validator)
+		if err != nil {
+			return nil, err
+		}
+		engine.Validators = append(engine.Validators, publicKey)
+	}
+	if privateKey != "" {
+		key, err := ParsePrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		engine.key = key
+	}
+	return engine, nil
+}
+
+func (e *ProofOfAuthorityEngine) Name() string {
+	return ConsensusPoA
+}
+
+// InTurn returns the validator expected to seal the block at the given height.
+func (e *ProofOfAuthorityEngine) InTurn(height int) ed25519.PublicKey {
+	return e.Validators[height%len(e.Validators)]
+}
+
+func (e *ProofOfAuthorityEngine) Seal(bc *Blockchain, parents []Block, block *Block) error {
+	if e.key == nil {
+		return fmt.Errorf("poa: node has no validator key")
+	}
+	// the turn follows the height of the parents, not the index the block claims
+	if !e.InTurn(len(parents)).Equal(e.key.Public()) {
+		return ErrNotInTurn
+	}
+	return SignBlock(block, e.key)
+}
+
+func (e *ProofOfAuthorityEngine) VerifySeal(bc *Blockchain, parents []Block, block Block) error {
+	if block.Index != len(parents) {
+		return fmt.Errorf("poa: block index %d, want %d", block.Index, len(parents))
+	}
+	if block.Validator != hex.EncodeToString(e.InTurn(len(parents))) {
+		return fmt.Errorf("poa: block %d sealed by validator out of turn", block.Index)
+	}
+	return VerifyBlockSignature(block)
+}
+
+// SignBlock sets the validator and signature of the block and computes its hash.
+func SignBlock(block *Block, key ed25519.PrivateKey) error {
+	block.Validator = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	hash, err := block.SigningHash()
+	if err != nil {
+		return err
+	}
+	block.Signature = hex.EncodeToString(ed25519.Sign(key, []byte(hash)))
+	block.Hash = hash
+	return nil
+}
+
+// VerifyBlockSignature checks the block hash and that it was signed by block.Validator.
+func VerifyBlockSignature(block Block) error {
+	hash, err := block.SigningHash()
+	if err != nil {
+		return err
+	}
+	if block.Hash != hash {
+		return fmt.Errorf("%w: block hash mismatch", ErrForgedSeal)
+	}
+	publicKey, err := ParsePublicKey(block.Validator)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForgedSeal, err)
+	}
+	signature, err := hex.DecodeString(block.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid block signature: %v", ErrForgedSeal, err)
+	}
+	if !ed25519.Verify(publicKey, []byte(hash), signature) {
+		return fmt.Errorf("%w: block signature invalid", ErrForgedSeal)
+	}
+	return nil
+}
+
+// SignTransaction sets the author (public key) and signature of the transaction.
+func SignTransaction(tx *Transaction, key ed25519.PrivateKey) error {
+	tx.Author = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return err
+	}
+	tx.Signature = hex.EncodeToString(ed25519.Sign(key, []byte(hash)))
+	return nil
+}
+
+// VerifyTransactionSignature checks that the transaction was signed by its author key.
+func VerifyTransactionSignature(tx Transaction) error {
+	publicKey, err := ParsePublicKey(tx.Author)
+	if err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(tx.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid transaction signature: %v", err)
+	}
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(hash), signature) {
+		return fmt.Errorf("transaction signature invalid")
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a hex encoded ed25519 public key.
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	bytes, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(bytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key %q", value)
+	}
+	return ed25519.PublicKey(bytes), nil
+}
+
+// ParsePrivateKey decodes a hex encoded ed25519 seed (or full private key).
+func ParsePrivateKey(value string) (ed25519.PrivateKey, error) {
+	bytes, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	switch len(bytes) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(bytes), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(bytes), nil
+	}
+	return nil, fmt.Errorf("invalid private key")
+}
+
+// EngineConfig holds the options used to create a consensus engine.
+type EngineConfig struct {
+	Name         string           // consensus engine name (pow, poa, pos)
+	Validators   []string         // hex encoded validator public keys (poa)
+	PrivateKey   string           // hex encoded private key used by this node to seal blocks
+	Allocations  map[string]int64 // initial account balances (pos)
+	Stakes       map[string]int64 // initial locked stakes (pos)
+	SlotDuration int64            // slot length in seconds (pos)
+}
+
+// NewEngine creates a consensus engine from config, defaulting to proof of work.
+func NewEngine(config EngineConfig) (Engine, error) {
+	switch config.Name {
+	case "", ConsensusPoW:
+		return &ProofOfWorkEngine{}, nil
+	case ConsensusPoA:
+		return NewProofOfAuthorityEngine(config.Validators, config.PrivateKey)
+	case ConsensusPoS:
+		return NewProofOfStakeEngine(config.Allocations, config.Stakes, config.SlotDuration, config.PrivateKey)
+	}
+	return nil, fmt.Errorf("unknown consensus engine %q", config.Name)
+}
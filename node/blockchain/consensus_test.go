@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns the validator key made from a one byte seed.
+func testKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed([]byte(strings.Repeat(string([]byte{seed}), ed25519.SeedSize)))
+}
+
+func testPublicKey(key ed25519.PrivateKey) string {
+	return hex.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// nextBlock returns an unsealed block with one post on top of the chain.
+func nextBlock(bc *Blockchain) Block {
+	last := bc.GetLastBlock()
+	return Block{
+		Index:        last.Index + 1,
+		Transactions: []Transaction{{Author: "alice", Content: "hello", Timestamp: 1}},
+		Timestamp:    last.Timestamp + 1,
+		PreviousHash: last.Hash,
+	}
+}
+
+func TestProofOfWorkEngine(t *testing.T) {
+	bc, err := NewBlockchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Difficulty = 1
+	engine := &ProofOfWorkEngine{}
+
+	tests := []struct {
+		name    string
+		tamper  func(block *Block)
+		wantErr bool
+	}{
+		{"sealed", func(block *Block) {}, false},
+		{"hash mismatch", func(block *Block) { block.Timestamp++ }, true},
+		{"difficulty not met", func(block *Block) {
+			for {
+				block.Nonce++
+				block.Hash, _ = block.ComputeHash()
+				if !strings.HasPrefix(block.Hash, "0") {
+					return
+				}
+			}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := nextBlock(bc)
+			if err := engine.Seal(bc, bc.Chain, &block); err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			tt.tamper(&block)
+			err := engine.VerifySeal(bc, bc.Chain, block)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySeal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProofOfAuthorityEngine(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	validators := []string{testPublicKey(alice), testPublicKey(bob)}
+
+	tests := []struct {
+		name       string
+		key        ed25519.PrivateKey // sealing key, nil for none
+		index      int
+		tamper     func(block *Block)
+		wantSeal   error
+		wantVerify bool
+	}{
+		{name: "in turn", key: bob, index: 1, wantVerify: true},
+		{name: "in turn after round", key: alice, index: 2, wantVerify: true},
+		{name: "out of turn", key: alice, index: 1, wantSeal: ErrNotInTurn},
+		{name: "no key", index: 1, wantSeal: errors.New("poa: node has no validator key")},
+		{name: "tampered content", key: bob, index: 1, tamper: func(block *Block) {
+			block.Transactions[0].Content = "changed"
+		}},
+		{name: "forged signature", key: bob, index: 1, tamper: func(block *Block) {
+			other := *block
+			SignBlock(&other, alice)
+			block.Signature = other.Signature
+		}},
+		{name: "forged index", key: bob, index: 1, tamper: func(block *Block) {
+			// alice claims the next height to seal in bob's turn
+			block.Index = 2
+			SignBlock(block, alice)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seed string
+			if tt.key != nil {
+				seed = hex.EncodeToString(tt.key.Seed())
+			}
+			engine, err := NewProofOfAuthorityEngine(validators, seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bc := &Blockchain{}
+			parents := make([]Block, tt.index)
+			block := Block{Index: tt.index, Transactions: []Transaction{{Author: "alice", Content: "hello"}}}
+			err = engine.Seal(bc, parents, &block)
+			if tt.wantSeal != nil {
+				if err == nil || err.Error() != tt.wantSeal.Error() {
+					t.Fatalf("Seal() error = %v, want %v", err, tt.wantSeal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(&block)
+			}
+			err = engine.VerifySeal(bc, parents, block)
+			if (err == nil) != tt.wantVerify {
+				t.Errorf("VerifySeal() error = %v, want valid %v", err, tt.wantVerify)
+			}
+		})
+	}
+}
+
+func TestNewEngine(t *testing.T) {
+	validator := testPublicKey(testKey(1))
+	tests := []struct {
+		config   EngineConfig
+		wantName string
+		wantErr  bool
+	}{
+		{EngineConfig{}, ConsensusPoW, false},
+		{EngineConfig{Name: ConsensusPoW}, ConsensusPoW, false},
+		{EngineConfig{Name: ConsensusPoA, Validators: []string{validator}}, ConsensusPoA, false},
+		{EngineConfig{Name: ConsensusPoA}, "", true},
+		{EngineConfig{Name: ConsensusPoA, Validators: []string{"zz"}}, "", true},
+		{EngineConfig{Name: ConsensusPoA, Validators: []string{validator}, PrivateKey: "12"}, "", true},
+		{EngineConfig{Name: "bft"}, "", true},
+	}
+	for _, tt := range tests {
+		engine, err := NewEngine(tt.config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewEngine(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			continue
+		}
+		if err == nil && engine.Name() != tt.wantName {
+			t.Errorf("NewEngine(%+v) = %s, want %s", tt.config, engine.Name(), tt.wantName)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Peer discovery settings.
+const (
+	DefaultTargetPeers   = 8   // peers a node tries to stay connected to
+	MaxExchangeAddresses = 100 // addresses sent or accepted in a single peer exchange
+)
+
+// PeerExchange is the peer-exchange message: the address of the sender (empty if unknown)
+// and the addresses of peers it knows.
+type PeerExchange struct {
+	NodeAddress string   `json:"node_address,omitempty"`
+	Addresses   []string `json:"addresses"`
+}
+
+// ParseAddressList splits a comma separated list of node addresses.
+func ParseAddressList(list string) []string {
+	addresses := []string{}
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// AddAddresses adds node addresses learnt from peers (or the command line) to the addresses
+// we may connect to, skipping invalid addresses, ourself and known peers.
+func (pm *PeerManager) AddAddresses(addresses []string) {
+	if len(addresses) > MaxExchangeAddresses {
+		addresses = addresses[:MaxExchangeAddresses]
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.addresses == nil {
+		pm.addresses = map[string]bool{}
+	}
+	for _, raw := range addresses {
+		address, err := NormalizeAddress(raw)
+		if err != nil || address == pm.AdvertiseAddr {
+			continue
+		}
+		pm.addresses[address] = true
+	}
+}
+
+// KnownAddresses returns the addresses we may connect to that are not peers yet.
+func (pm *PeerManager) KnownAddresses() []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	peers := map[string]bool{}
+	for _, peer := range pm.peers {
+		peers[peer.NodeAddress] = true
+	}
+	addresses := []string{}
+	for address := range pm.addresses {
+		if !peers[address] {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// forgetAddress removes an address we failed to connect to.
+func (pm *PeerManager) forgetAddress(address string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	delete(pm.addresses, address)
+}
+
+// ExchangeAddresses returns the addresses shared with other nodes: our active peers
+// that answered a handshake.
+func (pm *PeerManager) ExchangeAddresses() []string {
+	addresses := []string{}
+	for _, peer := range pm.ActivePeers() {
+		if peer.LastSeen > 0 && len(addresses) < MaxExchangeAddresses {
+			addresses = append(addresses, peer.NodeAddress)
+		}
+	}
+	return addresses
+}
+
+// ExchangePeers sends our peer addresses to the peer and learns the addresses it knows.
+func (bc *Blockchain) ExchangePeers(peer NodePeer) error {
+	payload, err := json.Marshal(PeerExchange{NodeAddress: bc.Peers.AdvertiseAddr, Addresses: bc.Peers.ExchangeAddresses()})
+	if err != nil {
+		return err
+	}
+	response, err := bc.Peers.postToPeer(peerURL(peer, "/peer_exchange"), payload)
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer exchange status %s", response.Status)
+	}
+	var exchange PeerExchange
+	if err := json.NewDecoder(response.Body).Decode(&exchange); err != nil {
+		return err
+	}
+	bc.Peers.AddAddresses(exchange.Addresses)
+	return nil
+}
+
+// ConnectPeer exchanges handshakes with the node at address and adds it as a peer if it is compatible,
+// the node adds us as a peer too when we have an advertised address.
+func (bc *Blockchain) ConnectPeer(address string) error {
+	payload, err := json.Marshal(bc.Handshake(bc.Peers.AdvertiseAddr))
+	if err != nil {
+		return err
+	}
+	peerAddress, err := ParsePeerAddress(address)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	response, err := peerClient.Post(peerAddress.URL("/handshake"), "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("handshake status %s", response.Status)
+	}
+	var handshake Handshake
+	if err := json.NewDecoder(response.Body).Decode(&handshake); err != nil {
+		return err
+	}
+	if err := bc.CheckHandshake(handshake); err != nil {
+		return err
+	}
+	peer := PeerFromHandshake(handshake)
+	peer.NodeAddress = peerAddress.String()
+	if err := bc.Peers.AddNodePeer(&peer); err != nil {
+		return err
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	return nil
+}
+
+// DiscoverPeers exchanges addresses with our peers, then connects to known addresses
+// until we have target active peers, exchanging addresses with each new peer.
+// Addresses that cannot be connected are forgotten.
+func (bc *Blockchain) DiscoverPeers(target int) {
+	if target <= 0 {
+		target = DefaultTargetPeers
+	}
+	for _, peer := range bc.Peers.ActivePeers() {
+		if err := bc.ExchangePeers(peer); err != nil {
+			log.Printf("Failed peer exchange with node %s: %v", peer.NodeAddress, err)
+		}
+	}
+	for _, address := range bc.Peers.KnownAddresses() {
+		if len(bc.Peers.ActivePeers()) >= target {
+			return
+		}
+		if err := bc.ConnectPeer(address); err != nil {
+			log.Printf("Failed to connect to node %s: %v", address, err)
+			bc.Peers.forgetAddress(address)
+			continue
+		}
+		log.Printf("Connected to node %s", address)
+		address, _ = NormalizeAddress(address)
+		if err := bc.ExchangePeers(NodePeer{NodeAddress: address}); err != nil {
+			log.Printf("Failed peer exchange with node %s: %v", address, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestKnownAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []string
+		want      []string
+	}{
+		{"normalized", []string{"127.0.0.1:8002", "HTTP://127.0.0.1:8002/"}, []string{"http://127.0.0.1:8002"}},
+		{"peers skipped", []string{"127.0.0.1:8001", "127.0.0.1:8003"}, []string{"http://127.0.0.1:8003"}},
+		{"self skipped", []string{"localhost:8000"}, []string{}},
+		{"invalid skipped", []string{"ftp://x", "", "127.0.0.1:8003"}, []string{"http://127.0.0.1:8003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &PeerManager{NodeID: "self", AdvertiseAddr: "http://localhost:8000"}
+			pm.SetPeers([]NodePeer{{NodeAddress: "http://127.0.0.1:8001"}})
+			pm.AddAddresses(tt.addresses)
+			if got := pm.KnownAddresses(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("KnownAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	got := ParseAddressList(" a:1, ,b:2,")
+	if want := []string{"a:1", "b:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAddressList() = %v, want %v", got, want)
+	}
+}
+
+func TestConnectPeer(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    func(handshake *Handshake)
+		status    int
+		wantErr   bool
+		wantPeers int
+	}{
+		{name: "compatible", update: func(handshake *Handshake) {}, status: http.StatusOK, wantPeers: 1},
+		{name: "other genesis", update: func(handshake *Handshake) { handshake.GenesisHash = "other" }, status: http.StatusOK, wantErr: true},
+		{name: "ourselves", update: func(handshake *Handshake) { handshake.NodeID = "self" }, status: http.StatusOK, wantErr: true},
+		{name: "rejected", update: func(handshake *Handshake) {}, status: http.StatusConflict, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			bc.Peers = &PeerManager{NodeID: "self", AdvertiseAddr: "http://127.0.0.1:8000"}
+			var received Handshake
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&received)
+				handshake := bc.Handshake("")
+				handshake.NodeID = "remote"
+				tt.update(&handshake)
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(handshake)
+			}))
+			defer server.Close()
+
+			err := bc.ConnectPeer(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConnectPeer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// we send our advertised address for the node to add us as a peer
+			if received.NodeAddress != "http://127.0.0.1:8000" || received.NodeID != "self" {
+				t.Errorf("sent handshake %+v", received)
+			}
+			peers := bc.Peers.PeerList()
+			if len(peers) != tt.wantPeers {
+				t.Fatalf("%d peers, want %d", len(peers), tt.wantPeers)
+			}
+			if tt.wantPeers > 0 && (peers[0].NodeID != "remote" || peers[0].LastSeen == 0) {
+				t.Errorf("peer %+v", peers[0])
+			}
+		})
+	}
+}
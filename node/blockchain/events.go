@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"sync"
+	"time"
+)
+
+// Chain event types.
+const (
+	EventBlock = "block" // a block was added to the chain
+	EventTx    = "tx"    // a transaction was added to the pending transactions
+	EventReorg = "reorg" // blocks of the chain were replaced by another fork
+)
+
+// EventBufferSize is the number of events buffered per subscriber, events are
+// dropped for subscribers that don't keep up.
+const EventBufferSize = 64
+
+// Event is a change of the chain or pending transactions.
+type Event struct {
+	Type        string       `json:"type"`
+	Time        int64        `json:"time"`
+	Block       *Block       `json:"block,omitempty"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+	Reorg       *Reorg       `json:"reorg,omitempty"`
+}
+
+// Reorg describes a chain reorganization: the blocks after ForkHeight were replaced.
+type Reorg struct {
+	ForkHeight int    `json:"fork_height"`
+	Removed    int    `json:"removed"`
+	Added      int    `json:"added"`
+	OldTip     string `json:"old_tip"`
+	NewTip     string `json:"new_tip"`
+}
+
+// EventHub publishes chain events to its subscribers.
+type EventHub struct {
+	subscribers map[chan Event]bool
+	mu          sync.Mutex
+}
+
+// NewEventHub creates an event hub without subscribers.
+func NewEventHub() *EventHub {
+	return &EventHub{subscribers: map[chan Event]bool{}}
+}
+
+// Subscribe returns a channel receiving the published events, and the function
+// to call when done with it.
+func (h *EventHub) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, EventBufferSize)
+	h.mu.Lock()
+	h.subscribers[events] = true
+	h.mu.Unlock()
+	return events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.subscribers[events] {
+			delete(h.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Publish sends the event to every subscriber, without blocking. A nil hub ignores events.
+func (h *EventHub) Publish(event Event) {
+	if h == nil {
+		return
+	}
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// ReplaceChain replaces our chain with chain (sharing our genesis block), publishing
+// a reorg event when blocks are removed and a block event for every new block. The
+// transactions of the removed blocks are pending again, unless in the new blocks.
+func (bc *Blockchain) ReplaceChain(chain []Block) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.replaceChain(chain)
+}
+
+// replaceChain is ReplaceChain with bc.mu held.
+func (bc *Blockchain) replaceChain(chain []Block) {
+	fork := 0
+	for fork+1 < len(chain) && fork+1 < len(bc.Chain) && chain[fork+1].Hash == bc.Chain[fork+1].Hash {
+		fork++
+	}
+	oldChain := bc.Chain
+	bc.Chain = chain[:len(chain):len(chain)]
+	bc.restorePending(oldChain[fork+1:])
+	bc.removeConfirmed(chain[fork+1:])
+	if removed := len(oldChain) - 1 - fork; removed > 0 {
+		bc.Events.Publish(Event{Type: EventReorg, Reorg: &Reorg{
+			ForkHeight: fork,
+			Removed:    removed,
+			Added:      len(chain) - 1 - fork,
+			OldTip:     oldChain[len(oldChain)-1].Hash,
+			NewTip:     chain[len(chain)-1].Hash,
+		}})
+	}
+	for i := fork + 1; i < len(chain); i++ {
+		block := chain[i]
+		bc.Events.Publish(Event{Type: EventBlock, Block: &block})
+	}
+}
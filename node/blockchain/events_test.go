@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+)
+
+// post returns a post transaction with the content.
+func post(content string) Transaction {
+	return Transaction{Author: "alice", Content: content, Timestamp: 1}
+}
+
+// chainWith returns the first blocks of the chain followed by a block for every transaction.
+func chainWith(t *testing.T, bc *Blockchain, from int, txs ...Transaction) []Block {
+	t.Helper()
+	fork := &Blockchain{Difficulty: bc.Difficulty, Chain: append([]Block{}, bc.Chain[:from]...)}
+	for _, tx := range txs {
+		fork.AddNewTransaction(&tx)
+		if _, err := fork.MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fork.Chain
+}
+
+// contents returns the contents of the transactions.
+func contents(txs []Transaction) []string {
+	list := []string{}
+	for _, tx := range txs {
+		list = append(list, tx.Content)
+	}
+	return list
+}
+
+func TestReplaceChain(t *testing.T) {
+	tests := []struct {
+		name        string
+		chain       func(t *testing.T, bc *Blockchain) []Block
+		wantPending []string
+		wantReorg   bool
+		wantBlocks  int // block events
+	}{
+		{name: "extension", chain: func(t *testing.T, bc *Blockchain) []Block {
+			return chainWith(t, bc, 3, post("c"))
+		}, wantPending: []string{}, wantBlocks: 1},
+		{name: "reorg", chain: func(t *testing.T, bc *Blockchain) []Block {
+			return chainWith(t, bc, 2, post("d"), post("e"))
+		}, wantPending: []string{"b", "c"}, wantReorg: true, wantBlocks: 2},
+		{name: "reverted transactions in the new blocks", chain: func(t *testing.T, bc *Blockchain) []Block {
+			return chainWith(t, bc, 2, post("c"), post("b"))
+		}, wantPending: []string{}, wantReorg: true, wantBlocks: 2},
+		{name: "reorg from genesis", chain: func(t *testing.T, bc *Blockchain) []Block {
+			return chainWith(t, bc, 1, post("x"), post("y"), post("z"))
+		}, wantPending: []string{"a", "b", "c"}, wantReorg: true, wantBlocks: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 0)
+			bc.Chain = chainWith(t, bc, 1, post("a"), post("b"))
+			pending := post("c")
+			bc.AddNewTransaction(&pending)
+			chain := tt.chain(t, bc)
+			bc.Events = NewEventHub()
+			events, unsubscribe := bc.Events.Subscribe()
+			defer unsubscribe()
+
+			bc.ReplaceChain(chain)
+			if got := contents(bc.PendingTransactions()); !reflect.DeepEqual(got, tt.wantPending) {
+				t.Errorf("pending %v, want %v", got, tt.wantPending)
+			}
+			reorg, blocks := false, 0
+			for len(events) > 0 {
+				event := <-events
+				reorg = reorg || event.Type == EventReorg
+				if event.Type == EventBlock {
+					blocks++
+				}
+			}
+			if reorg != tt.wantReorg || blocks != tt.wantBlocks {
+				t.Errorf("reorg event %v and %d block events, want %v and %d", reorg, blocks, tt.wantReorg, tt.wantBlocks)
+			}
+		})
+	}
+}
+
+func TestAddBlockRemovesConfirmed(t *testing.T) {
+	tests := []struct {
+		name        string
+		block       []Transaction
+		wantPending []string
+	}{
+		{"pending transaction", []Transaction{post("a")}, []string{"b"}},
+		{"every pending transaction", []Transaction{post("b"), post("a")}, []string{}},
+		{"other transaction", []Transaction{post("c")}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 0)
+			block := nextBlock(bc)
+			block.Transactions = tt.block
+			if err := bc.ProofOfWork(&block); err != nil {
+				t.Fatal(err)
+			}
+			for _, content := range []string{"a", "b"} {
+				tx := post(content)
+				bc.AddNewTransaction(&tx)
+			}
+			if err := bc.AddBlock(block); err != nil {
+				t.Fatal(err)
+			}
+			if got := contents(bc.PendingTransactions()); !reflect.DeepEqual(got, tt.wantPending) {
+				t.Errorf("pending %v, want %v", got, tt.wantPending)
+			}
+		})
+	}
+}
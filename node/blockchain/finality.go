@@ -0,0 +1,292 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Vote steps of the finality protocol.
+const (
+	VotePrevote   = "prevote"
+	VotePrecommit = "precommit"
+)
+
+// Vote is a signed prevote or precommit of a validator for the block at height.
+type Vote struct {
+	Step      string `json:"step"`
+	Height    int    `json:"height"`
+	Hash      string `json:"hash"`
+	Validator string `json:"validator"`
+	Signature string `json:"signature"`
+}
+
+// message returns the bytes signed by the validator, bound to the network by its
+// genesis hash so that votes can't be replayed on another network.
+func (v Vote) message(genesisHash string) []byte {
+	return []byte(fmt.Sprintf("%s:%s:%d:%s", genesisHash, v.Step, v.Height, v.Hash))
+}
+
+// FinalityStatus describes the finalized part of the chain.
+type FinalityStatus struct {
+	FinalizedHeight int      `json:"finalized_height"`
+	FinalizedHash   string   `json:"finalized_hash"`
+	Validators      []string `json:"validators"`
+	Commit          []Vote   `json:"commit"`
+}
+
+// Finality is a BFT finality gadget run by a known validator set on top of
+// the block production engine.
+// For every new tip a validator broadcasts a prevote, once more than 2/3 of
+// the validators prevoted the same block it broadcasts a precommit, and once
+// more than 2/3 precommitted the block it becomes final: Consensus never
+// reorganizes the chain below it.
+// Each validator votes at most once per step and height, so two different
+// blocks at the same height can't both gather a quorum.
+// A block precommitted by a quorum is only finalized once it is in our chain,
+// until then OnMissingBlock is called to sync it from the peers.
+type Finality struct {
+	Validators     []string
+	OnMissingBlock func() // called in a new goroutine, nil to wait for the block
+	key            ed25519.PrivateKey
+	votes          map[voteKey]map[string]Vote // votes by validator
+	voted          map[voteKey]string          // hash voted by this node (key without hash)
+	missing        map[voteKey]bool            // committed blocks not in our chain
+	commit         []Vote
+	mu             sync.Mutex
+}
+
+type voteKey struct {
+	Step   string
+	Height int
+	Hash   string
+}
+
+// NewFinality creates a finality gadget for the hex encoded validator public keys,
+// privateKey is set when this node is one of the validators.
+func NewFinality(validators []string, privateKey string) (*Finality, error) {
+	if len(validators) == 0 {
+		return nil, fmt.Errorf("finality: empty validator set")
+	}
+	finality := &Finality{
+		votes:   map[voteKey]map[string]Vote{},
+		voted:   map[voteKey]string{},
+		missing: map[voteKey]bool{},
+	}
+	for _, validator := range validators {
+		publicKey, err := ParsePublicKey(validator)
+		if err != nil {
+			return nil, err
+		}
+		finality.Validators = append(finality.Validators, hex.EncodeToString(publicKey))
+	}
+	if privateKey != "" {
+		key, err := ParsePrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		finality.key = key
+	}
+	return finality, nil
+}
+
+// quorum returns the number of votes needed, more than 2/3 of the validators.
+func (f *Finality) quorum() int {
+	return len(f.Validators)*2/3 + 1
+}
+
+func (f *Finality) isValidator(validator string) bool {
+	for _, v := range f.Validators {
+		if v == validator {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns the finalized height and hash of the chain and its commit votes.
+func (f *Finality) Status(bc *Blockchain) FinalityStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	finalizedHeight, finalizedHash := bc.Finalized()
+	return FinalityStatus{
+		FinalizedHeight: finalizedHeight,
+		FinalizedHash:   finalizedHash,
+		Validators:      f.Validators,
+		Commit:          f.commit,
+	}
+}
+
+// Finalized returns the height and hash of the last finalized block of the chain.
+func (bc *Blockchain) Finalized() (int, string) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.FinalizedHeight, bc.FinalizedHash
+}
+
+// setFinalized records the last finalized block of the chain.
+func (bc *Blockchain) setFinalized(height int, hash string) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.FinalizedHeight, bc.FinalizedHash = height, hash
+}
+
+// OnNewTip prevotes the current last block of the chain (validators only),
+// precommits it if the prevote quorum was reached before we had the block, and
+// finalizes the committed blocks we were missing.
+func (f *Finality) OnNewTip(bc *Blockchain) {
+	tip := bc.GetLastBlock()
+	f.mu.Lock()
+	outgoing := f.castVote(bc, VotePrevote, tip.Index, tip.Hash)
+	outgoing = append(outgoing, f.advance(bc, voteKey{VotePrevote, tip.Index, tip.Hash})...)
+	for key := range f.missing {
+		f.advance(bc, key)
+	}
+	f.mu.Unlock()
+
+	for _, v := range outgoing {
+		f.broadcast(bc, v)
+	}
+}
+
+// castVote signs and records our own vote, at most once per step and height.
+// Returns the vote and the votes it caused us to cast.
+func (f *Finality) castVote(bc *Blockchain, step string, height int, hash string) []Vote {
+	if finalized, _ := bc.Finalized(); f.key == nil || height <= finalized {
+		return nil
+	}
+	slot := voteKey{Step: step, Height: height}
+	if _, voted := f.voted[slot]; voted {
+		return nil
+	}
+	vote := Vote{
+		Step:      step,
+		Height:    height,
+		Hash:      hash,
+		Validator: hex.EncodeToString(f.key.Public().(ed25519.PublicKey)),
+	}
+	vote.Signature = hex.EncodeToString(ed25519.Sign(f.key, vote.message(bc.GenesisHash())))
+	f.voted[slot] = hash
+	return append([]Vote{vote}, f.record(bc, vote)...)
+}
+
+// AddVote verifies and records a vote received from the network, relaying it
+// (and our own resulting votes) to the peers. Returns false for already known votes.
+func (f *Finality) AddVote(bc *Blockchain, vote Vote) (bool, error) {
+	if vote.Step != VotePrevote && vote.Step != VotePrecommit {
+		return false, fmt.Errorf("unknown vote step %q", vote.Step)
+	}
+	if !f.isValidator(vote.Validator) {
+		return false, fmt.Errorf("vote from unknown validator")
+	}
+	publicKey, err := ParsePublicKey(vote.Validator)
+	if err != nil {
+		return false, err
+	}
+	signature, err := hex.DecodeString(vote.Signature)
+	if err != nil || !ed25519.Verify(publicKey, vote.message(bc.GenesisHash()), signature) {
+		return false, fmt.Errorf("vote signature invalid")
+	}
+
+	f.mu.Lock()
+	key := voteKey{vote.Step, vote.Height, vote.Hash}
+	finalized, _ := bc.Finalized()
+	if _, known := f.votes[key][vote.Validator]; known || vote.Height <= finalized {
+		f.mu.Unlock()
+		return false, nil
+	}
+	outgoing := []Vote{vote}
+	outgoing = append(outgoing, f.record(bc, vote)...)
+	f.mu.Unlock()
+
+	for _, v := range outgoing {
+		f.broadcast(bc, v)
+	}
+	return true, nil
+}
+
+// record stores a vote and advances the protocol, returning the votes cast by this node as a result.
+func (f *Finality) record(bc *Blockchain, vote Vote) []Vote {
+	key := voteKey{vote.Step, vote.Height, vote.Hash}
+	if f.votes[key] == nil {
+		f.votes[key] = map[string]Vote{}
+	}
+	f.votes[key][vote.Validator] = vote
+	return f.advance(bc, key)
+}
+
+// advance moves the protocol forward once the votes for key reach the quorum.
+func (f *Finality) advance(bc *Blockchain, key voteKey) []Vote {
+	if finalized, _ := bc.Finalized(); len(f.votes[key]) < f.quorum() || key.Height <= finalized {
+		return nil
+	}
+	block, inChain := bc.BlockByHeight(key.Height)
+	inChain = inChain && block.Hash == key.Hash
+	switch key.Step {
+	case VotePrevote:
+		// only precommit blocks we have in our chain
+		if inChain {
+			return f.castVote(bc, VotePrecommit, key.Height, key.Hash)
+		}
+	case VotePrecommit:
+		// the committed block may be on a chain we don't have yet
+		if !inChain {
+			if !f.missing[key] {
+				f.missing[key] = true
+				log.Printf("Block %d (%s) committed but not in our chain", key.Height, key.Hash)
+				if f.OnMissingBlock != nil {
+					go f.OnMissingBlock()
+				}
+			}
+			return nil
+		}
+		bc.setFinalized(key.Height, key.Hash)
+		f.commit = nil
+		for _, v := range f.votes[key] {
+			f.commit = append(f.commit, v)
+		}
+		f.prune(key.Height)
+		log.Printf("Block %d (%s) finalized", key.Height, key.Hash)
+	}
+	return nil
+}
+
+// prune drops the votes at or below the finalized height.
+func (f *Finality) prune(height int) {
+	for key := range f.votes {
+		if key.Height <= height {
+			delete(f.votes, key)
+		}
+	}
+	for key := range f.voted {
+		if key.Height <= height {
+			delete(f.voted, key)
+		}
+	}
+	for key := range f.missing {
+		if key.Height <= height {
+			delete(f.missing, key)
+		}
+	}
+}
+
+// broadcast sends the vote to every peer.
+func (f *Finality) broadcast(bc *Blockchain, vote Vote) {
+	voteData, err := json.Marshal(vote)
+	if err != nil {
+		return
+	}
+	for _, peer := range bc.Peers.ActivePeers() {
+		go func(peer NodePeer) {
+			resp, err := bc.Peers.postToPeer(peerURL(peer, "/finality/vote"), voteData)
+			if err != nil {
+				log.Printf("Failed to send vote to node %s: %v", peer.NodeAddress, err)
+				return
+			}
+			resp.Body.Close()
+		}(peer)
+	}
+}
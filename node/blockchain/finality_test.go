@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// newPoWChain returns a default chain with difficulty 1 and the given number of mined blocks.
+func newPoWChain(t *testing.T, blocks int) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Difficulty = 1
+	for i := 0; i < blocks; i++ {
+		block := nextBlock(bc)
+		if err := bc.ProofOfWork(&block); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bc
+}
+
+// signVote signs a vote of key for the block at height on the network with genesisHash.
+func signVote(key ed25519.PrivateKey, genesisHash string, step string, height int, hash string) Vote {
+	vote := Vote{Step: step, Height: height, Hash: hash, Validator: testPublicKey(key)}
+	vote.Signature = hex.EncodeToString(ed25519.Sign(key, vote.message(genesisHash)))
+	return vote
+}
+
+// newTestFinality returns an observer (non validator) gadget for n validators and their keys.
+func newTestFinality(t *testing.T, n int) (*Finality, []ed25519.PrivateKey) {
+	t.Helper()
+	keys := []ed25519.PrivateKey{}
+	validators := []string{}
+	for i := 0; i < n; i++ {
+		keys = append(keys, testKey(byte(i+1)))
+		validators = append(validators, testPublicKey(keys[i]))
+	}
+	finality, err := NewFinality(validators, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return finality, keys
+}
+
+func TestFinalityQuorum(t *testing.T) {
+	tests := []struct {
+		validators int
+		want       int
+	}{
+		{1, 1}, {2, 2}, {3, 3}, {4, 3}, {5, 4}, {6, 5}, {7, 5}, {10, 7},
+	}
+	for _, tt := range tests {
+		finality, _ := newTestFinality(t, tt.validators)
+		if got := finality.quorum(); got != tt.want {
+			t.Errorf("quorum of %d validators = %d, want %d", tt.validators, got, tt.want)
+		}
+	}
+}
+
+func TestFinalityAddVote(t *testing.T) {
+	tests := []struct {
+		name       string
+		step       string
+		voters     int    // validators voting, out of 4
+		hash       string // voted hash, the block at height 1 if empty
+		genesis    string // network of the votes, ours if empty
+		wantErr    bool
+		wantHeight int
+	}{
+		{name: "precommit quorum", step: VotePrecommit, voters: 3, wantHeight: 1},
+		{name: "all precommits", step: VotePrecommit, voters: 4, wantHeight: 1},
+		{name: "below quorum", step: VotePrecommit, voters: 2},
+		{name: "prevotes only", step: VotePrevote, voters: 4},
+		{name: "block not in our chain", step: VotePrecommit, voters: 3, hash: "unknown"},
+		{name: "other network", step: VotePrecommit, voters: 3, genesis: "other", wantErr: true},
+		{name: "unknown step", step: "vote", voters: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 2)
+			finality, keys := newTestFinality(t, 4)
+			hash := tt.hash
+			if hash == "" {
+				hash = bc.Chain[1].Hash
+			}
+			genesis := tt.genesis
+			if genesis == "" {
+				genesis = bc.GenesisHash()
+			}
+			for _, key := range keys[:tt.voters] {
+				_, err := finality.AddVote(bc, signVote(key, genesis, tt.step, 1, hash))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("AddVote() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			if bc.FinalizedHeight != tt.wantHeight {
+				t.Errorf("finalized height %d, want %d", bc.FinalizedHeight, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestFinalityMissingBlock(t *testing.T) {
+	bc := newPoWChain(t, 1)
+	finality, keys := newTestFinality(t, 4)
+	missing := make(chan struct{}, 4)
+	finality.OnMissingBlock = func() { missing <- struct{}{} }
+
+	// the validators commit block 2 before we have it
+	block := nextBlock(bc)
+	if err := bc.ProofOfWork(&block); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, err := finality.AddVote(bc, signVote(key, bc.GenesisHash(), VotePrecommit, 2, block.Hash)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-missing:
+	case <-time.After(time.Second):
+		t.Fatal("missing block not synced")
+	}
+	if bc.FinalizedHeight != 0 {
+		t.Fatalf("finalized height %d before having the block", bc.FinalizedHeight)
+	}
+	if len(missing) != 0 {
+		t.Errorf("sync requested %d more times", len(missing))
+	}
+
+	if err := bc.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	finality.OnNewTip(bc)
+	if bc.FinalizedHeight != 2 || bc.FinalizedHash != block.Hash {
+		t.Errorf("finalized %d %s, want 2 %s", bc.FinalizedHeight, bc.FinalizedHash, block.Hash)
+	}
+}
+
+func TestFinalityValidatorVotes(t *testing.T) {
+	bc := newPoWChain(t, 1)
+	keys := []ed25519.PrivateKey{testKey(1), testKey(2), testKey(3)}
+	validators := []string{testPublicKey(keys[0]), testPublicKey(keys[1]), testPublicKey(keys[2])}
+	finality, err := NewFinality(validators, hex.EncodeToString(keys[0].Seed()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := bc.GetLastBlock()
+	finality.OnNewTip(bc)
+	// our prevote and two others reach the quorum: we precommit, then two precommits finalize
+	for _, step := range []string{VotePrevote, VotePrecommit} {
+		for _, key := range keys[1:] {
+			if _, err := finality.AddVote(bc, signVote(key, bc.GenesisHash(), step, tip.Index, tip.Hash)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if bc.FinalizedHeight != tip.Index {
+		t.Errorf("finalized height %d, want %d", bc.FinalizedHeight, tip.Index)
+	}
+	status := finality.Status(bc)
+	if len(status.Commit) != 3 {
+		t.Errorf("commit has %d votes, want 3", len(status.Commit))
+	}
+}
@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TxTypeGenesis is the type of the transaction holding the genesis config in the genesis block.
+const TxTypeGenesis = "genesis"
+
+// DefaultDifficulty is the proof of work difficulty of a new chain.
+const DefaultDifficulty = 2
+
+// Genesis is the config of a network, committed into its genesis block so that
+// unrelated networks have different genesis hashes.
+type Genesis struct {
+	NetworkID    string           `json:"network_id"`
+	Timestamp    int64            `json:"timestamp"`
+	Difficulty   int              `json:"difficulty"`
+	Consensus    string           `json:"consensus,omitempty"`
+	Validators   []string         `json:"validators,omitempty"`
+	Allocations  map[string]int64 `json:"allocations,omitempty"`
+	Stakes       map[string]int64 `json:"stakes,omitempty"`
+	SlotDuration int64            `json:"slot_duration,omitempty"`
+}
+
+// LoadGenesis reads a genesis config file.
+func LoadGenesis(file string) (*Genesis, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var genesis Genesis
+	err = json.Unmarshal(data, &genesis)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %v", file, err)
+	}
+	if genesis.NetworkID == "" {
+		return nil, fmt.Errorf("invalid genesis file %s: missing network_id", file)
+	}
+	if genesis.Difficulty == 0 {
+		genesis.Difficulty = DefaultDifficulty
+	}
+	return &genesis, nil
+}
+
+// EngineConfig returns the consensus engine config defined by the genesis,
+// the private key is local to the node.
+func (g *Genesis) EngineConfig(privateKey string) EngineConfig {
+	return EngineConfig{
+		Name:         g.Consensus,
+		Validators:   g.Validators,
+		PrivateKey:   privateKey,
+		Allocations:  g.Allocations,
+		Stakes:       g.Stakes,
+		SlotDuration: g.SlotDuration,
+	}
+}
+
+// Block creates the genesis block. Without a config, it is the empty block
+// shared by all default deployments.
+func (g *Genesis) Block() (Block, error) {
+	genesisBlock := Block{
+		Index:        0,
+		Transactions: []Transaction{},
+		Timestamp:    0,
+		PreviousHash: "0",
+		Nonce:        0,
+	}
+	if g != nil {
+		config, err := json.Marshal(g)
+		if err != nil {
+			return Block{}, err
+		}
+		genesisBlock.Timestamp = g.Timestamp
+		genesisBlock.Transactions = []Transaction{{
+			Type:      TxTypeGenesis,
+			Author:    g.NetworkID,
+			Content:   string(config),
+			Timestamp: g.Timestamp,
+		}}
+	}
+	computedHash, err := genesisBlock.ComputeHash()
+	if err != nil {
+		return Block{}, err
+	}
+	genesisBlock.Hash = computedHash
+	return genesisBlock, nil
+}
+
+// GenesisHash returns the hash of the first block of the chain.
+func (bc *Blockchain) GenesisHash() string {
+	return bc.GetChain()[0].Hash
+}
@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadGenesis(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		wantErr        bool
+		wantNetwork    string
+		wantDifficulty int
+	}{
+		{"default difficulty", `{"network_id":"testnet","timestamp":1}`, false, "testnet", DefaultDifficulty},
+		{"difficulty", `{"network_id":"testnet","difficulty":4}`, false, "testnet", 4},
+		{"missing network id", `{"difficulty":4}`, true, "", 0},
+		{"invalid json", `{"network_id":`, true, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "genesis.json")
+			if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			genesis, err := LoadGenesis(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadGenesis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (genesis.NetworkID != tt.wantNetwork || genesis.Difficulty != tt.wantDifficulty) {
+				t.Errorf("LoadGenesis() = %+v", genesis)
+			}
+		})
+	}
+	if _, err := LoadGenesis(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadGenesis() of a missing file succeeded")
+	}
+}
+
+func TestGenesisBlock(t *testing.T) {
+	testnet := &Genesis{NetworkID: "testnet", Timestamp: 1, Difficulty: 2}
+	tests := []struct {
+		name     string
+		genesis  *Genesis
+		sameAs   *Genesis // config with the same genesis hash
+		differs  *Genesis // config with another genesis hash
+		wantHash string
+	}{
+		{name: "default", genesis: nil, wantHash: DefaultCheckpoints[0]},
+		{name: "same config", genesis: testnet, sameAs: &Genesis{NetworkID: "testnet", Timestamp: 1, Difficulty: 2}},
+		{name: "other network", genesis: testnet, differs: &Genesis{NetworkID: "mainnet", Timestamp: 1, Difficulty: 2}},
+		{name: "other consensus", genesis: testnet, differs: &Genesis{NetworkID: "testnet", Timestamp: 1, Difficulty: 2, Consensus: ConsensusPoA}},
+		{name: "other timestamp", genesis: testnet, differs: &Genesis{NetworkID: "testnet", Timestamp: 2, Difficulty: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := tt.genesis.Block()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantHash != "" && block.Hash != tt.wantHash {
+				t.Errorf("hash %s, want %s", block.Hash, tt.wantHash)
+			}
+			if tt.sameAs != nil {
+				other, _ := tt.sameAs.Block()
+				if other.Hash != block.Hash {
+					t.Errorf("same config has hash %s, want %s", other.Hash, block.Hash)
+				}
+			}
+			if tt.differs != nil {
+				other, _ := tt.differs.Block()
+				if other.Hash == block.Hash {
+					t.Errorf("other config has the same hash %s", block.Hash)
+				}
+			}
+		})
+	}
+}
+
+func TestNewBlockchainFromGenesis(t *testing.T) {
+	bc, err := NewBlockchainFromGenesis(&Genesis{NetworkID: "testnet", Timestamp: 1, Difficulty: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.NetworkID != "testnet" || bc.Difficulty != 3 || len(bc.Chain) != 1 || bc.Chain[0].Transactions[0].Type != TxTypeGenesis {
+		t.Errorf("NewBlockchainFromGenesis() = %+v", bc)
+	}
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import "fmt"
+
+// Versions of the node protocol, peers older than MinProtocolVersion are rejected.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Handshake is exchanged by nodes when they connect, describing
+// their protocol, network and best chain.
+type Handshake struct {
+	Version        int    `json:"version"`
+	NodeID         string `json:"node_id"`
+	NodeAddress    string `json:"node_address"`
+	NetworkID      string `json:"network_id"`
+	GenesisHash    string `json:"genesis_hash"`
+	BestHeight     int    `json:"best_height"`
+	BestHash       string `json:"best_hash"`
+	CumulativeWork uint64 `json:"cumulative_work"`
+}
+
+// Handshake returns our handshake, advertising the given node address.
+func (bc *Blockchain) Handshake(nodeAddress string) Handshake {
+	lastBlock := bc.GetLastBlock()
+	return Handshake{
+		Version:        ProtocolVersion,
+		NodeID:         bc.Peers.NodeID,
+		NodeAddress:    nodeAddress,
+		NetworkID:      bc.NetworkID,
+		GenesisHash:    bc.GenesisHash(),
+		BestHeight:     lastBlock.Index,
+		BestHash:       lastBlock.Hash,
+		CumulativeWork: bc.CumulativeWork(),
+	}
+}
+
+// CheckHandshake returns an error if the peer is not compatible with our node.
+func (bc *Blockchain) CheckHandshake(handshake Handshake) error {
+	if handshake.NodeID != "" && handshake.NodeID == bc.Peers.NodeID {
+		return ErrSelfConnection
+	}
+	if handshake.Version < MinProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d", handshake.Version)
+	}
+	if handshake.NetworkID != bc.NetworkID {
+		return fmt.Errorf("network %q mismatch", handshake.NetworkID)
+	}
+	if handshake.GenesisHash != bc.GenesisHash() {
+		return fmt.Errorf("genesis block mismatch")
+	}
+	return nil
+}
+
+// BlockWork returns the work represented by a block: the expected number of hashes
+// for proof of work, one for signed blocks.
+func (bc *Blockchain) BlockWork(block Block) uint64 {
+	if block.Index == 0 || bc.ConsensusEngine().Name() != ConsensusPoW {
+		return 1
+	}
+	return 1 << (4 * uint(bc.Difficulty))
+}
+
+// CumulativeWork returns the total work of the chain.
+func (bc *Blockchain) CumulativeWork() uint64 {
+	var work uint64
+	for _, block := range bc.GetChain() {
+		work += bc.BlockWork(block)
+	}
+	return work
+}
+
+// PeerFromHandshake creates a peer holding the handshake metadata.
+func PeerFromHandshake(handshake Handshake) NodePeer {
+	return NodePeer{
+		NodeAddress:    handshake.NodeAddress,
+		NodeID:         handshake.NodeID,
+		Version:        handshake.Version,
+		NetworkID:      handshake.NetworkID,
+		GenesisHash:    handshake.GenesisHash,
+		BestHeight:     handshake.BestHeight,
+		BestHash:       handshake.BestHash,
+		CumulativeWork: handshake.CumulativeWork,
+	}
+}
@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(handshake *Handshake)
+		wantErr bool
+		wantIs  error
+	}{
+		{name: "compatible", update: func(handshake *Handshake) {}},
+		{name: "newer version", update: func(handshake *Handshake) { handshake.Version = ProtocolVersion + 1 }},
+		{name: "ahead of us", update: func(handshake *Handshake) { handshake.BestHeight, handshake.BestHash = 10, "abc" }},
+		{name: "old version", update: func(handshake *Handshake) { handshake.Version = MinProtocolVersion - 1 }, wantErr: true},
+		{name: "other network", update: func(handshake *Handshake) { handshake.NetworkID = "mainnet" }, wantErr: true},
+		{name: "other genesis", update: func(handshake *Handshake) { handshake.GenesisHash = "abc" }, wantErr: true},
+		{name: "ourselves", update: func(handshake *Handshake) { handshake.NodeID = "self" }, wantErr: true, wantIs: ErrSelfConnection},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			bc.Peers.NodeID = "self"
+			handshake := bc.Handshake("http://127.0.0.1:8001")
+			handshake.NodeID = "other"
+			tt.update(&handshake)
+			err := bc.CheckHandshake(handshake)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckHandshake() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("CheckHandshake() error = %v, want %v", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	bc := newPoWChain(t, 2)
+	bc.Peers.NodeID = "self"
+	handshake := bc.Handshake("http://127.0.0.1:8001")
+	tip := bc.GetLastBlock()
+	want := Handshake{
+		Version:        ProtocolVersion,
+		NodeID:         "self",
+		NodeAddress:    "http://127.0.0.1:8001",
+		GenesisHash:    bc.GenesisHash(),
+		BestHeight:     tip.Index,
+		BestHash:       tip.Hash,
+		CumulativeWork: 1 + 2*16,
+	}
+	if handshake != want {
+		t.Errorf("Handshake() = %+v, want %+v", handshake, want)
+	}
+	peer := PeerFromHandshake(handshake)
+	if peer.NodeID != "self" || peer.BestHeight != tip.Index || peer.CumulativeWork != want.CumulativeWork {
+		t.Errorf("PeerFromHandshake() = %+v", peer)
+	}
+}
+
+func TestRefreshPeer(t *testing.T) {
+	tests := []struct {
+		name         string
+		update       func(handshake *Handshake)
+		status       int
+		wantErr      bool
+		wantIs       error
+		wantPeer     bool
+		wantFailures int
+	}{
+		{name: "compatible", update: func(handshake *Handshake) {}, status: http.StatusOK, wantPeer: true},
+		{name: "other network", update: func(handshake *Handshake) { handshake.NetworkID = "mainnet" }, status: http.StatusOK, wantErr: true},
+		{name: "other genesis", update: func(handshake *Handshake) { handshake.GenesisHash = "abc" }, status: http.StatusOK, wantErr: true},
+		{name: "old version", update: func(handshake *Handshake) { handshake.Version = MinProtocolVersion - 1 }, status: http.StatusOK, wantErr: true},
+		{name: "ourselves", update: func(handshake *Handshake) { handshake.NodeID = "self" }, status: http.StatusOK, wantErr: true, wantIs: ErrSelfConnection},
+		{name: "rejected", update: func(handshake *Handshake) {}, status: http.StatusConflict, wantErr: true, wantPeer: true, wantFailures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			bc.NetworkID = "testnet"
+			bc.Peers = &PeerManager{NodeID: "self", AdvertiseAddr: "http://127.0.0.1:8000"}
+			var header http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header
+				handshake := bc.Handshake("")
+				handshake.NodeID = "remote"
+				handshake.BestHeight, handshake.BestHash = 5, "abc"
+				tt.update(&handshake)
+				w.WriteHeader(tt.status)
+				json.NewEncoder(w).Encode(handshake)
+			}))
+			defer server.Close()
+			if err := bc.Peers.AddNodePeer(&NodePeer{NodeAddress: server.URL}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := bc.RefreshPeer(bc.Peers.PeerList()[0])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RefreshPeer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("RefreshPeer() error = %v, want %v", err, tt.wantIs)
+			}
+			// the handshake identifies us like every message to peers
+			if header.Get(NodeIDHeader) != "self" || header.Get(NodeAddressHeader) != "http://127.0.0.1:8000" {
+				t.Errorf("handshake sent with node id %q and address %q", header.Get(NodeIDHeader), header.Get(NodeAddressHeader))
+			}
+			peers := bc.Peers.PeerList()
+			if (len(peers) == 1) != tt.wantPeer {
+				t.Fatalf("peers %+v, want peer %v", peers, tt.wantPeer)
+			}
+			if !tt.wantPeer {
+				return
+			}
+			peer := peers[0]
+			if peer.Failures != tt.wantFailures {
+				t.Errorf("%d failures, want %d", peer.Failures, tt.wantFailures)
+			}
+			if tt.wantFailures == 0 && (peer.NodeID != "remote" || peer.Version != ProtocolVersion || peer.NetworkID != "testnet" ||
+				peer.GenesisHash != bc.GenesisHash() || peer.BestHeight != 5 || peer.BestHash != "abc" || peer.CumulativeWork != bc.CumulativeWork()) {
+				t.Errorf("peer %+v not updated from the handshake", peer)
+			}
+		})
+	}
+}
+
+func TestBlockWork(t *testing.T) {
+	tests := []struct {
+		name       string
+		engine     Engine
+		difficulty int
+		index      int
+		want       uint64
+	}{
+		{"genesis", nil, 2, 0, 1},
+		{"pow difficulty 1", nil, 1, 1, 16},
+		{"pow difficulty 2", nil, 2, 1, 256},
+		{"signed", &ProofOfAuthorityEngine{}, 2, 1, 1},
+	}
+	for _, tt := range tests {
+		bc := &Blockchain{Difficulty: tt.difficulty, Engine: tt.engine}
+		if got := bc.BlockWork(Block{Index: tt.index}); got != tt.want {
+			t.Errorf("%s: BlockWork() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package blockchain
+
+import "sort"
+
+// Post query settings.
+const (
+	DefaultPostsLimit = 20  // posts returned by a query without limit
+	MaxPostsLimit     = 100 // most posts returned by a query
+)
+
+// Post is a post transaction of our chain, with its id and block.
+type Post struct {
+	ID          string `json:"id"`
+	Author      string `json:"author"`
+	Content     string `json:"content"`
+	Timestamp   int64  `json:"timestamp"`
+	BlockHeight int    `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+}
+
+// PostPage is a page of the posts matching a query, Total is the count of matching posts.
+type PostPage struct {
+	Offset int    `json:"offset"`
+	Total  int    `json:"total"`
+	Posts  []Post `json:"posts"`
+}
+
+// txRef locates a transaction of the chain.
+type txRef struct {
+	height    int // of the block
+	index     int // in the block transactions
+	timestamp int64
+}
+
+// indexTransactions adds the transactions of the block at height to the indexes, posts
+// are indexed by author and timestamp.
+func (cache *chainCache) indexTransactions(block Block, height int) {
+	for index, tx := range block.Transactions {
+		ref := txRef{height: height, index: index, timestamp: tx.Timestamp}
+		cache.txs[tx.ID()] = ref
+		if tx.Type != TxTypePost {
+			continue
+		}
+		cache.authors[tx.Author] = append(cache.authors[tx.Author], ref)
+		// usually appended, timestamps of the new posts are mostly increasing
+		i := sort.Search(len(cache.byTime), func(i int) bool { return cache.byTime[i].timestamp > tx.Timestamp })
+		cache.byTime = append(cache.byTime, txRef{})
+		copy(cache.byTime[i+1:], cache.byTime[i:])
+		cache.byTime[i] = ref
+		for _, word := range Words(tx.Content) {
+			cache.words[word] = append(cache.words[word], ref)
+		}
+	}
+}
+
+// transactionRef returns the location of the transaction with the given id in our chain.
+func (bc *Blockchain) transactionRef(id string) (txRef, bool) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	bc.refreshCache()
+	ref, ok := bc.cache.txs[id]
+	return ref, ok
+}
+
+// PostsByAuthor returns a page of the posts of the author, in chain order.
+func (bc *Blockchain) PostsByAuthor(author string, offset int, limit int) PostPage {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	chain := bc.refreshCache()
+	return bc.postPage(chain, bc.cache.authors[author], offset, limit)
+}
+
+// PostsByTime returns a page of the posts with a timestamp between since and until
+// (included, 0 for no bound), by timestamp.
+func (bc *Blockchain) PostsByTime(since int64, until int64, offset int, limit int) PostPage {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	chain := bc.refreshCache()
+	posts := bc.cache.byTime
+	from := sort.Search(len(posts), func(i int) bool { return posts[i].timestamp >= since })
+	to := len(posts)
+	if until > 0 {
+		to = sort.Search(len(posts), func(i int) bool { return posts[i].timestamp > until })
+	}
+	if to < from {
+		to = from
+	}
+	return bc.postPage(chain, posts[from:to], offset, limit)
+}
+
+// postPage returns the posts of refs in chain from offset, limit is DefaultPostsLimit when not
+// positive and at most MaxPostsLimit (under lock).
+func (bc *Blockchain) postPage(chain []Block, refs []txRef, offset int, limit int) PostPage {
+	if limit <= 0 {
+		limit = DefaultPostsLimit
+	}
+	if limit > MaxPostsLimit {
+		limit = MaxPostsLimit
+	}
+	page := PostPage{Offset: offset, Total: len(refs), Posts: []Post{}}
+	for i := offset; i >= 0 && i < len(refs) && len(page.Posts) < limit; i++ {
+		block := chain[refs[i].height]
+		tx := block.Transactions[refs[i].index]
+		page.Posts = append(page.Posts, Post{
+			ID:          tx.ID(),
+			Author:      tx.Author,
+			Content:     tx.Content,
+			Timestamp:   tx.Timestamp,
+			BlockHeight: block.Index,
+			BlockHash:   block.Hash,
+		})
+	}
+	return page
+}
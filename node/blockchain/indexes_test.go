@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// newPostChain returns a chain with two blocks of posts by alice and bob, and a block of
+// DefaultPostsLimit+5 posts by carol.
+func newPostChain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc := newPoWChain(t, 0)
+	blocks := [][]Transaction{
+		{
+			{Author: "alice", Content: "a1", Timestamp: 30},
+			{Author: "bob", Content: "b1", Timestamp: 10},
+			{Author: "alice", Content: "a2", Timestamp: 20},
+		},
+		{
+			{Author: "alice", Content: "a3", Timestamp: 40},
+			{Author: "bob", Content: "b2", Timestamp: 25},
+			{Author: "bob", Type: TxTypeStake, Amount: 1, Timestamp: 26},
+		},
+		{},
+	}
+	for i := 0; i < DefaultPostsLimit+5; i++ {
+		blocks[2] = append(blocks[2], Transaction{Author: "carol", Content: fmt.Sprintf("c%d", i), Timestamp: int64(100 + i)})
+	}
+	for _, txs := range blocks {
+		for _, tx := range txs {
+			bc.AddNewTransaction(&tx)
+		}
+		if _, err := bc.MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bc
+}
+
+// carolPosts returns the contents of the first n posts of carol.
+func carolPosts(n int) []string {
+	list := []string{}
+	for i := 0; i < n; i++ {
+		list = append(list, fmt.Sprintf("c%d", i))
+	}
+	return list
+}
+
+// postContents returns the contents of the page posts.
+func postContents(page PostPage) []string {
+	list := []string{}
+	for _, post := range page.Posts {
+		list = append(list, post.Content)
+	}
+	return list
+}
+
+func TestPostsByAuthor(t *testing.T) {
+	bc := newPostChain(t)
+	tests := []struct {
+		name      string
+		author    string
+		offset    int
+		limit     int
+		want      []string
+		wantTotal int
+	}{
+		{name: "chain order", author: "alice", limit: 10, want: []string{"a1", "a2", "a3"}, wantTotal: 3},
+		{name: "posts only", author: "bob", limit: 10, want: []string{"b1", "b2"}, wantTotal: 2},
+		{name: "offset", author: "alice", offset: 1, limit: 10, want: []string{"a2", "a3"}, wantTotal: 3},
+		{name: "limit", author: "alice", limit: 2, want: []string{"a1", "a2"}, wantTotal: 3},
+		{name: "offset past the end", author: "alice", offset: 3, limit: 10, want: []string{}, wantTotal: 3},
+		{name: "negative offset", author: "alice", offset: -1, limit: 10, want: []string{}, wantTotal: 3},
+		{name: "default limit", author: "carol", want: carolPosts(DefaultPostsLimit), wantTotal: DefaultPostsLimit + 5},
+		{name: "unknown author", author: "dave", limit: 10, want: []string{}, wantTotal: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := bc.PostsByAuthor(tt.author, tt.offset, tt.limit)
+			if got := postContents(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("posts %v, want %v", got, tt.want)
+			}
+			if page.Total != tt.wantTotal || page.Offset != tt.offset {
+				t.Errorf("total %d offset %d, want %d and %d", page.Total, page.Offset, tt.wantTotal, tt.offset)
+			}
+		})
+	}
+	for _, post := range bc.PostsByAuthor("alice", 0, 10).Posts {
+		block := bc.GetChain()[post.BlockHeight]
+		if post.BlockHash != block.Hash || post.Author != "alice" || post.ID == "" {
+			t.Errorf("post %+v not in block %d %s", post, block.Index, block.Hash)
+		}
+	}
+}
+
+func TestPostsByTime(t *testing.T) {
+	bc := newPostChain(t)
+	tests := []struct {
+		name      string
+		since     int64
+		until     int64
+		offset    int
+		limit     int
+		want      []string
+		wantTotal int
+	}{
+		{name: "by timestamp", until: 99, limit: 10, want: []string{"b1", "a2", "b2", "a1", "a3"}, wantTotal: 5},
+		{name: "bounds included", since: 20, until: 30, limit: 10, want: []string{"a2", "b2", "a1"}, wantTotal: 3},
+		{name: "no upper bound", since: 123, limit: 10, want: []string{"c23", "c24"}, wantTotal: 2},
+		{name: "offset and limit", until: 99, offset: 1, limit: 2, want: []string{"a2", "b2"}, wantTotal: 5},
+		{name: "empty range", since: 31, until: 39, limit: 10, want: []string{}, wantTotal: 0},
+		{name: "inverted range", since: 40, until: 10, limit: 10, want: []string{}, wantTotal: 0},
+		{name: "limit above the maximum", since: 100, limit: MaxPostsLimit + 1, want: carolPosts(DefaultPostsLimit + 5), wantTotal: DefaultPostsLimit + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := bc.PostsByTime(tt.since, tt.until, tt.offset, tt.limit)
+			if got := postContents(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("posts %v, want %v", got, tt.want)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("total %d, want %d", page.Total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestPostsAfterReorg(t *testing.T) {
+	bc := newPostChain(t)
+	// the cache is built, the reorg replaces the blocks of bob's posts
+	if page := bc.PostsByAuthor("bob", 0, 10); page.Total != 2 {
+		t.Fatalf("bob has %d posts, want 2", page.Total)
+	}
+	bc.ReplaceChain(chainWith(t, bc, 1, Transaction{Author: "bob", Content: "b3", Timestamp: 50}))
+	if got := postContents(bc.PostsByAuthor("bob", 0, 10)); !reflect.DeepEqual(got, []string{"b3"}) {
+		t.Errorf("bob posts %v, want [b3]", got)
+	}
+	if got := postContents(bc.PostsByTime(0, 0, 0, 10)); !reflect.DeepEqual(got, []string{"b3"}) {
+		t.Errorf("posts %v, want [b3]", got)
+	}
+}
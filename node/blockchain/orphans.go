@@ -0,0 +1,216 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Orphan pool settings.
+const (
+	MaxOrphans     = 100              // orphan blocks kept, the oldest are evicted first
+	OrphanExpiry   = 10 * time.Minute // how long an orphan block is kept
+	MaxOrphanFetch = 16               // ancestors fetched one by one before syncing header first
+)
+
+// ErrOrphanBlock is returned when a block is held in the orphan pool until its parent is known.
+var ErrOrphanBlock = errors.New("orphan block")
+
+// orphanPool holds the blocks whose parent is not in our chain, by parent hash.
+type orphanPool struct {
+	byParent map[string][]orphanBlock
+	count    int
+	mu       sync.Mutex
+}
+
+type orphanBlock struct {
+	block    Block
+	received time.Time
+}
+
+// add holds the block, dropping expired orphans and the oldest when the pool is full.
+func (p *orphanPool) add(block Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.byParent == nil {
+		p.byParent = map[string][]orphanBlock{}
+	}
+	for _, orphan := range p.byParent[block.PreviousHash] {
+		if orphan.block.Hash == block.Hash {
+			return
+		}
+	}
+	p.prune(time.Now().Add(-OrphanExpiry))
+	for p.count >= MaxOrphans {
+		p.evictOldest()
+	}
+	p.byParent[block.PreviousHash] = append(p.byParent[block.PreviousHash], orphanBlock{block: block, received: time.Now()})
+	p.count++
+}
+
+// prune drops the orphans received before expiry (under lock).
+func (p *orphanPool) prune(expiry time.Time) {
+	for parent, orphans := range p.byParent {
+		kept := orphans[:0]
+		for _, orphan := range orphans {
+			if orphan.received.After(expiry) {
+				kept = append(kept, orphan)
+			}
+		}
+		p.count -= len(orphans) - len(kept)
+		if len(kept) == 0 {
+			delete(p.byParent, parent)
+		} else {
+			p.byParent[parent] = kept
+		}
+	}
+}
+
+// evictOldest drops the oldest orphan (under lock).
+func (p *orphanPool) evictOldest() {
+	var (
+		oldestParent string
+		oldest       time.Time
+	)
+	for parent, orphans := range p.byParent {
+		for _, orphan := range orphans {
+			if oldest.IsZero() || orphan.received.Before(oldest) {
+				oldestParent, oldest = parent, orphan.received
+			}
+		}
+	}
+	if orphans := p.byParent[oldestParent]; len(orphans) > 1 {
+		p.byParent[oldestParent] = orphans[1:]
+	} else {
+		delete(p.byParent, oldestParent)
+	}
+	p.count--
+}
+
+// children returns the orphans of parent.
+func (p *orphanPool) children(parent string) []Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	blocks := []Block{}
+	for _, orphan := range p.byParent[parent] {
+		blocks = append(blocks, orphan.block)
+	}
+	return blocks
+}
+
+// remove drops the block from the pool.
+func (p *orphanPool) remove(block Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orphans := p.byParent[block.PreviousHash]
+	for i, orphan := range orphans {
+		if orphan.block.Hash == block.Hash {
+			orphans = append(orphans[:i:i], orphans[i+1:]...)
+			p.count--
+			break
+		}
+	}
+	if len(orphans) == 0 {
+		delete(p.byParent, block.PreviousHash)
+	} else {
+		p.byParent[block.PreviousHash] = orphans
+	}
+}
+
+// Len returns the number of orphan blocks.
+func (p *orphanPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.count
+}
+
+// AcceptBlock adds a block received from peer (nil if unknown) to the chain. A block whose parent
+// is not in our chain is held in the orphan pool and its missing ancestors are requested from
+// the peer, one by one up to MaxOrphanFetch, then by header-first sync. ErrOrphanBlock is
+// returned while the block can't be connected.
+func (bc *Blockchain) AcceptBlock(block Block, peer *NodePeer) error {
+	err := bc.AddBlock(block)
+	if err == nil {
+		bc.connectOrphans()
+		return nil
+	}
+	// blocks forking from our chain (or known) are not orphans
+	if !errors.Is(err, ErrPreviousHash) || bc.HasBlock(block.PreviousHash) || bc.HasBlock(block.Hash) {
+		return err
+	}
+	bc.orphans.add(block)
+	if peer == nil {
+		return ErrOrphanBlock
+	}
+	hash := block.PreviousHash
+	for i := 0; i < MaxOrphanFetch; i++ {
+		parent, err := bc.fetchBlock(*peer, hash)
+		if err != nil {
+			log.Printf("Failed to fetch block %s from node %s: %v", hash, peer.NodeAddress, err)
+			return ErrOrphanBlock
+		}
+		err = bc.AddBlock(parent)
+		if err == nil {
+			bc.connectOrphans()
+			return nil
+		}
+		if !errors.Is(err, ErrPreviousHash) {
+			return err
+		}
+		if bc.HasBlock(parent.PreviousHash) {
+			break // the peer chain forks from ours
+		}
+		bc.orphans.add(parent)
+		hash = parent.PreviousHash
+	}
+	if changed, err := bc.SyncWithPeer(*peer); err != nil || !changed {
+		return ErrOrphanBlock
+	}
+	return nil
+}
+
+// connectOrphans adds the orphans following our last block, as long as there are any.
+// Only the connected orphans leave the pool, their siblings are kept until they expire.
+func (bc *Blockchain) connectOrphans() {
+	for {
+		connected := false
+		for _, orphan := range bc.orphans.children(bc.GetLastBlock().Hash) {
+			if bc.AddBlock(orphan) == nil {
+				bc.orphans.remove(orphan)
+				log.Printf("Connected orphan block %d", orphan.Index)
+				connected = true
+				break
+			}
+		}
+		if !connected {
+			return
+		}
+	}
+}
+
+// fetchBlock gets the block with the given hash from the peer.
+func (bc *Blockchain) fetchBlock(peer NodePeer, hash string) (Block, error) {
+	start := time.Now()
+	response, err := peerClient.Get(peerURL(peer, "/blocks/hash/"+hash))
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return Block{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Block{}, fmt.Errorf("block status %s", response.Status)
+	}
+	var block Block
+	if err := json.NewDecoder(response.Body).Decode(&block); err != nil {
+		return Block{}, err
+	}
+	if block.Hash != hash {
+		return Block{}, fmt.Errorf("received block %s instead of %s", block.Hash, hash)
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	return block, nil
+}
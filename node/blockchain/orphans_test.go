@@ -0,0 +1,103 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOrphanPool(t *testing.T) {
+	block := func(parent string, i int) Block {
+		return Block{Hash: fmt.Sprint(parent, "-", i), PreviousHash: parent}
+	}
+	tests := []struct {
+		name         string
+		update       func(p *orphanPool)
+		wantLen      int
+		wantChildren int // orphans of "a"
+	}{
+		{name: "siblings", update: func(p *orphanPool) {
+			p.add(block("a", 1))
+			p.add(block("a", 2))
+			p.add(block("b", 1))
+		}, wantLen: 3, wantChildren: 2},
+		{name: "duplicate", update: func(p *orphanPool) {
+			p.add(block("a", 1))
+			p.add(block("a", 1))
+		}, wantLen: 1, wantChildren: 1},
+		{name: "expired", update: func(p *orphanPool) {
+			p.add(block("a", 1))
+			p.byParent["a"][0].received = time.Now().Add(-OrphanExpiry - time.Second)
+			p.add(block("b", 1))
+		}, wantLen: 1},
+		{name: "oldest evicted", update: func(p *orphanPool) {
+			p.add(block("a", 0))
+			p.byParent["a"][0].received = time.Now().Add(-time.Minute)
+			for i := 1; i <= MaxOrphans; i++ {
+				p.add(block("b", i))
+			}
+		}, wantLen: MaxOrphans},
+		{name: "removed", update: func(p *orphanPool) {
+			p.add(block("a", 1))
+			p.add(block("a", 2))
+			p.remove(block("a", 1))
+			p.remove(block("c", 1))
+		}, wantLen: 1, wantChildren: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &orphanPool{}
+			tt.update(pool)
+			if pool.Len() != tt.wantLen {
+				t.Errorf("Len() = %d, want %d", pool.Len(), tt.wantLen)
+			}
+			if children := pool.children("a"); len(children) != tt.wantChildren {
+				t.Errorf("%d children, want %d", len(children), tt.wantChildren)
+			}
+		})
+	}
+}
+
+func TestConnectOrphans(t *testing.T) {
+	bc := newPoWChain(t, 1)
+	blocks := forkChain(t, bc, 2, 3)
+	// other children of block 2, one valid and one not
+	parent := &Blockchain{Difficulty: bc.Difficulty, Chain: blocks[:3]}
+	sibling := nextBlock(parent)
+	sibling.Transactions = []Transaction{{Author: "bob", Content: "sibling", Timestamp: 3}}
+	if err := parent.ProofOfWork(&sibling); err != nil {
+		t.Fatal(err)
+	}
+	invalid := nextBlock(parent)
+	invalid.Hash = "invalid"
+
+	tests := []struct {
+		name        string
+		received    []Block
+		wantHeight  int
+		wantOrphans int
+	}{
+		{"in order", []Block{blocks[2], blocks[3], blocks[4]}, 4, 0},
+		{"out of order", []Block{blocks[4], blocks[3], blocks[2]}, 4, 0},
+		{"missing parent", []Block{blocks[4], blocks[3]}, 1, 2},
+		{"sibling kept", []Block{sibling, blocks[3], blocks[2]}, 3, 1},
+		{"invalid sibling kept", []Block{invalid, blocks[4], blocks[3], blocks[2]}, 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			for _, block := range tt.received {
+				if err := bc.AcceptBlock(block, nil); err != nil && !errors.Is(err, ErrOrphanBlock) {
+					t.Fatalf("AcceptBlock(%d) error = %v", block.Index, err)
+				}
+			}
+			if height := bc.GetLastBlock().Index; height != tt.wantHeight {
+				t.Errorf("height %d, want %d", height, tt.wantHeight)
+			}
+			if bc.orphans.Len() != tt.wantOrphans {
+				t.Errorf("%d orphans, want %d", bc.orphans.Len(), tt.wantOrphans)
+			}
+		})
+	}
+}
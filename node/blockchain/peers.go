@@ -0,0 +1,426 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Peer health settings.
+const (
+	MaxPeerFailures    = 5                // consecutive failures before a peer is removed
+	BanScore           = 100              // misbehavior score that bans a peer
+	BanDuration        = 30 * time.Minute // how long a peer stays banned
+	InvalidBlockScore  = 25               // sending an invalid block, banned after a few
+	PeerRequestTimeout = 10 * time.Second
+	PeerResolveTTL     = 5 * time.Minute // how long the resolved IPs of a peer host are kept
+)
+
+// ErrSelfConnection is returned when a node tries to add itself as a peer.
+var ErrSelfConnection = errors.New("connection to self")
+
+// peerClient is used for all requests to peers.
+var peerClient = &http.Client{Timeout: PeerRequestTimeout}
+
+// PeerManager holds the known peers with their health and ban state, and the addresses
+// learnt by peer exchange. They are saved to an address book file that survives restarts.
+type PeerManager struct {
+	NodeID        string // random id of this node process
+	AdvertiseAddr string // public address of this node
+	file          string
+	peers         []NodePeer
+	addresses     map[string]bool
+	mu            sync.Mutex
+	resolved      map[string]resolvedHost // IPs of the peer hosts
+	resolveMu     sync.Mutex
+}
+
+// resolvedHost holds the IPs a host name resolved to.
+type resolvedHost struct {
+	ips     []string
+	expires time.Time
+}
+
+// addressBook is the on-disk form of the peer manager.
+type addressBook struct {
+	Peers     []NodePeer `json:"peers"`
+	Addresses []string   `json:"addresses"`
+}
+
+// NewPeerManager creates a peer manager with a new node id, loading the address book
+// from file if it exists. An empty file name keeps the peers in memory only.
+func NewPeerManager(file string) (*PeerManager, error) {
+	pm := &PeerManager{NodeID: NewNodeID(), file: file}
+	if file == "" {
+		return pm, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return pm, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var book addressBook
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, fmt.Errorf("address book %s: %v", file, err)
+	}
+	//normalize and deduplicate saved peers
+	for _, peer := range book.Peers {
+		if err := pm.AddNodePeer(&peer); err != nil {
+			log.Printf("Dropped saved peer %s: %v", peer.NodeAddress, err)
+		}
+	}
+	pm.AddAddresses(book.Addresses)
+	return pm, nil
+}
+
+// Save writes the address book file.
+func (pm *PeerManager) Save() error {
+	if pm.file == "" {
+		return nil
+	}
+	pm.mu.Lock()
+	book := addressBook{Peers: append([]NodePeer{}, pm.peers...), Addresses: []string{}}
+	for address := range pm.addresses {
+		book.Addresses = append(book.Addresses, address)
+	}
+	pm.mu.Unlock()
+	sort.Strings(book.Addresses)
+	data, err := json.MarshalIndent(book, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(pm.file, data, 0644)
+}
+
+// Headers identifying the node sending a message: its node id (as sent in its handshake)
+// and its advertised address.
+const (
+	NodeIDHeader      = "X-Node-ID"
+	NodeAddressHeader = "X-Node-Address"
+)
+
+// postToPeer posts a JSON message to a peer url, identifying this node by its node id and advertised address.
+func (pm *PeerManager) postToPeer(url string, data []byte) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if pm.NodeID != "" {
+		request.Header.Set(NodeIDHeader, pm.NodeID)
+	}
+	if pm.AdvertiseAddr != "" {
+		request.Header.Set(NodeAddressHeader, pm.AdvertiseAddr)
+	}
+	return peerClient.Do(request)
+}
+
+// PeerList returns a copy of the known peers.
+func (pm *PeerManager) PeerList() []NodePeer {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return append([]NodePeer{}, pm.peers...)
+}
+
+// ActivePeers returns the peers that are not banned.
+func (pm *PeerManager) ActivePeers() []NodePeer {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	peers := []NodePeer{}
+	now := time.Now().Unix()
+	for _, peer := range pm.peers {
+		if peer.BannedUntil <= now {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// SetPeers replaces the known peers.
+func (pm *PeerManager) SetPeers(peers []NodePeer) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.peers = peers
+}
+
+// AddNodePeer adds the peer with its address normalized, known peers (same address)
+// are updated with the new handshake metadata, keeping their health state.
+func (pm *PeerManager) AddNodePeer(node *NodePeer) error {
+	address, err := NormalizeAddress(node.NodeAddress)
+	if err != nil {
+		return err
+	}
+	if (node.NodeID != "" && node.NodeID == pm.NodeID) || address == pm.AdvertiseAddr {
+		return ErrSelfConnection
+	}
+	node.NodeAddress = address
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for i := range pm.peers {
+		if pm.peers[i].NodeAddress == address {
+			if node.Version != 0 {
+				pm.peers[i].NodeID = node.NodeID
+				pm.peers[i].Version = node.Version
+				pm.peers[i].NetworkID = node.NetworkID
+				pm.peers[i].GenesisHash = node.GenesisHash
+				pm.peers[i].BestHeight = node.BestHeight
+				pm.peers[i].BestHash = node.BestHash
+				pm.peers[i].CumulativeWork = node.CumulativeWork
+			}
+			return nil
+		}
+	}
+	pm.peers = append(pm.peers, *node)
+	return nil
+}
+
+// RemovePeer forgets the peer with the given address.
+func (pm *PeerManager) RemovePeer(address string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	peers := pm.peers[:0]
+	for _, peer := range pm.peers {
+		if peer.NodeAddress != address {
+			peers = append(peers, peer)
+		}
+	}
+	pm.peers = peers
+}
+
+// NewNodeID returns a random identifier used to detect connections to ourself.
+func NewNodeID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// updatePeer applies update to the peer with the given address (under lock).
+func (pm *PeerManager) updatePeer(address string, update func(peer *NodePeer)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for i := range pm.peers {
+		if pm.peers[i].NodeAddress == address {
+			update(&pm.peers[i])
+		}
+	}
+}
+
+// PeerSucceeded records a successful request to the peer and its latency.
+func (pm *PeerManager) PeerSucceeded(address string, latency time.Duration) {
+	pm.updatePeer(address, func(peer *NodePeer) {
+		peer.LastSeen = time.Now().Unix()
+		peer.LatencyMs = latency.Milliseconds()
+		peer.Failures = 0
+	})
+}
+
+// PeerFailed records a failed request to the peer, removing it after MaxPeerFailures consecutive failures.
+func (pm *PeerManager) PeerFailed(address string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	peers := pm.peers[:0]
+	for _, peer := range pm.peers {
+		if peer.NodeAddress == address {
+			peer.Failures++
+			if peer.Failures >= MaxPeerFailures {
+				log.Printf("Removing unreachable node %s", address)
+				continue
+			}
+		}
+		peers = append(peers, peer)
+	}
+	pm.peers = peers
+}
+
+// Misbehaving raises the misbehavior score of the peer, banning it for BanDuration
+// once the score reaches BanScore.
+func (pm *PeerManager) Misbehaving(address string, score int, reason string) {
+	pm.updatePeer(address, func(peer *NodePeer) {
+		peer.Score += score
+		log.Printf("Node %s misbehaving (%s), score %d", address, reason, peer.Score)
+		if peer.Score >= BanScore {
+			peer.BannedUntil = time.Now().Add(BanDuration).Unix()
+			peer.Score = 0
+			log.Printf("Banned node %s until %s", address, time.Unix(peer.BannedUntil, 0))
+		}
+	})
+}
+
+// BlockScore returns the misbehavior score of a peer sending a block rejected with err:
+// a forged seal (bad proof of work or signature) bans the peer at once, other invalid
+// blocks score InvalidBlockScore.
+func BlockScore(err error) int {
+	if errors.Is(err, ErrForgedSeal) {
+		return BanScore
+	}
+	return InvalidBlockScore
+}
+
+// IsBanned reports if the peer with the given address is banned.
+func (pm *PeerManager) IsBanned(address string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for _, peer := range pm.peers {
+		if peer.NodeAddress == address && peer.BannedUntil > time.Now().Unix() {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerForRequest finds the peer a request came from, among the known peers whose host
+// matches the request remote IP: the peer with the node id sent by the sender (NodeIDHeader),
+// else the peer with the address it claims (NodeAddressHeader), else the only peer on that IP.
+// When several peers share the IP and none is identified, no peer is returned so that
+// none of them is blamed for a message of another.
+func (pm *PeerManager) PeerForRequest(remoteAddr string, nodeID string, claimedAddress string) (NodePeer, bool) {
+	remoteIP, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		remoteIP = remoteAddr
+	}
+	claimedAddress, _ = NormalizeAddress(claimedAddress)
+	candidates := []NodePeer{}
+	for _, peer := range pm.PeerList() {
+		if pm.peerHasIP(peer, remoteIP) {
+			candidates = append(candidates, peer)
+		}
+	}
+	for _, peer := range candidates {
+		if nodeID != "" && peer.NodeID == nodeID {
+			return peer, true
+		}
+	}
+	for _, peer := range candidates {
+		if claimedAddress != "" && peer.NodeAddress == claimedAddress {
+			return peer, true
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return NodePeer{}, false
+}
+
+// peerHasIP reports if the (resolved) host of the peer address is ip.
+func (pm *PeerManager) peerHasIP(peer NodePeer, ip string) bool {
+	address, err := ParsePeerAddress(peer.NodeAddress)
+	if err != nil {
+		return false
+	}
+	host := address.Host
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+	if host == ip {
+		return true
+	}
+	for _, addr := range pm.resolveHost(host) {
+		if addr == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHost returns the IPs of host, looked up at most once per PeerResolveTTL.
+func (pm *PeerManager) resolveHost(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	now := time.Now()
+	pm.resolveMu.Lock()
+	cached, ok := pm.resolved[host]
+	pm.resolveMu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.ips
+	}
+	// failed lookups are cached too, unreachable hosts would be looked up on every request
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		log.Printf("Failed to resolve node host %s: %v", host, err)
+	}
+	pm.resolveMu.Lock()
+	defer pm.resolveMu.Unlock()
+	if pm.resolved == nil {
+		pm.resolved = map[string]resolvedHost{}
+	}
+	for name, entry := range pm.resolved {
+		if !now.Before(entry.expires) {
+			delete(pm.resolved, name)
+		}
+	}
+	pm.resolved[host] = resolvedHost{ips: ips, expires: now.Add(PeerResolveTTL)}
+	return ips
+}
+
+// peerURL returns the url of path on the peer.
+func peerURL(peer NodePeer, path string) string {
+	address, err := ParsePeerAddress(peer.NodeAddress)
+	if err != nil {
+		return peer.NodeAddress + path
+	}
+	return address.URL(path)
+}
+
+// RefreshPeer exchanges handshakes with the peer, updating its metadata and health.
+// A peer that is no longer compatible (other network, genesis or protocol version) or
+// turns out to be ourselves is removed.
+func (bc *Blockchain) RefreshPeer(peer NodePeer) error {
+	payload, err := json.Marshal(bc.Handshake(bc.Peers.AdvertiseAddr))
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	response, err := bc.Peers.postToPeer(peerURL(peer, "/handshake"), payload)
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return fmt.Errorf("handshake status %s", response.Status)
+	}
+	var handshake Handshake
+	if err := json.NewDecoder(response.Body).Decode(&handshake); err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return err
+	}
+	if err := bc.CheckHandshake(handshake); err != nil {
+		bc.Peers.RemovePeer(peer.NodeAddress)
+		return err
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	bc.Peers.updatePeer(peer.NodeAddress, func(p *NodePeer) {
+		p.NodeID = handshake.NodeID
+		p.Version = handshake.Version
+		p.NetworkID = handshake.NetworkID
+		p.GenesisHash = handshake.GenesisHash
+		p.BestHeight = handshake.BestHeight
+		p.BestHash = handshake.BestHash
+		p.CumulativeWork = handshake.CumulativeWork
+	})
+	return nil
+}
+
+// RefreshPeers exchanges handshakes with every active peer.
+func (bc *Blockchain) RefreshPeers() {
+	for _, peer := range bc.Peers.ActivePeers() {
+		if err := bc.RefreshPeer(peer); err != nil {
+			log.Printf("Failed handshake with node %s: %v", peer.NodeAddress, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package blockchain
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerForRequest(t *testing.T) {
+	peers := []NodePeer{
+		{NodeAddress: "http://10.0.0.1:8000", NodeID: "a"},
+		{NodeAddress: "http://10.0.0.1:8001", NodeID: "b"},
+		{NodeAddress: "http://10.0.0.2:8000", NodeID: "c"},
+		{NodeAddress: "http://node-d.test:8000", NodeID: "d"},
+	}
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		nodeID         string
+		claimedAddress string
+		want           string // address of the sender, empty if unknown
+	}{
+		{name: "only peer on ip", remoteAddr: "10.0.0.2:50000", want: "http://10.0.0.2:8000"},
+		{name: "node id", remoteAddr: "10.0.0.1:50000", nodeID: "b", want: "http://10.0.0.1:8001"},
+		{name: "claimed address", remoteAddr: "10.0.0.1:50000", claimedAddress: "10.0.0.1:8001", want: "http://10.0.0.1:8001"},
+		{name: "node id before address", remoteAddr: "10.0.0.1:50000", nodeID: "a", claimedAddress: "10.0.0.1:8001", want: "http://10.0.0.1:8000"},
+		{name: "ambiguous ip", remoteAddr: "10.0.0.1:50000"},
+		{name: "unknown node id on shared ip", remoteAddr: "10.0.0.1:50000", nodeID: "z"},
+		{name: "node id from another ip", remoteAddr: "10.0.0.2:50000", nodeID: "a", want: "http://10.0.0.2:8000"},
+		{name: "claimed address from another ip", remoteAddr: "10.0.0.9:50000", claimedAddress: "10.0.0.1:8000"},
+		{name: "resolved host", remoteAddr: "10.0.0.4:50000", want: "http://node-d.test:8000"},
+		{name: "unknown ip", remoteAddr: "10.0.0.9:50000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &PeerManager{NodeID: "self"}
+			pm.SetPeers(append([]NodePeer{}, peers...))
+			pm.resolved = map[string]resolvedHost{
+				"node-d.test": {ips: []string{"10.0.0.4"}, expires: time.Now().Add(time.Minute)},
+			}
+			peer, known := pm.PeerForRequest(tt.remoteAddr, tt.nodeID, tt.claimedAddress)
+			if known != (tt.want != "") || peer.NodeAddress != tt.want {
+				t.Errorf("PeerForRequest() = %q %v, want %q", peer.NodeAddress, known, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHost(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		cached *resolvedHost
+		want   []string
+	}{
+		{name: "ip", host: "10.0.0.1", want: []string{"10.0.0.1"}},
+		{name: "cached", host: "node.test", cached: &resolvedHost{ips: []string{"10.0.0.5"}, expires: time.Now().Add(time.Minute)}, want: []string{"10.0.0.5"}},
+		{name: "cached failure", host: "node.test", cached: &resolvedHost{expires: time.Now().Add(time.Minute)}, want: nil},
+		{name: "expired", host: "unknown.invalid", cached: &resolvedHost{ips: []string{"10.0.0.5"}, expires: time.Now().Add(-time.Minute)}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &PeerManager{}
+			if tt.cached != nil {
+				pm.resolved = map[string]resolvedHost{tt.host: *tt.cached}
+			}
+			got := pm.resolveHost(tt.host)
+			if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+				t.Errorf("resolveHost(%s) = %v, want %v", tt.host, got, tt.want)
+			}
+			if tt.cached != nil {
+				if entry := pm.resolved[tt.host]; !time.Now().Before(entry.expires) {
+					t.Errorf("lookup of %s not cached", tt.host)
+				}
+			}
+		})
+	}
+}
+
+func TestPeerScoring(t *testing.T) {
+	const address = "http://10.0.0.1:8000"
+	tests := []struct {
+		name        string
+		update      func(pm *PeerManager)
+		wantKnown   bool
+		wantBanned  bool
+		wantScore   int
+		wantFailure int
+	}{
+		{name: "misbehaving", update: func(pm *PeerManager) {
+			pm.Misbehaving(address, 40, "test")
+		}, wantKnown: true, wantScore: 40},
+		{name: "banned at score", update: func(pm *PeerManager) {
+			pm.Misbehaving(address, 60, "test")
+			pm.Misbehaving(address, 40, "test")
+		}, wantKnown: true, wantBanned: true},
+		{name: "invalid block", update: func(pm *PeerManager) {
+			pm.Misbehaving(address, BlockScore(ErrBlockIndex), "test")
+		}, wantKnown: true, wantScore: InvalidBlockScore},
+		{name: "invalid blocks", update: func(pm *PeerManager) {
+			for i := 0; i < BanScore/InvalidBlockScore; i++ {
+				pm.Misbehaving(address, BlockScore(ErrBlockIndex), "test")
+			}
+		}, wantKnown: true, wantBanned: true},
+		{name: "forged block", update: func(pm *PeerManager) {
+			pm.Misbehaving(address, BlockScore(fmt.Errorf("block proof invalid: %w", ErrForgedSeal)), "test")
+		}, wantKnown: true, wantBanned: true},
+		{name: "failures", update: func(pm *PeerManager) {
+			for i := 0; i < MaxPeerFailures-1; i++ {
+				pm.PeerFailed(address)
+			}
+		}, wantKnown: true, wantFailure: MaxPeerFailures - 1},
+		{name: "success resets failures", update: func(pm *PeerManager) {
+			pm.PeerFailed(address)
+			pm.PeerSucceeded(address, time.Millisecond)
+		}, wantKnown: true},
+		{name: "removed after max failures", update: func(pm *PeerManager) {
+			for i := 0; i < MaxPeerFailures; i++ {
+				pm.PeerFailed(address)
+			}
+		}},
+		{name: "other peer", update: func(pm *PeerManager) {
+			pm.Misbehaving("http://10.0.0.2:8000", BanScore, "test")
+			pm.PeerFailed("http://10.0.0.2:8000")
+		}, wantKnown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := &PeerManager{NodeID: "self"}
+			if err := pm.AddNodePeer(&NodePeer{NodeAddress: address}); err != nil {
+				t.Fatal(err)
+			}
+			tt.update(pm)
+			peers := pm.PeerList()
+			if (len(peers) == 1) != tt.wantKnown {
+				t.Fatalf("peers %+v, want known %v", peers, tt.wantKnown)
+			}
+			if pm.IsBanned(address) != tt.wantBanned {
+				t.Errorf("IsBanned() = %v, want %v", pm.IsBanned(address), tt.wantBanned)
+			}
+			if tt.wantKnown && (peers[0].Score != tt.wantScore || peers[0].Failures != tt.wantFailure) {
+				t.Errorf("score %d failures %d, want %d %d", peers[0].Score, peers[0].Failures, tt.wantScore, tt.wantFailure)
+			}
+			if active := len(pm.ActivePeers()); tt.wantKnown && (active == 0) != tt.wantBanned {
+				t.Errorf("%d active peers, banned %v", active, tt.wantBanned)
+			}
+		})
+	}
+}
+
+func TestBlockScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, bc *Blockchain, block *Block)
+		want   int
+	}{
+		{"hash mismatch", func(t *testing.T, bc *Blockchain, block *Block) {
+			block.Transactions = []Transaction{{Author: "mallory", Content: "forged"}}
+		}, BanScore},
+		{"difficulty not met", func(t *testing.T, bc *Blockchain, block *Block) {
+			bc.Difficulty = 64
+		}, BanScore},
+		{"wrong index", func(t *testing.T, bc *Blockchain, block *Block) {
+			block.Index, block.Hash = block.Index+1, ""
+			if err := bc.ProofOfWork(block); err != nil {
+				t.Fatal(err)
+			}
+		}, InvalidBlockScore},
+		{"conflicts with checkpoint", func(t *testing.T, bc *Blockchain, block *Block) {
+			bc.Checkpoints = map[int]string{block.Index: "other"}
+		}, InvalidBlockScore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 1)
+			block := nextBlock(bc)
+			if err := bc.ProofOfWork(&block); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(t, bc, &block)
+			err := bc.AddBlock(block)
+			if err == nil {
+				t.Fatal("AddBlock() accepted the block")
+			}
+			if score := BlockScore(err); score != tt.want {
+				t.Errorf("BlockScore(%v) = %d, want %d", err, score, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerManagerSave(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string // address book file, none if empty
+		wantErr       bool
+		wantPeers     []string
+		wantAddresses []string
+	}{
+		{name: "no file", wantPeers: []string{}, wantAddresses: []string{}},
+		{name: "saved peers", content: `{"peers":[{"node_address":"127.0.0.1:8001","score":20,"banned_until":99}],"addresses":["127.0.0.1:8002"]}`,
+			wantPeers: []string{"http://127.0.0.1:8001"}, wantAddresses: []string{"http://127.0.0.1:8002"}},
+		{name: "deduplicated", content: `{"peers":[{"node_address":"127.0.0.1:8001"},{"node_address":"http://127.0.0.1:8001/"},{"node_address":"ftp://x"}],"addresses":["127.0.0.1:8001"]}`,
+			wantPeers: []string{"http://127.0.0.1:8001"}, wantAddresses: []string{}},
+		{name: "invalid file", content: `{"peers":`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "peers.json")
+			if tt.content != "" {
+				if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pm, err := NewPeerManager(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPeerManager() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// saved and loaded again, with health state
+			if err := pm.Save(); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := NewPeerManager(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.NodeID == pm.NodeID {
+				t.Error("node id reused after restart")
+			}
+			peers := []string{}
+			for _, peer := range loaded.PeerList() {
+				peers = append(peers, peer.NodeAddress)
+			}
+			if !reflect.DeepEqual(peers, tt.wantPeers) {
+				t.Errorf("peers %v, want %v", peers, tt.wantPeers)
+			}
+			if got := loaded.KnownAddresses(); !reflect.DeepEqual(got, tt.wantAddresses) {
+				t.Errorf("addresses %v, want %v", got, tt.wantAddresses)
+			}
+			if !reflect.DeepEqual(loaded.PeerList(), pm.PeerList()) {
+				t.Errorf("loaded peers %+v, want %+v", loaded.PeerList(), pm.PeerList())
+			}
+		})
+	}
+}
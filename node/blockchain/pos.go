@@ -0,0 +1,295 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSlotDuration is the slot length in seconds used when none is configured.
+const DefaultSlotDuration = 5
+
+// MaxCachedLedgers is the number of ledgers kept by the PoS engine, by block hash.
+const MaxCachedLedgers = 128
+
+// Ledger holds account balances and locked stakes derived from the chain.
+type Ledger struct {
+	Balances map[string]int64 `json:"balances"`
+	Stakes   map[string]int64 `json:"stakes"`
+	applied  map[string]bool  // signatures of applied transactions, prevents replays
+}
+
+// NewLedger creates a ledger from initial balances and locked stakes.
+func NewLedger(allocations map[string]int64, stakes map[string]int64) *Ledger {
+	ledger := &Ledger{
+		Balances: map[string]int64{},
+		Stakes:   map[string]int64{},
+		applied:  map[string]bool{},
+	}
+	for account, amount := range allocations {
+		ledger.Balances[account] = amount
+	}
+	for account, amount := range stakes {
+		ledger.Stakes[account] = amount
+	}
+	return ledger
+}
+
+// Apply applies a single transaction to the ledger.
+// Posts do not change the ledger, stake transactions lock part of the author balance.
+func (l *Ledger) Apply(tx Transaction) error {
+	if tx.Type != TxTypeStake {
+		return nil
+	}
+	if err := tx.Validate(); err != nil {
+		return err
+	}
+	if l.applied[tx.Signature] {
+		return fmt.Errorf("stake transaction already applied")
+	}
+	if l.Balances[tx.Author] < tx.Amount {
+		return fmt.Errorf("insufficient balance to stake %d", tx.Amount)
+	}
+	l.Balances[tx.Author] -= tx.Amount
+	l.Stakes[tx.Author] += tx.Amount
+	l.applied[tx.Signature] = true
+	return nil
+}
+
+// ApplyBlock applies the block transactions. A block with an invalid stake
+// transaction is invalid, the ledger is then left unchanged.
+func (l *Ledger) ApplyBlock(block Block) error {
+	next := l.Copy()
+	for _, tx := range block.Transactions {
+		if err := next.Apply(tx); err != nil {
+			return err
+		}
+	}
+	*l = *next
+	return nil
+}
+
+// Copy returns a copy of the ledger.
+func (l *Ledger) Copy() *Ledger {
+	ledger := NewLedger(l.Balances, l.Stakes)
+	for signature := range l.applied {
+		ledger.applied[signature] = true
+	}
+	return ledger
+}
+
+// TotalStake returns the sum of all locked stakes.
+func (l *Ledger) TotalStake() int64 {
+	var total int64
+	for _, amount := range l.Stakes {
+		total += amount
+	}
+	return total
+}
+
+// ProofOfStakeEngine seals blocks by signature of a leader chosen per time slot,
+// with probability proportional to the stake locked on the chain.
+type ProofOfStakeEngine struct {
+	Allocations  map[string]int64
+	Stakes       map[string]int64
+	SlotDuration int64
+	key          ed25519.PrivateKey
+	ledgers      map[string]*Ledger // ledger after a block, by block hash
+	ledgerOrder  []string           // cached block hashes, oldest first
+	ledgerMu     sync.Mutex
+}
+
+// NewProofOfStakeEngine creates a PoS engine from the genesis balances and stakes,
+// and an optional hex encoded private key used to seal blocks on this node.
+func NewProofOfStakeEngine(allocations map[string]int64, stakes map[string]int64, slotDuration int64, privateKey string) (*ProofOfStakeEngine, error) {
+	if slotDuration <= 0 {
+		slotDuration = DefaultSlotDuration
+	}
+	engine := &ProofOfStakeEngine{
+		Allocations:  allocations,
+		Stakes:       stakes,
+		SlotDuration: slotDuration,
+	}
+	if NewLedger(allocations, stakes).TotalStake() <= 0 {
+		return nil, fmt.Errorf("pos: no initial stake")
+	}
+	if privateKey != "" {
+		key, err := ParsePrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		engine.key = key
+	}
+	return engine, nil
+}
+
+func (e *ProofOfStakeEngine) Name() string {
+	return ConsensusPoS
+}
+
+// Ledger returns the ledger at the end of the given chain. It starts from the
+// ledger cached for the last known block (or the genesis balances and stakes) and
+// applies the following blocks, so extending a chain applies only the new blocks.
+func (e *ProofOfStakeEngine) Ledger(chain []Block) *Ledger {
+	e.ledgerMu.Lock()
+	defer e.ledgerMu.Unlock()
+	start := len(chain)
+	var ledger *Ledger
+	for ; start > 0; start-- {
+		if cached, ok := e.ledgers[chain[start-1].Hash]; ok {
+			ledger = cached.Copy()
+			break
+		}
+	}
+	if ledger == nil {
+		ledger = NewLedger(e.Allocations, e.Stakes)
+	}
+	if start == len(chain) {
+		return ledger
+	}
+	for _, block := range chain[start:] {
+		// blocks of the chain were verified when added
+		if err := ledger.ApplyBlock(block); err != nil {
+			log.Printf("Ledger skipped block %d: %v", block.Index, err)
+		}
+	}
+	e.cacheLedger(chain[len(chain)-1].Hash, ledger.Copy())
+	return ledger
+}
+
+// cacheLedger keeps the ledger after the block with hash, dropping the oldest
+// ledger when the cache is full (under lock).
+func (e *ProofOfStakeEngine) cacheLedger(hash string, ledger *Ledger) {
+	if e.ledgers == nil {
+		e.ledgers = map[string]*Ledger{}
+	}
+	if _, ok := e.ledgers[hash]; !ok {
+		e.ledgerOrder = append(e.ledgerOrder, hash)
+	}
+	e.ledgers[hash] = ledger
+	if len(e.ledgerOrder) > MaxCachedLedgers {
+		delete(e.ledgers, e.ledgerOrder[0])
+		e.ledgerOrder = e.ledgerOrder[1:]
+	}
+}
+
+// Slot returns the slot number of a unix timestamp.
+func (e *ProofOfStakeEngine) Slot(timestamp int64) int64 {
+	return timestamp / e.SlotDuration
+}
+
+// Leader returns the account allowed to seal the block at slot on top of parents.
+// The choice is deterministic: a seed derived from the parent hash and the slot
+// picks a position in the stake distribution ordered by account.
+func (e *ProofOfStakeEngine) Leader(parents []Block, slot int64) (string, error) {
+	return e.leader(e.Ledger(parents), parents, slot)
+}
+
+// leader picks the slot leader from the ledger at the end of parents.
+func (e *ProofOfStakeEngine) leader(ledger *Ledger, parents []Block, slot int64) (string, error) {
+	total := ledger.TotalStake()
+	if total <= 0 {
+		return "", fmt.Errorf("pos: no stake locked")
+	}
+	accounts := make([]string, 0, len(ledger.Stakes))
+	for account, amount := range ledger.Stakes {
+		if amount > 0 {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Strings(accounts)
+
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", parents[len(parents)-1].Hash, slot)))
+	target := int64(binary.BigEndian.Uint64(seed[:8]) % uint64(total))
+	for _, account := range accounts {
+		target -= ledger.Stakes[account]
+		if target < 0 {
+			return account, nil
+		}
+	}
+	return accounts[len(accounts)-1], nil
+}
+
+func (e *ProofOfStakeEngine) Seal(bc *Blockchain, parents []Block, block *Block) error {
+	if e.key == nil {
+		return fmt.Errorf("pos: node has no validator key")
+	}
+	slot := e.Slot(block.Timestamp)
+	if slot <= e.Slot(parents[len(parents)-1].Timestamp) {
+		return ErrNotInTurn // a block was already sealed in this slot
+	}
+	ledger := e.Ledger(parents)
+	leader, err := e.leader(ledger, parents, slot)
+	if err != nil {
+		return err
+	}
+	if leader != hex.EncodeToString(e.key.Public().(ed25519.PublicKey)) {
+		return ErrNotInTurn
+	}
+	// stake transactions that can't be applied (e.g. insufficient balance) are left out
+	transactions := []Transaction{}
+	for _, tx := range block.Transactions {
+		if err := ledger.Apply(tx); err != nil {
+			log.Printf("Dropped transaction from block %d: %v", block.Index, err)
+			continue
+		}
+		transactions = append(transactions, tx)
+	}
+	block.Transactions = transactions
+	return SignBlock(block, e.key)
+}
+
+func (e *ProofOfStakeEngine) VerifySeal(bc *Blockchain, parents []Block, block Block) error {
+	slot := e.Slot(block.Timestamp)
+	if slot <= e.Slot(parents[len(parents)-1].Timestamp) {
+		return fmt.Errorf("pos: block %d slot is not after its parent", block.Index)
+	}
+	if block.Timestamp > time.Now().Unix()+e.SlotDuration {
+		return fmt.Errorf("pos: block %d slot is in the future", block.Index)
+	}
+	ledger := e.Ledger(parents)
+	leader, err := e.leader(ledger, parents, slot)
+	if err != nil {
+		return err
+	}
+	if block.Validator != leader {
+		return fmt.Errorf("pos: block %d not sealed by slot leader", block.Index)
+	}
+	if err := VerifyBlockSignature(block); err != nil {
+		return err
+	}
+	if err := ledger.ApplyBlock(block); err != nil {
+		return fmt.Errorf("pos: block %d has an invalid transaction: %v", block.Index, err)
+	}
+	// the ledger after the block, for the blocks built on it
+	e.ledgerMu.Lock()
+	e.cacheLedger(block.Hash, ledger)
+	e.ledgerMu.Unlock()
+	return nil
+}
+
+// CheckTransaction checks a new transaction can be mined on top of our chain. On a
+// proof of stake chain, a stake transaction must apply to the ledger at our tip after
+// the pending stake transactions.
+func (bc *Blockchain) CheckTransaction(tx Transaction) error {
+	engine, ok := bc.ConsensusEngine().(*ProofOfStakeEngine)
+	if !ok || tx.Type != TxTypeStake {
+		return nil
+	}
+	bc.mu.RLock()
+	chain := bc.Chain[:len(bc.Chain):len(bc.Chain)]
+	pending := append([]Transaction{}, bc.UnconfirmedTransactions...)
+	bc.mu.RUnlock()
+	ledger := engine.Ledger(chain)
+	for _, pendingTx := range pending {
+		// pending transactions that don't apply are dropped when sealing
+		ledger.Apply(pendingTx)
+	}
+	return ledger.Apply(tx)
+}
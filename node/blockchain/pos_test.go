@@ -0,0 +1,259 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// stakeTx returns a stake transaction of amount signed by key.
+func stakeTx(t *testing.T, key ed25519.PrivateKey, amount int64, timestamp int64) Transaction {
+	t.Helper()
+	tx := Transaction{Type: TxTypeStake, Amount: amount, Timestamp: timestamp}
+	if err := SignTransaction(&tx, key); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// newPoSChain returns a chain with a PoS engine where key holds all the stake.
+func newPoSChain(t *testing.T, key ed25519.PrivateKey, balance int64) (*Blockchain, *ProofOfStakeEngine) {
+	t.Helper()
+	account := testPublicKey(key)
+	engine, err := NewProofOfStakeEngine(map[string]int64{account: balance}, map[string]int64{account: 10}, 1, hex.EncodeToString(key.Seed()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.SetEngine(engine)
+	return bc, engine
+}
+
+func TestLedgerApply(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	applied := stakeTx(t, alice, 5, 1)
+	forged := stakeTx(t, alice, 5, 2)
+	forged.Amount = 50
+
+	tests := []struct {
+		name    string
+		tx      Transaction
+		wantErr bool
+		balance int64 // alice balance after
+		stake   int64 // alice stake after
+	}{
+		{"post", Transaction{Author: "alice", Content: "hello"}, false, 100, 5},
+		{"stake", stakeTx(t, alice, 30, 3), false, 70, 35},
+		{"whole balance", stakeTx(t, alice, 100, 3), false, 0, 105},
+		{"insufficient balance", stakeTx(t, alice, 101, 3), true, 100, 5},
+		{"replay", applied, true, 100, 5},
+		{"forged amount", forged, true, 100, 5},
+		{"no balance", stakeTx(t, bob, 1, 3), true, 100, 5},
+		{"zero amount", Transaction{Type: TxTypeStake, Author: testPublicKey(alice)}, true, 100, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := testPublicKey(alice)
+			ledger := NewLedger(map[string]int64{account: 105}, nil)
+			if err := ledger.Apply(applied); err != nil {
+				t.Fatal(err)
+			}
+			err := ledger.Apply(tt.tx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ledger.Balances[account] != tt.balance || ledger.Stakes[account] != tt.stake {
+				t.Errorf("balance %d stake %d, want %d %d", ledger.Balances[account], ledger.Stakes[account], tt.balance, tt.stake)
+			}
+		})
+	}
+}
+
+func TestLedgerApplyBlock(t *testing.T) {
+	alice := testKey(1)
+	account := testPublicKey(alice)
+	tests := []struct {
+		name    string
+		txs     []Transaction
+		wantErr bool
+		balance int64
+	}{
+		{"valid", []Transaction{stakeTx(t, alice, 10, 1), stakeTx(t, alice, 20, 2)}, false, 70},
+		{"invalid last", []Transaction{stakeTx(t, alice, 10, 1), stakeTx(t, alice, 200, 2)}, true, 100},
+		{"same tx twice", []Transaction{stakeTx(t, alice, 10, 1), stakeTx(t, alice, 10, 1)}, true, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewLedger(map[string]int64{account: 100}, nil)
+			err := ledger.ApplyBlock(Block{Transactions: tt.txs})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ledger.Balances[account] != tt.balance {
+				t.Errorf("balance %d, want %d", ledger.Balances[account], tt.balance)
+			}
+		})
+	}
+}
+
+func TestProofOfStakeVerifySeal(t *testing.T) {
+	alice := testKey(1)
+	tests := []struct {
+		name    string
+		txs     []Transaction
+		wantErr bool
+	}{
+		{"post", []Transaction{{Author: "alice", Content: "hello"}}, false},
+		{"valid stake", []Transaction{stakeTx(t, alice, 50, 1)}, false},
+		{"insufficient balance", []Transaction{stakeTx(t, alice, 500, 1)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, engine := newPoSChain(t, alice, 100)
+			block := Block{Index: 1, Transactions: tt.txs, Timestamp: 1, PreviousHash: bc.GetLastBlock().Hash}
+			// sign without Seal, which leaves invalid transactions out
+			if err := SignBlock(&block, alice); err != nil {
+				t.Fatal(err)
+			}
+			err := engine.VerifySeal(bc, bc.Chain, block)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySeal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProofOfStakeSealDropsInvalidStake(t *testing.T) {
+	alice := testKey(1)
+	bc, engine := newPoSChain(t, alice, 100)
+	valid := stakeTx(t, alice, 60, 1)
+	block := Block{
+		Index:        1,
+		Transactions: []Transaction{valid, stakeTx(t, alice, 60, 2)},
+		Timestamp:    1,
+		PreviousHash: bc.GetLastBlock().Hash,
+	}
+	if err := engine.Seal(bc, bc.Chain, &block); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(block.Transactions, []Transaction{valid}) {
+		t.Errorf("sealed transactions %+v, want only the first stake", block.Transactions)
+	}
+	if err := bc.AddBlock(block); err != nil {
+		t.Errorf("AddBlock: %v", err)
+	}
+}
+
+func TestMineBlockDropsInvalidStake(t *testing.T) {
+	alice := testKey(1)
+	tests := []struct {
+		name       string
+		amounts    []int64 // stakes pending, of a balance of 100
+		wantMined  bool
+		wantHeight int
+		wantTxs    int
+	}{
+		{"valid", []int64{60}, true, 1, 1},
+		{"over balance after valid", []int64{60, 60}, true, 1, 1},
+		{"only over balance", []int64{200}, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, _ := newPoSChain(t, alice, 100)
+			for i, amount := range tt.amounts {
+				tx := stakeTx(t, alice, amount, int64(i+1))
+				bc.AddNewTransaction(&tx)
+			}
+			mined, err := bc.MineBlock()
+			if err != nil || mined != tt.wantMined {
+				t.Fatalf("MineBlock() = %v, %v, want %v", mined, err, tt.wantMined)
+			}
+			if last := bc.GetLastBlock(); last.Index != tt.wantHeight || len(last.Transactions) != tt.wantTxs {
+				t.Errorf("last block %d with %d transactions, want %d with %d", last.Index, len(last.Transactions), tt.wantHeight, tt.wantTxs)
+			}
+			if pending := bc.PendingTransactions(); len(pending) != 0 {
+				t.Errorf("%d pending transactions after mining, want none", len(pending))
+			}
+		})
+	}
+}
+
+func TestCheckTransaction(t *testing.T) {
+	alice := testKey(1)
+	pending := stakeTx(t, alice, 60, 1)
+	tests := []struct {
+		name    string
+		pos     bool
+		tx      Transaction
+		wantErr bool
+	}{
+		{"post", true, Transaction{Author: "alice", Content: "hello"}, false},
+		{"stake", true, stakeTx(t, alice, 40, 2), false},
+		{"over balance with pending", true, stakeTx(t, alice, 50, 2), true},
+		{"pending again", true, pending, true},
+		{"proof of work", false, stakeTx(t, alice, 500, 2), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc, _ := newPoSChain(t, alice, 100)
+			if !tt.pos {
+				bc.SetEngine(&ProofOfWorkEngine{})
+			}
+			bc.AddNewTransaction(&pending)
+			if err := bc.CheckTransaction(tt.tx); (err != nil) != tt.wantErr {
+				t.Errorf("CheckTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProofOfStakeLedgerCache(t *testing.T) {
+	alice := testKey(1)
+	bc, engine := newPoSChain(t, alice, 1000)
+	for i := 1; i <= 5; i++ {
+		block := Block{
+			Index:        i,
+			Transactions: []Transaction{stakeTx(t, alice, int64(i), int64(i))},
+			Timestamp:    int64(i),
+			PreviousHash: bc.GetLastBlock().Hash,
+		}
+		if err := engine.Seal(bc, bc.Chain, &block); err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replayed := NewLedger(engine.Allocations, engine.Stakes)
+	for _, block := range bc.Chain {
+		if err := replayed.ApplyBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		chain []Block
+		want  *Ledger
+	}{
+		{"tip", bc.Chain, replayed},
+		{"genesis", bc.Chain[:1], NewLedger(engine.Allocations, engine.Stakes)},
+		{"empty", nil, NewLedger(engine.Allocations, engine.Stakes)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := engine.Ledger(tt.chain)
+			if !reflect.DeepEqual(ledger.Balances, tt.want.Balances) || !reflect.DeepEqual(ledger.Stakes, tt.want.Stakes) {
+				t.Errorf("Ledger() = %+v, want %+v", ledger, tt.want)
+			}
+			// callers get their own copy
+			ledger.Balances[testPublicKey(alice)] = 0
+			if engine.Ledger(tt.chain).Balances[testPublicKey(alice)] != tt.want.Balances[testPublicKey(alice)] {
+				t.Errorf("cached ledger changed by caller")
+			}
+		})
+	}
+}
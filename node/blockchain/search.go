@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxWordLength bounds the length of the indexed words, longer words are not searchable.
+const MaxWordLength = 64
+
+// Words returns the distinct lower-cased words of the text, split on everything but
+// letters and digits.
+func Words(text string) []string {
+	seen := map[string]bool{}
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) > MaxWordLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	return words
+}
+
+// SearchPosts returns a page of the posts whose content holds every word of the query,
+// in chain order.
+func (bc *Blockchain) SearchPosts(query string, offset int, limit int) PostPage {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	chain := bc.refreshCache()
+	words := Words(query)
+	if len(words) == 0 {
+		return bc.postPage(chain, nil, offset, limit)
+	}
+	// intersect the word postings, from the rarest word
+	postings := make([][]txRef, len(words))
+	for i, word := range words {
+		postings[i] = bc.cache.words[word]
+	}
+	rarest := 0
+	for i := range postings {
+		if len(postings[i]) < len(postings[rarest]) {
+			rarest = i
+		}
+	}
+	refs := postings[rarest]
+	for i := range postings {
+		if i != rarest {
+			refs = intersectRefs(refs, postings[i])
+		}
+	}
+	return bc.postPage(chain, refs, offset, limit)
+}
+
+// intersectRefs returns the refs in both lists, which are in chain order.
+func intersectRefs(a []txRef, b []txRef) []txRef {
+	refs := []txRef{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].height < b[j].height || (a[i].height == b[j].height && a[i].index < b[j].index):
+			i++
+		case a[i].height > b[j].height || (a[i].height == b[j].height && a[i].index > b[j].index):
+			j++
+		default:
+			refs = append(refs, a[i])
+			i++
+			j++
+		}
+	}
+	return refs
+}
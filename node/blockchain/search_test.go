@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "lower-cased", text: "Hello World", want: []string{"hello", "world"}},
+		{name: "punctuation", text: "go, chain! (blocks)", want: []string{"go", "chain", "blocks"}},
+		{name: "digits", text: "block 42 v2", want: []string{"block", "42", "v2"}},
+		{name: "distinct", text: "a A a b", want: []string{"a", "b"}},
+		{name: "unicode letters", text: "café naïve", want: []string{"café", "naïve"}},
+		{name: "longest word", text: strings.Repeat("x", MaxWordLength), want: []string{strings.Repeat("x", MaxWordLength)}},
+		{name: "too long", text: strings.Repeat("x", MaxWordLength+1) + " short", want: []string{"short"}},
+		{name: "no words", text: " !?- ", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Words(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntersectRefs(t *testing.T) {
+	ref := func(height int, index int) txRef { return txRef{height: height, index: index} }
+	tests := []struct {
+		name string
+		a    []txRef
+		b    []txRef
+		want []txRef
+	}{
+		{name: "same", a: []txRef{ref(1, 0), ref(2, 1)}, b: []txRef{ref(1, 0), ref(2, 1)}, want: []txRef{ref(1, 0), ref(2, 1)}},
+		{name: "same block", a: []txRef{ref(1, 0), ref(1, 2)}, b: []txRef{ref(1, 1), ref(1, 2)}, want: []txRef{ref(1, 2)}},
+		{name: "different blocks", a: []txRef{ref(1, 0), ref(3, 0), ref(5, 0)}, b: []txRef{ref(2, 0), ref(3, 0), ref(4, 0), ref(5, 0)}, want: []txRef{ref(3, 0), ref(5, 0)}},
+		{name: "disjoint", a: []txRef{ref(1, 0)}, b: []txRef{ref(1, 1), ref(2, 0)}, want: []txRef{}},
+		{name: "empty", a: nil, b: []txRef{ref(1, 0)}, want: []txRef{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intersectRefs(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intersectRefs = %v, want %v", got, tt.want)
+			}
+			if got := intersectRefs(tt.b, tt.a); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("swapped intersectRefs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	bc := newPoWChain(t, 0)
+	blocks := [][]Transaction{
+		{
+			{Author: "alice", Content: "Hello chain"},
+			{Author: "bob", Content: "hello world, hello"},
+		},
+		{
+			{Author: "alice", Content: "the chain says hello to the World"},
+			{Author: "bob", Content: "nothing here"},
+		},
+	}
+	for _, txs := range blocks {
+		for _, tx := range txs {
+			bc.AddNewTransaction(&tx)
+		}
+		if _, err := bc.MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pending posts are not searchable
+	bc.AddNewTransaction(&Transaction{Author: "carol", Content: "hello pending"})
+
+	tests := []struct {
+		name      string
+		query     string
+		offset    int
+		limit     int
+		want      []string
+		wantTotal int
+	}{
+		{name: "one word", query: "hello", want: []string{"Hello chain", "hello world, hello", "the chain says hello to the World"}, wantTotal: 3},
+		{name: "every word", query: "hello world", want: []string{"hello world, hello", "the chain says hello to the World"}, wantTotal: 2},
+		{name: "case and punctuation", query: "WORLD! Chain?", want: []string{"the chain says hello to the World"}, wantTotal: 1},
+		{name: "word order", query: "chain hello", want: []string{"Hello chain", "the chain says hello to the World"}, wantTotal: 2},
+		{name: "repeated word", query: "hello hello", want: []string{"Hello chain", "hello world, hello", "the chain says hello to the World"}, wantTotal: 3},
+		{name: "offset and limit", query: "hello", offset: 1, limit: 1, want: []string{"hello world, hello"}, wantTotal: 3},
+		{name: "unknown word", query: "hello unknown", want: []string{}, wantTotal: 0},
+		{name: "partial word", query: "hell", want: []string{}, wantTotal: 0},
+		{name: "pending", query: "pending", want: []string{}, wantTotal: 0},
+		{name: "no words", query: "?!", want: []string{}, wantTotal: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := bc.SearchPosts(tt.query, tt.offset, tt.limit)
+			if got := postContents(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("posts %q, want %q", got, tt.want)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("total %d, want %d", page.Total, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Block sync settings.
+const (
+	MaxHeaders      = 500 // headers returned by a single /headers request
+	MaxGetData      = 500 // blocks requested by a single /getdata request
+	GetDataBatch    = 50  // blocks per body download request
+	DownloadWorkers = 4   // concurrent body download requests
+)
+
+// BlockHeader is a block without its transactions, used to find the missing
+// blocks of a chain before downloading them.
+type BlockHeader struct {
+	Index        int    `json:"index"`
+	Timestamp    int64  `json:"timestamp"`
+	PreviousHash string `json:"previous_hash"`
+	Nonce        int    `json:"nonce"`
+	Validator    string `json:"validator,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+	Hash         string `json:"hash"`
+	TxCount      int    `json:"tx_count"`
+}
+
+// Inventory announces a block by its hash, peers fetch the block if it is unknown.
+type Inventory struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+}
+
+// GetData requests the blocks with the given hashes.
+type GetData struct {
+	Hashes []string `json:"hashes"`
+}
+
+// Header returns the header of the block.
+func (bk Block) Header() BlockHeader {
+	return BlockHeader{
+		Index:        bk.Index,
+		Timestamp:    bk.Timestamp,
+		PreviousHash: bk.PreviousHash,
+		Nonce:        bk.Nonce,
+		Validator:    bk.Validator,
+		Signature:    bk.Signature,
+		Hash:         bk.Hash,
+		TxCount:      len(bk.Transactions),
+	}
+}
+
+// Headers returns up to MaxHeaders headers of our chain starting at height from.
+func (bc *Blockchain) Headers(from int) []BlockHeader {
+	headers := []BlockHeader{}
+	chain := bc.GetChain()
+	for height := from; height >= 0 && height < len(chain) && len(headers) < MaxHeaders; height++ {
+		headers = append(headers, chain[height].Header())
+	}
+	return headers
+}
+
+// HasBlock reports if the block with the given hash is in our chain.
+func (bc *Blockchain) HasBlock(hash string) bool {
+	_, ok := bc.BlockByHash(hash)
+	return ok
+}
+
+// BlocksByHash returns the blocks of our chain with the given hashes, unknown hashes are skipped.
+func (bc *Blockchain) BlocksByHash(hashes []string) []Block {
+	wanted := map[string]bool{}
+	for _, hash := range hashes {
+		wanted[hash] = true
+	}
+	blocks := []Block{}
+	for _, block := range bc.GetChain() {
+		if wanted[block.Hash] {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// AnnounceNewBlock sends the inventory of our last block to every peer,
+// peers that don't know it download it by header-first sync.
+func (bc *Blockchain) AnnounceNewBlock() {
+	lastBlock := bc.GetLastBlock()
+	invData, err := json.Marshal(Inventory{Hash: lastBlock.Hash, Height: lastBlock.Index})
+	if err != nil {
+		return
+	}
+	for _, peer := range bc.Peers.ActivePeers() {
+		start := time.Now()
+		resp, err := bc.Peers.postToPeer(peerURL(peer, "/inv"), invData)
+		if err != nil {
+			log.Printf("Failed to announce block to node %s: %v", peer.NodeAddress, err)
+			bc.Peers.PeerFailed(peer.NodeAddress)
+			continue
+		}
+		resp.Body.Close()
+		bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	}
+}
+
+// Consensus syncs with every peer, if a longer valid chain is found
+// our chain is replaced with it.
+func (bc *Blockchain) Consensus() bool {
+	replaced := false
+	for _, peer := range bc.Peers.ActivePeers() {
+		changed, err := bc.SyncWithPeer(peer)
+		if err != nil {
+			log.Printf("Failed to sync with node %s: %v", peer.NodeAddress, err)
+		}
+		replaced = replaced || changed
+	}
+	return replaced
+}
+
+// SyncWithPeer downloads the blocks of the peer chain we are missing, header first:
+// it finds where the peer chain forks from ours, fetches the headers after the fork,
+// and when the peer chain is longer downloads the block bodies in parallel and
+// replaces our chain suffix. It reports if our chain changed.
+func (bc *Blockchain) SyncWithPeer(peer NodePeer) (bool, error) {
+	bc.syncMu.Lock()
+	defer bc.syncMu.Unlock()
+
+	chain := bc.GetChain()
+	fork, headers, err := bc.findFork(peer, chain)
+	if err != nil {
+		return false, err
+	}
+	// the fork header was dropped from a full first batch, fetch the rest of the full batches
+	for full := len(headers) == MaxHeaders-1; full; {
+		more, err := bc.fetchHeaders(peer, headers[len(headers)-1].Index+1)
+		if err != nil {
+			return false, err
+		}
+		headers = append(headers, more...)
+		full = len(more) == MaxHeaders
+	}
+	if fork+len(headers) <= len(chain)-1 {
+		return false, nil // peer chain is not longer
+	}
+	if err := bc.checkHeaders(chain[fork], headers); err != nil {
+		bc.Peers.Misbehaving(peer.NodeAddress, BlockScore(err), err.Error())
+		return false, err
+	}
+
+	blocks, err := bc.downloadBlocks(peer, headers)
+	if err != nil {
+		return false, err
+	}
+	candidate := &Blockchain{
+		NetworkID:  bc.NetworkID,
+		Difficulty: bc.Difficulty,
+		Chain:      append([]Block{}, chain[:fork+1]...),
+		Peers:      &PeerManager{},
+	}
+	candidate.SetEngine(bc.Engine)
+	for _, block := range blocks {
+		if err := candidate.AddBlock(block); err != nil {
+			bc.Peers.Misbehaving(peer.NodeAddress, BlockScore(err), err.Error())
+			return false, err
+		}
+	}
+	//never revert checkpoints, finalized or too many blocks
+	if err := bc.ReplaceChainIfAllowed(candidate.Chain); err != nil {
+		bc.RecordRejectedReorg(peer.NodeAddress, candidate.Chain, err)
+		return false, err
+	}
+	log.Printf("Synced %d blocks from node %s (fork at height %d)", len(blocks), peer.NodeAddress, fork)
+	bc.connectOrphans()
+	return true, nil
+}
+
+// findFork finds the last block of chain that is in the peer chain, stepping back
+// exponentially from its tip, and returns its height with the peer headers following it.
+func (bc *Blockchain) findFork(peer NodePeer, chain []Block) (int, []BlockHeader, error) {
+	height, step := len(chain)-1, 1
+	for {
+		headers, err := bc.fetchHeaders(peer, height)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(headers) == 0 && height == len(chain)-1 {
+			return height, nil, nil // peer chain is shorter than ours
+		}
+		if len(headers) > 0 && headers[0].Hash == chain[height].Hash {
+			return height, headers[1:], nil
+		}
+		if height == 0 {
+			return 0, nil, fmt.Errorf("genesis block mismatch")
+		}
+		height -= step
+		step *= 2
+		if height < 0 {
+			height = 0
+		}
+	}
+}
+
+// fetchHeaders gets the peer headers starting at height from.
+func (bc *Blockchain) fetchHeaders(peer NodePeer, from int) ([]BlockHeader, error) {
+	start := time.Now()
+	response, err := peerClient.Get(peerURL(peer, "/headers?from="+strconv.Itoa(from)))
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("headers status %s", response.Status)
+	}
+	var headers []BlockHeader
+	if err := json.NewDecoder(response.Body).Decode(&headers); err != nil {
+		return nil, err
+	}
+	if len(headers) > MaxHeaders {
+		return nil, fmt.Errorf("too many headers")
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	return headers, nil
+}
+
+// checkHeaders checks the headers follow parent and each other, and satisfy
+// the difficulty for proof of work, before the blocks are downloaded.
+func (bc *Blockchain) checkHeaders(parent Block, headers []BlockHeader) error {
+	previousIndex, previousHash := parent.Index, parent.Hash
+	for _, header := range headers {
+		if header.Index != previousIndex+1 || header.PreviousHash != previousHash {
+			return fmt.Errorf("header %d does not follow block %d", header.Index, previousIndex)
+		}
+		if bc.ConsensusEngine().Name() == ConsensusPoW && !strings.HasPrefix(header.Hash, strings.Repeat("0", bc.Difficulty)) {
+			return fmt.Errorf("%w: header %d does not satisfy difficulty", ErrForgedSeal, header.Index)
+		}
+		previousIndex, previousHash = header.Index, header.Hash
+	}
+	return nil
+}
+
+// downloadBlocks gets the blocks of the headers from the peer, in batches of GetDataBatch
+// blocks requested by DownloadWorkers concurrent requests. The blocks are returned in order.
+func (bc *Blockchain) downloadBlocks(peer NodePeer, headers []BlockHeader) ([]Block, error) {
+	blocks := make([]Block, len(headers))
+	batches := make(chan int)
+	errs := make(chan error, DownloadWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < DownloadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for first := range batches {
+				last := first + GetDataBatch
+				if last > len(headers) {
+					last = len(headers)
+				}
+				if err := bc.fetchBlocks(peer, headers[first:last], blocks[first:last]); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(batches)
+		for first := 0; first < len(headers); first += GetDataBatch {
+			select {
+			case batches <- first:
+			case err := <-errs:
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+		return blocks, nil
+	}
+}
+
+// fetchBlocks requests the blocks of headers with /getdata, storing them in blocks.
+func (bc *Blockchain) fetchBlocks(peer NodePeer, headers []BlockHeader, blocks []Block) error {
+	request := GetData{Hashes: []string{}}
+	for _, header := range headers {
+		request.Hashes = append(request.Hashes, header.Hash)
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	response, err := peerClient.Post(peerURL(peer, "/getdata"), "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("getdata status %s", response.Status)
+	}
+	var received []Block
+	if err := json.NewDecoder(response.Body).Decode(&received); err != nil {
+		return err
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	byHash := map[string]Block{}
+	for _, block := range received {
+		byHash[block.Hash] = block
+	}
+	for i, header := range headers {
+		block, ok := byHash[header.Hash]
+		if !ok || block.Index != header.Index || block.PreviousHash != header.PreviousHash {
+			return fmt.Errorf("block %d missing from getdata response", header.Index)
+		}
+		blocks[i] = block
+	}
+	return nil
+}
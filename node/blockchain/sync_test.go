@@ -0,0 +1,153 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newPeerServer serves the /tip, /headers and /getdata endpoints of the chain.
+func newPeerServer(t *testing.T, chain []Block) *httptest.Server {
+	t.Helper()
+	remote := &Blockchain{Chain: chain, Peers: &PeerManager{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tip":
+			json.NewEncoder(w).Encode(remote.Tip())
+		case "/headers":
+			from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+			json.NewEncoder(w).Encode(remote.Headers(from))
+		case "/getdata":
+			var request GetData
+			json.NewDecoder(r.Body).Decode(&request)
+			json.NewEncoder(w).Encode(remote.BlocksByHash(request.Hashes))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// weakChain returns the chain extended with a block not satisfying difficulty 1.
+func weakChain(t *testing.T, chain []Block) []Block {
+	t.Helper()
+	last := chain[len(chain)-1]
+	block := Block{Index: last.Index + 1, Transactions: []Transaction{{Author: "mallory", Content: "weak"}}, PreviousHash: last.Hash}
+	for block.Hash = ""; ; block.Nonce++ {
+		hash, err := block.ComputeHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(hash, "0") {
+			block.Hash = hash
+			break
+		}
+	}
+	return append(append([]Block{}, chain...), block)
+}
+
+func TestSyncWithPeer(t *testing.T) {
+	tests := []struct {
+		name        string
+		peerChain   func(t *testing.T, bc *Blockchain) []Block
+		maxDepth    int
+		wantChanged bool
+		wantErr     bool
+		wantHeight  int
+		wantBanned  bool
+		wantScore   int
+		wantRejects int
+	}{
+		{name: "peer ahead", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return forkChain(t, bc, len(bc.Chain), 3)
+		}, wantChanged: true, wantHeight: 6},
+		{name: "same chain", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return bc.Chain
+		}, wantHeight: 3},
+		{name: "peer behind", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return bc.Chain[:2]
+		}, wantHeight: 3},
+		{name: "longer fork", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return forkChain(t, bc, 2, 4)
+		}, wantChanged: true, wantHeight: 5},
+		{name: "equal fork", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return forkChain(t, bc, 2, 2)
+		}, wantHeight: 3},
+		{name: "fork too deep", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return forkChain(t, bc, 1, 5)
+		}, maxDepth: 1, wantErr: true, wantHeight: 3, wantRejects: 1},
+		{name: "invalid headers", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			return weakChain(t, bc.Chain)
+		}, wantErr: true, wantHeight: 3, wantBanned: true},
+		{name: "forged block", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			chain := forkChain(t, bc, len(bc.Chain), 2)
+			chain[len(chain)-1].Transactions = []Transaction{{Author: "mallory", Content: "forged"}}
+			return chain
+		}, wantErr: true, wantHeight: 3, wantBanned: true, wantScore: 0},
+		{name: "headers not following", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			chain := forkChain(t, bc, len(bc.Chain), 2)
+			last := &chain[len(chain)-1]
+			last.Index, last.Hash = last.Index+1, ""
+			if err := bc.ProofOfWork(last); err != nil {
+				t.Fatal(err)
+			}
+			return chain
+		}, wantErr: true, wantHeight: 3, wantScore: InvalidBlockScore},
+		{name: "other genesis", peerChain: func(t *testing.T, bc *Blockchain) []Block {
+			other := forkChain(t, bc, 1, 4)
+			other[0].Hash = "other"
+			return other
+		}, wantErr: true, wantHeight: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 3)
+			bc.MaxReorgDepth = tt.maxDepth
+			server := newPeerServer(t, tt.peerChain(t, bc))
+			peer := NodePeer{NodeAddress: server.URL}
+			bc.Peers.AddNodePeer(&peer)
+
+			changed, err := bc.SyncWithPeer(peer)
+			if (err != nil) != tt.wantErr || changed != tt.wantChanged {
+				t.Fatalf("SyncWithPeer() = %v, %v, want %v, error %v", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if height := bc.GetLastBlock().Index; height != tt.wantHeight || !bc.CheckChainValidity() {
+				t.Errorf("height %d (valid %v), want %d", height, bc.CheckChainValidity(), tt.wantHeight)
+			}
+			if bc.Peers.IsBanned(peer.NodeAddress) != tt.wantBanned {
+				t.Errorf("peer banned %v, want %v", bc.Peers.IsBanned(peer.NodeAddress), tt.wantBanned)
+			}
+			if score := bc.Peers.PeerList()[0].Score; score != tt.wantScore {
+				t.Errorf("peer score %d, want %d", score, tt.wantScore)
+			}
+			if len(bc.RejectedReorgs) != tt.wantRejects {
+				t.Errorf("%d rejected reorgs, want %d", len(bc.RejectedReorgs), tt.wantRejects)
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	bc := newPoWChain(t, 3)
+	tests := []struct {
+		from      int
+		wantFirst int
+		wantLen   int
+	}{
+		{0, 0, 4},
+		{2, 2, 2},
+		{3, 3, 1},
+		{4, 0, 0},
+		{-1, 0, 0},
+	}
+	for _, tt := range tests {
+		headers := bc.Headers(tt.from)
+		if len(headers) != tt.wantLen || (len(headers) > 0 && headers[0].Index != tt.wantFirst) {
+			t.Errorf("Headers(%d) = %+v, want %d headers from %d", tt.from, headers, tt.wantLen, tt.wantFirst)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sync states.
+const (
+	SyncStateSyncing = "syncing"
+	SyncStateSynced  = "synced"
+)
+
+// SyncStatus describes the progress of the synchronizer: our height and the best
+// height announced by the peers at the last check.
+type SyncStatus struct {
+	State        string `json:"state"`
+	Height       int    `json:"height"`
+	TargetHeight int    `json:"target_height"`
+	TargetPeer   string `json:"target_peer,omitempty"`
+	LastCheck    int64  `json:"last_check,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// Synchronizer keeps the chain up to date in the background, polling the tips of
+// the peers and syncing with the peer having the longest chain when we are behind.
+type Synchronizer struct {
+	bc     *Blockchain
+	status SyncStatus
+	mu     sync.Mutex
+}
+
+// NewSynchronizer creates a synchronizer for the chain, syncing until the first check of the peers.
+func NewSynchronizer(bc *Blockchain) *Synchronizer {
+	return &Synchronizer{bc: bc, status: SyncStatus{State: SyncStateSyncing}}
+}
+
+// Status returns the current sync status.
+func (s *Synchronizer) Status() SyncStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Height = s.bc.GetLastBlock().Index
+	if status.TargetHeight < status.Height {
+		status.TargetHeight = status.Height
+	}
+	return status
+}
+
+// setStatus updates the status under lock.
+func (s *Synchronizer) setStatus(update func(status *SyncStatus)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.status)
+}
+
+// Sync polls the peer tips once and syncs with the best peer if it is ahead of us,
+// trying the next best peers if it fails. It reports if our chain changed.
+func (s *Synchronizer) Sync() bool {
+	height := s.bc.GetLastBlock().Index
+	candidates := []NodePeer{}
+	target := SyncStatus{State: SyncStateSynced, TargetHeight: height, LastCheck: time.Now().Unix()}
+	for _, peer := range s.bc.Peers.ActivePeers() {
+		tip, err := s.bc.fetchTip(peer)
+		if err != nil {
+			log.Printf("Failed to get tip of node %s: %v", peer.NodeAddress, err)
+			continue
+		}
+		if tip.Height <= height {
+			continue
+		}
+		peer.BestHeight = tip.Height
+		candidates = append(candidates, peer)
+	}
+	// best peers first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].BestHeight > candidates[j].BestHeight
+	})
+	if len(candidates) == 0 {
+		s.setStatus(func(status *SyncStatus) { *status = target })
+		return false
+	}
+	target.State, target.TargetHeight, target.TargetPeer = SyncStateSyncing, candidates[0].BestHeight, candidates[0].NodeAddress
+	s.setStatus(func(status *SyncStatus) { *status = target })
+
+	for _, peer := range candidates {
+		changed, err := s.bc.SyncWithPeer(peer)
+		if err != nil {
+			log.Printf("Failed to sync with node %s: %v", peer.NodeAddress, err)
+			s.setStatus(func(status *SyncStatus) { status.LastError = err.Error() })
+			continue
+		}
+		if changed {
+			height := s.bc.GetLastBlock().Index
+			s.setStatus(func(status *SyncStatus) {
+				status.LastError = ""
+				if height >= status.TargetHeight {
+					status.State = SyncStateSynced
+				}
+			})
+			return true
+		}
+	}
+	return false
+}
+
+// Run syncs every interval, onChange is called after our chain changed.
+func (s *Synchronizer) Run(interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.Sync() && onChange != nil {
+			onChange()
+		}
+	}
+}
+
+// fetchTip gets the tip of the peer chain, recording it in the peer metadata.
+func (bc *Blockchain) fetchTip(peer NodePeer) (Tip, error) {
+	start := time.Now()
+	response, err := peerClient.Get(peerURL(peer, "/tip"))
+	if err != nil {
+		bc.Peers.PeerFailed(peer.NodeAddress)
+		return Tip{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Tip{}, fmt.Errorf("tip status %s", response.Status)
+	}
+	var tip Tip
+	if err := json.NewDecoder(response.Body).Decode(&tip); err != nil {
+		return Tip{}, err
+	}
+	bc.Peers.PeerSucceeded(peer.NodeAddress, time.Since(start))
+	bc.Peers.updatePeer(peer.NodeAddress, func(p *NodePeer) {
+		p.BestHeight = tip.Height
+		p.BestHash = tip.Hash
+	})
+	return tip, nil
+}
@@ -0,0 +1,49 @@
+package blockchain
+
+import "testing"
+
+func TestSynchronizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		peerChains  func(t *testing.T, bc *Blockchain) [][]Block
+		wantChanged bool
+		wantHeight  int
+		wantState   string
+		wantTarget  int
+	}{
+		{name: "no peers", peerChains: func(t *testing.T, bc *Blockchain) [][]Block {
+			return nil
+		}, wantHeight: 3, wantState: SyncStateSynced, wantTarget: 3},
+		{name: "peer behind", peerChains: func(t *testing.T, bc *Blockchain) [][]Block {
+			return [][]Block{bc.Chain[:2]}
+		}, wantHeight: 3, wantState: SyncStateSynced, wantTarget: 3},
+		{name: "peer ahead", peerChains: func(t *testing.T, bc *Blockchain) [][]Block {
+			return [][]Block{forkChain(t, bc, len(bc.Chain), 2)}
+		}, wantChanged: true, wantHeight: 5, wantState: SyncStateSynced, wantTarget: 5},
+		{name: "best peer first", peerChains: func(t *testing.T, bc *Blockchain) [][]Block {
+			return [][]Block{forkChain(t, bc, len(bc.Chain), 1), forkChain(t, bc, 2, 5)}
+		}, wantChanged: true, wantHeight: 6, wantState: SyncStateSynced, wantTarget: 6},
+		{name: "next peer after failure", peerChains: func(t *testing.T, bc *Blockchain) [][]Block {
+			return [][]Block{weakChain(t, forkChain(t, bc, len(bc.Chain), 3)), forkChain(t, bc, len(bc.Chain), 1)}
+		}, wantChanged: true, wantHeight: 4, wantState: SyncStateSyncing, wantTarget: 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 3)
+			for _, chain := range tt.peerChains(t, bc) {
+				server := newPeerServer(t, chain)
+				if err := bc.Peers.AddNodePeer(&NodePeer{NodeAddress: server.URL}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := NewSynchronizer(bc)
+			if changed := s.Sync(); changed != tt.wantChanged {
+				t.Errorf("Sync() = %v, want %v", changed, tt.wantChanged)
+			}
+			status := s.Status()
+			if status.Height != tt.wantHeight || status.State != tt.wantState || status.TargetHeight != tt.wantTarget {
+				t.Errorf("Status() = %+v, want height %d, state %s, target %d", status, tt.wantHeight, tt.wantState, tt.wantTarget)
+			}
+		})
+	}
+}
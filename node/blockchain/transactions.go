@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// Transaction statuses.
+const (
+	TxStatusPending   = "pending"   // waiting to be mined
+	TxStatusConfirmed = "confirmed" // included in a block of our chain
+)
+
+// TxStatus describes where a transaction is: pending, or confirmed in a block with
+// the number of confirmations (the block including it is the first one).
+type TxStatus struct {
+	ID            string      `json:"id"`
+	Status        string      `json:"status"`
+	Transaction   Transaction `json:"transaction"`
+	BlockHeight   int         `json:"block_height,omitempty"`
+	BlockHash     string      `json:"block_hash,omitempty"`
+	Confirmations int         `json:"confirmations"`
+	Finalized     bool        `json:"finalized"`
+}
+
+// ID returns the transaction id, the hash of the transaction with its signature.
+// Identical transactions (same author, content and timestamp) have the same id.
+func (tx Transaction) ID() string {
+	// a transaction only holds strings and numbers, it always marshals
+	bytes, _ := json.Marshal(tx)
+	return fmt.Sprintf("%x", sha256.Sum256(bytes))
+}
+
+// TransactionStatus looks up the transaction with the given id in the transaction index
+// of our chain, then in the pending transactions.
+func (bc *Blockchain) TransactionStatus(id string) (TxStatus, bool) {
+	ref, ok := bc.transactionRef(id)
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	chain := bc.Chain
+	if ok && ref.height < len(chain) && ref.index < len(chain[ref.height].Transactions) {
+		return TxStatus{
+			ID:            id,
+			Status:        TxStatusConfirmed,
+			Transaction:   chain[ref.height].Transactions[ref.index],
+			BlockHeight:   ref.height,
+			BlockHash:     chain[ref.height].Hash,
+			Confirmations: len(chain) - ref.height,
+			Finalized:     bc.FinalizedHash != "" && ref.height <= bc.FinalizedHeight,
+		}, true
+	}
+	for _, tx := range bc.UnconfirmedTransactions {
+		if tx.ID() == id {
+			return TxStatus{ID: id, Status: TxStatusPending, Transaction: tx}, true
+		}
+	}
+	return TxStatus{}, false
+}
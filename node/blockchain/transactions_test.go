@@ -0,0 +1,75 @@
+package blockchain
+
+import "testing"
+
+func TestTransactionID(t *testing.T) {
+	tx := post("a")
+	tests := []struct {
+		name   string
+		update func(tx *Transaction)
+		want   bool // same id as tx
+	}{
+		{"identical", func(tx *Transaction) {}, true},
+		{"content", func(tx *Transaction) { tx.Content = "b" }, false},
+		{"timestamp", func(tx *Transaction) { tx.Timestamp++ }, false},
+		{"signature", func(tx *Transaction) { tx.Signature = "00" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := tx
+			tt.update(&other)
+			if (other.ID() == tx.ID()) != tt.want {
+				t.Errorf("ID() = %s, transaction id %s", other.ID(), tx.ID())
+			}
+		})
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	tests := []struct {
+		name              string
+		tx                Transaction
+		update            func(t *testing.T, bc *Blockchain)
+		wantStatus        string // empty if unknown
+		wantHeight        int
+		wantConfirmations int
+		wantFinalized     bool
+	}{
+		{name: "pending", tx: post("p"), wantStatus: TxStatusPending},
+		{name: "finalized", tx: post("a"), wantStatus: TxStatusConfirmed, wantHeight: 1, wantConfirmations: 3, wantFinalized: true},
+		{name: "confirmed", tx: post("c"), wantStatus: TxStatusConfirmed, wantHeight: 3, wantConfirmations: 1},
+		{name: "more confirmations", tx: post("c"), update: func(t *testing.T, bc *Blockchain) {
+			bc.ReplaceChain(chainWith(t, bc, 4, post("d"), post("e")))
+		}, wantStatus: TxStatusConfirmed, wantHeight: 3, wantConfirmations: 3},
+		{name: "reverted", tx: post("c"), update: func(t *testing.T, bc *Blockchain) {
+			bc.ReplaceChain(chainWith(t, bc, 3, post("x"), post("y")))
+		}, wantStatus: TxStatusPending},
+		{name: "unknown", tx: post("z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newPoWChain(t, 0)
+			bc.Chain = chainWith(t, bc, 1, post("a"), post("b"), post("c"))
+			bc.setFinalized(1, bc.Chain[1].Hash)
+			pending := post("p")
+			bc.AddNewTransaction(&pending)
+			if tt.update != nil {
+				tt.update(t, bc)
+			}
+
+			status, ok := bc.TransactionStatus(tt.tx.ID())
+			if ok != (tt.wantStatus != "") || status.Status != tt.wantStatus {
+				t.Fatalf("TransactionStatus() = %+v, %v, want %q", status, ok, tt.wantStatus)
+			}
+			if status.BlockHeight != tt.wantHeight || status.Confirmations != tt.wantConfirmations || status.Finalized != tt.wantFinalized {
+				t.Errorf("TransactionStatus() = %+v, want height %d, %d confirmations, finalized %v", status, tt.wantHeight, tt.wantConfirmations, tt.wantFinalized)
+			}
+			if ok && (status.ID != tt.tx.ID() || status.Transaction != tt.tx) {
+				t.Errorf("TransactionStatus() = %+v, want transaction %+v", status, tt.tx)
+			}
+			if tt.wantStatus == TxStatusConfirmed && status.BlockHash != bc.Chain[status.BlockHeight].Hash {
+				t.Errorf("block hash %s, want %s", status.BlockHash, bc.Chain[status.BlockHeight].Hash)
+			}
+		})
+	}
+}
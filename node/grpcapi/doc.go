@@ -0,0 +1,3 @@
+// Package grpcapi holds the protobuf messages and the gRPC service of the node API,
+// generated from node.proto. The service is implemented by the node application.
+package grpcapi
@@ -26,15 +26,22 @@ and gracefully shutdown when interrupted
 * it starts server from saved file (if any),
 and before shutdown saves blockchain data to file (blockchain.json)
 */
-func StartServer(port int64) {
+func StartServer(port int64, config app.Config) {
 	if port == 0 {
 		port = 8000
 	}
-	application, err = app.NewApplication()
+	application, err = app.NewApplication(config)
 	if err != nil {
 		log.Fatalf("new application: %v", err)
 	}
 
+	go application.MonitorPeers(30 * time.Second)
+	go application.RunSync(10 * time.Second)
+	go application.Webhooks.Run()
+	if application.P2P != nil {
+		go application.P2P.ConnectAll(config.P2PPeers, 30*time.Second)
+	}
+
 	server = &http.Server{
 		Addr:         ":" + strconv.FormatInt(port, 10),
 		Handler:      application.Router,
@@ -63,6 +70,12 @@ func StartServer(port int64) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if application.P2P != nil {
+		application.P2P.Close()
+	}
+	if application.GRPC != nil {
+		application.GRPC.Stop()
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal("Server shutdown error:", err)
 	}
@@ -81,6 +94,12 @@ func StopServer() {
 		log.Fatal("save application:", err)
 	}
 
+	if application.P2P != nil {
+		application.P2P.Close()
+	}
+	if application.GRPC != nil {
+		application.GRPC.Stop()
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal("Server shutdown error:", err)
 	}
@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Message types of the p2p protocol.
+const (
+	MsgHandshake  = "handshake"  // blockchain.Handshake, first message on each connection
+	MsgPing       = "ping"       // Ping
+	MsgPong       = "pong"       // Ping, echoing the ping nonce
+	MsgBlock      = "block"      // blockchain.Block, a new block
+	MsgTx         = "tx"         // blockchain.Transaction, a new pending transaction
+	MsgGetHeaders = "getheaders" // GetHeaders
+	MsgHeaders    = "headers"    // []blockchain.BlockHeader
+	MsgGetBlocks  = "getblocks"  // blockchain.GetData
+	MsgBlocks     = "blocks"     // []blockchain.Block
+)
+
+// MaxFrameSize bounds the size of a message frame.
+const MaxFrameSize = 8 << 20
+
+// Message is the content of a frame: its type and JSON payload.
+type Message struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Ping is the payload of ping and pong messages.
+type Ping struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// GetHeaders requests the headers from height From.
+type GetHeaders struct {
+	From int `json:"from"`
+}
+
+// NewMessage creates a message with the payload encoded as JSON.
+func NewMessage(msgType string, payload interface{}) (Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Type: msgType, Payload: data}, nil
+}
+
+// Decode decodes the message payload into v.
+func (m Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+// WriteMessage writes the message as a frame: its length as a 4 bytes big endian
+// integer followed by the message JSON.
+func WriteMessage(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxFrameSize {
+		return fmt.Errorf("message %s too large (%d bytes)", msg.Type, len(data))
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+// ReadMessage reads a frame written by WriteMessage.
+func ReadMessage(r io.Reader) (Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Message{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return Message{}, fmt.Errorf("frame too large (%d bytes)", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return Message{}, err
+	}
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Message{}, fmt.Errorf("invalid frame: %v", err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,406 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// Transport settings.
+const (
+	PingInterval     = 30 * time.Second
+	IdleTimeout      = 3 * PingInterval // connections silent for longer are closed
+	HandshakeTimeout = 10 * time.Second
+	DialTimeout      = 10 * time.Second
+)
+
+// Transport exchanges blocks, transactions and headers with other nodes over long-lived
+// TCP connections, alongside the HTTP API. It runs on the node chain.
+type Transport struct {
+	bc          *blockchain.Blockchain
+	nodeAddress string // our HTTP address sent in handshakes
+	listener    net.Listener
+	conns       map[string]*Conn // by node id
+	mu          sync.Mutex
+
+	// OnNewTip is called after a received block was added to the chain.
+	OnNewTip func()
+}
+
+// Conn is an established connection with a node.
+type Conn struct {
+	conn      net.Conn
+	address   string // dialed address of outbound connections
+	handshake blockchain.Handshake
+	inbound   bool
+	writeMu   sync.Mutex
+}
+
+// ConnInfo describes a connection.
+type ConnInfo struct {
+	NodeID      string `json:"node_id"`
+	NodeAddress string `json:"node_address,omitempty"`
+	Address     string `json:"address,omitempty"`
+	RemoteAddr  string `json:"remote_addr"`
+	Inbound     bool   `json:"inbound"`
+	BestHeight  int    `json:"best_height"`
+}
+
+// NewTransport creates a transport for the chain, nodeAddress is the HTTP address of the node.
+func NewTransport(bc *blockchain.Blockchain, nodeAddress string) *Transport {
+	return &Transport{bc: bc, nodeAddress: nodeAddress, conns: map[string]*Conn{}}
+}
+
+// Listen accepts connections on address (e.g. ":9000", ":0" for any port) in the background.
+func (t *Transport) Listen(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	t.listener = listener
+	log.Println("Starting p2p transport on " + listener.Addr().String())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					log.Println("p2p accept error:", err)
+				}
+				return
+			}
+			go t.serve(conn, true)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the transport listens on.
+func (t *Transport) Addr() string {
+	if t.listener == nil {
+		return ""
+	}
+	return t.listener.Addr().String()
+}
+
+// Close stops listening and closes every connection.
+func (t *Transport) Close() {
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range t.conns {
+		c.conn.Close()
+	}
+}
+
+// Connect dials the node at address (host:port) and serves the connection in the background
+// once the handshake succeeded.
+func (t *Transport) Connect(address string) error {
+	conn, err := net.DialTimeout("tcp", address, DialTimeout)
+	if err != nil {
+		return err
+	}
+	c, err := t.handshake(conn, false)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	c.address = address
+	go t.run(c)
+	return nil
+}
+
+// ConnectAll keeps connections to the given addresses, redialing every interval.
+func (t *Transport) ConnectAll(addresses []string, interval time.Duration) {
+	for {
+		connected := map[string]bool{}
+		for _, info := range t.Conns() {
+			connected[info.Address] = true
+		}
+		for _, address := range addresses {
+			if connected[address] {
+				continue
+			}
+			if err := t.Connect(address); err != nil {
+				log.Printf("Failed to connect to p2p node %s: %v", address, err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Conns returns the established connections.
+func (t *Transport) Conns() []ConnInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	infos := []ConnInfo{}
+	for _, c := range t.conns {
+		infos = append(infos, ConnInfo{
+			NodeID:      c.handshake.NodeID,
+			NodeAddress: c.handshake.NodeAddress,
+			Address:     c.address,
+			RemoteAddr:  c.conn.RemoteAddr().String(),
+			Inbound:     c.inbound,
+			BestHeight:  c.handshake.BestHeight,
+		})
+	}
+	return infos
+}
+
+// serve handles an accepted connection.
+func (t *Transport) serve(conn net.Conn, inbound bool) {
+	c, err := t.handshake(conn, inbound)
+	if err != nil {
+		log.Printf("p2p handshake with %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	t.run(c)
+}
+
+// handshake exchanges handshakes on a new connection and registers it.
+func (t *Transport) handshake(conn net.Conn, inbound bool) (*Conn, error) {
+	c := &Conn{conn: conn, inbound: inbound}
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := c.send(MsgHandshake, t.bc.Handshake(t.nodeAddress)); err != nil {
+		return nil, err
+	}
+	msg, err := ReadMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != MsgHandshake {
+		return nil, fmt.Errorf("expected handshake, got %s", msg.Type)
+	}
+	if err := msg.Decode(&c.handshake); err != nil {
+		return nil, err
+	}
+	if err := t.bc.CheckHandshake(c.handshake); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.conns[c.handshake.NodeID]; ok {
+		return nil, fmt.Errorf("already connected to node %s", c.handshake.NodeID)
+	}
+	t.conns[c.handshake.NodeID] = c
+	return c, nil
+}
+
+// run reads and handles the messages of the connection until it is closed,
+// pinging the node every PingInterval.
+func (t *Transport) run(c *Conn) {
+	log.Printf("p2p connected to node %s (%s)", c.handshake.NodeID, c.conn.RemoteAddr())
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		c.conn.Close()
+		t.mu.Lock()
+		delete(t.conns, c.handshake.NodeID)
+		t.mu.Unlock()
+		log.Printf("p2p disconnected from node %s", c.handshake.NodeID)
+	}()
+	go func() {
+		ticker := time.NewTicker(PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := c.send(MsgPing, Ping{Nonce: rand.Uint64()}); err != nil {
+					c.conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	// the chain sync starts from our tip
+	c.send(MsgGetHeaders, GetHeaders{From: t.bc.GetLastBlock().Index})
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(IdleTimeout))
+		msg, err := ReadMessage(c.conn)
+		if err != nil {
+			return
+		}
+		if err := t.handle(c, msg); err != nil {
+			log.Printf("p2p message %s from node %s: %v", msg.Type, c.handshake.NodeID, err)
+		}
+	}
+}
+
+// send writes a message with the payload to the connection.
+func (c *Conn) send(msgType string, payload interface{}) error {
+	msg, err := NewMessage(msgType, payload)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(DialTimeout))
+	return WriteMessage(c.conn, msg)
+}
+
+// broadcast sends a message to every connection except the one a message came from.
+func (t *Transport) broadcast(msgType string, payload interface{}, except *Conn) {
+	t.mu.Lock()
+	conns := []*Conn{}
+	for _, c := range t.conns {
+		if c != except {
+			conns = append(conns, c)
+		}
+	}
+	t.mu.Unlock()
+	for _, c := range conns {
+		if err := c.send(msgType, payload); err != nil {
+			log.Printf("p2p failed to send %s to node %s: %v", msgType, c.handshake.NodeID, err)
+		}
+	}
+}
+
+// BroadcastBlock sends a new block to every connected node.
+func (t *Transport) BroadcastBlock(block blockchain.Block) {
+	t.broadcast(MsgBlock, block, nil)
+}
+
+// BroadcastTransaction sends a new pending transaction to every connected node.
+func (t *Transport) BroadcastTransaction(tx blockchain.Transaction) {
+	t.broadcast(MsgTx, tx, nil)
+}
+
+// handle processes a message received on the connection.
+func (t *Transport) handle(c *Conn, msg Message) error {
+	switch msg.Type {
+	case MsgPing:
+		var ping Ping
+		if err := msg.Decode(&ping); err != nil {
+			return err
+		}
+		return c.send(MsgPong, ping)
+	case MsgPong:
+		return nil
+	case MsgBlock:
+		var block blockchain.Block
+		if err := msg.Decode(&block); err != nil {
+			return err
+		}
+		return t.handleBlocks(c, []blockchain.Block{block})
+	case MsgTx:
+		var tx blockchain.Transaction
+		if err := msg.Decode(&tx); err != nil {
+			return err
+		}
+		if err := tx.Validate(); err != nil {
+			return err
+		}
+		// known transactions are not relayed again, confirmed ones would be mined twice
+		if status, known := t.bc.TransactionStatus(tx.ID()); known {
+			if status.Status == blockchain.TxStatusConfirmed {
+				return fmt.Errorf("transaction %s already confirmed", status.ID)
+			}
+			return nil
+		}
+		// stake transactions our ledger can't apply are neither kept nor relayed
+		if err := t.bc.CheckTransaction(tx); err != nil {
+			log.Printf("p2p dropped transaction %s: %v", tx.ID(), err)
+			return nil
+		}
+		t.bc.AddNewTransaction(&tx)
+		t.broadcast(MsgTx, tx, c)
+		return nil
+	case MsgGetHeaders:
+		var request GetHeaders
+		if err := msg.Decode(&request); err != nil {
+			return err
+		}
+		return c.send(MsgHeaders, t.bc.Headers(request.From))
+	case MsgHeaders:
+		var headers []blockchain.BlockHeader
+		if err := msg.Decode(&headers); err != nil {
+			return err
+		}
+		return t.handleHeaders(c, headers)
+	case MsgGetBlocks:
+		var request blockchain.GetData
+		if err := msg.Decode(&request); err != nil {
+			return err
+		}
+		if len(request.Hashes) > blockchain.MaxGetData {
+			return fmt.Errorf("too many blocks requested")
+		}
+		return c.send(MsgBlocks, t.bc.BlocksByHash(request.Hashes))
+	case MsgBlocks:
+		var blocks []blockchain.Block
+		if err := msg.Decode(&blocks); err != nil {
+			return err
+		}
+		if err := t.handleBlocks(c, blocks); err != nil {
+			return err
+		}
+		// ask for more, until the node has no headers following our tip
+		return c.send(MsgGetHeaders, GetHeaders{From: t.bc.GetLastBlock().Index})
+	}
+	return fmt.Errorf("unknown message type")
+}
+
+// handleBlocks adds received blocks to the chain and relays our new tip, blocks that
+// don't extend our chain make us request the headers following our tip.
+func (t *Transport) handleBlocks(c *Conn, blocks []blockchain.Block) error {
+	added := false
+	defer func() {
+		if added {
+			if t.OnNewTip != nil {
+				t.OnNewTip()
+			}
+			t.broadcast(MsgBlock, t.bc.GetLastBlock(), c)
+		}
+	}()
+	for _, block := range blocks {
+		if t.bc.HasBlock(block.Hash) {
+			continue
+		}
+		err := t.bc.AcceptBlock(block, nil)
+		if errors.Is(err, blockchain.ErrOrphanBlock) {
+			return c.send(MsgGetHeaders, GetHeaders{From: t.bc.GetLastBlock().Index})
+		}
+		if err != nil {
+			return err
+		}
+		added = true
+	}
+	return nil
+}
+
+// handleHeaders requests the blocks of the headers following our tip. Headers of
+// other forks are left to the HTTP synchronizer.
+func (t *Transport) handleHeaders(c *Conn, headers []blockchain.BlockHeader) error {
+	tip := t.bc.GetLastBlock()
+	request := blockchain.GetData{Hashes: []string{}}
+	previousHash := tip.Hash
+	for _, header := range headers {
+		if header.Index <= tip.Index {
+			continue
+		}
+		if header.PreviousHash != previousHash {
+			break
+		}
+		request.Hashes = append(request.Hashes, header.Hash)
+		previousHash = header.Hash
+	}
+	if len(request.Hashes) == 0 {
+		return nil
+	}
+	if len(request.Hashes) > blockchain.MaxGetData {
+		request.Hashes = request.Hashes[:blockchain.MaxGetData]
+	}
+	return c.send(MsgGetBlocks, request)
+}
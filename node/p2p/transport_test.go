@@ -0,0 +1,114 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// newTestTransport creates a transport listening on a loopback port, for a chain
+// with a proof of work difficulty of 1.
+func newTestTransport(t *testing.T, nodeID string) *Transport {
+	t.Helper()
+	bc, err := blockchain.NewBlockchain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Difficulty = 1
+	bc.Peers = &blockchain.PeerManager{NodeID: nodeID}
+	transport := NewTransport(bc, "")
+	if err := transport.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(transport.Close)
+	return transport
+}
+
+// waitFor waits until the condition holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestTransportGossip(t *testing.T) {
+	tests := []struct {
+		name   string
+		nodes  int
+		links  [][2]int // dialing node, dialed node
+		origin int      // node submitting the transaction and mining it
+	}{
+		{name: "pair", nodes: 2, links: [][2]int{{1, 0}}},
+		{name: "relayed", nodes: 3, links: [][2]int{{1, 0}, {2, 1}}},
+		{name: "relayed from the end", nodes: 3, links: [][2]int{{1, 0}, {2, 1}}, origin: 2},
+		{name: "mesh", nodes: 3, links: [][2]int{{1, 0}, {2, 0}, {2, 1}}, origin: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes := []*Transport{}
+			for i := 0; i < tt.nodes; i++ {
+				nodes = append(nodes, newTestTransport(t, fmt.Sprint("node-", i)))
+			}
+			connections := make([]int, tt.nodes)
+			for _, link := range tt.links {
+				if err := nodes[link[0]].Connect(nodes[link[1]].Addr()); err != nil {
+					t.Fatal(err)
+				}
+				connections[link[0]]++
+				connections[link[1]]++
+			}
+			for i, node := range nodes {
+				waitFor(t, fmt.Sprint("connections of node ", i), func() bool { return len(node.Conns()) == connections[i] })
+			}
+
+			// the transaction reaches every node
+			origin := nodes[tt.origin]
+			tx := blockchain.Transaction{Author: "alice", Content: "hello", Timestamp: time.Now().Unix()}
+			origin.bc.AddNewTransaction(&tx)
+			origin.BroadcastTransaction(tx)
+			for i, node := range nodes {
+				waitFor(t, fmt.Sprint("transaction on node ", i), func() bool {
+					status, ok := node.bc.TransactionStatus(tx.ID())
+					return ok && status.Status == blockchain.TxStatusPending
+				})
+			}
+
+			// so does the block mining it, confirming the transaction everywhere
+			if mined, err := origin.bc.MineBlock(); err != nil || !mined {
+				t.Fatalf("MineBlock() = %v, %v", mined, err)
+			}
+			origin.BroadcastBlock(origin.bc.GetLastBlock())
+			for i, node := range nodes {
+				waitFor(t, fmt.Sprint("block on node ", i), func() bool {
+					status, ok := node.bc.TransactionStatus(tx.ID())
+					return ok && status.Status == blockchain.TxStatusConfirmed
+				})
+				if pending := node.bc.PendingTransactions(); len(pending) != 0 {
+					t.Errorf("node %d has %d pending transactions", i, len(pending))
+				}
+				if mined, err := node.bc.MineBlock(); err != nil || mined {
+					t.Errorf("node %d mined the transaction again", i)
+				}
+			}
+
+			// the confirmed transaction gossiped again is rejected
+			msg, err := NewMessage(MsgTx, tx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, node := range nodes {
+				if err := node.handle(nil, msg); err == nil {
+					t.Errorf("node %d accepted the confirmed transaction", i)
+				}
+				if pending := node.bc.PendingTransactions(); len(pending) != 0 {
+					t.Errorf("node %d has %d pending transactions", i, len(pending))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// Delivery settings.
+const (
+	MaxAttempts     = 5               // attempts of a delivery before it is given up
+	RetryDelay      = 2 * time.Second // delay before the first retry, doubled after each attempt
+	DeliveryTimeout = 10 * time.Second
+	MaxDeliveryLog  = 500 // deliveries kept in the log
+)
+
+// Delivery headers.
+const (
+	SignatureHeader = "X-Webhook-Signature" // sha256=<hex HMAC-SHA256 of the body with the webhook secret>
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// deliveryClient is used for all webhook requests.
+var deliveryClient = &http.Client{Timeout: DeliveryTimeout}
+
+// Payload is the JSON body posted to a webhook.
+type Payload struct {
+	ID            string                  `json:"id"` // delivery id
+	Event         string                  `json:"event"`
+	WebhookID     string                  `json:"webhook_id"`
+	Time          int64                   `json:"time"`
+	Block         *blockchain.Block       `json:"block,omitempty"`
+	Transaction   *blockchain.Transaction `json:"transaction,omitempty"`
+	BlockHeight   int                     `json:"block_height,omitempty"`
+	BlockHash     string                  `json:"block_hash,omitempty"`
+	Confirmations int                     `json:"confirmations,omitempty"`
+}
+
+// Delivery is an entry of the delivery log.
+type Delivery struct {
+	ID          string `json:"id"`
+	WebhookID   string `json:"webhook_id"`
+	Event       string `json:"event"`
+	Created     int64  `json:"created"`
+	Attempts    int    `json:"attempts"`
+	LastAttempt int64  `json:"last_attempt,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"` // of the last attempt
+	Error       string `json:"error,omitempty"`       // of the last attempt
+	Delivered   bool   `json:"delivered"`
+}
+
+// Sign returns the signature header value of the body for the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run delivers the chain events to the webhooks, it never returns.
+func (m *Manager) Run() {
+	events, unsubscribe := m.bc.Events.Subscribe()
+	defer unsubscribe()
+	for event := range events {
+		// events only wake us up: events dropped while we are busy are caught up from the chain
+		if event.Type == blockchain.EventBlock || event.Type == blockchain.EventReorg {
+			m.notify()
+		}
+	}
+}
+
+// notify delivers the blocks added to the chain since the last notified block of each
+// webhook, and the transactions they bring to their confirmations. Blocks and confirmations
+// replaced by a reorg are notified again when reached on the new fork.
+func (m *Manager) notify() {
+	chain := m.bc.GetChain()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fork := len(m.chain) - 1
+	if fork > len(chain)-1 {
+		fork = len(chain) - 1
+	}
+	for fork > 0 && m.chain[fork].Hash != chain[fork].Hash {
+		fork--
+	}
+	for id, height := range m.notified {
+		if height > fork {
+			m.notified[id] = fork
+		}
+	}
+	for id, height := range m.confirmed {
+		if height > fork {
+			m.confirmed[id] = fork
+		}
+	}
+	m.chain = chain
+
+	tip := len(chain) - 1
+	for _, webhook := range m.webhooks {
+		if webhook.wants(EventBlock) {
+			for height := m.notified[webhook.ID] + 1; height <= tip; height++ {
+				if block := chain[height]; m.blockMatches(webhook, block) {
+					m.dispatch(webhook, Payload{Event: EventBlock, Block: &block})
+				}
+				m.notified[webhook.ID] = height
+			}
+		}
+		if !webhook.wants(EventTxConfirmed) {
+			continue
+		}
+		// blocks reaching the confirmations (several after a sync)
+		target := tip - webhook.Confirmations + 1
+		height := m.confirmed[webhook.ID] + 1
+		if height < 1 {
+			height = 1
+		}
+		for ; height <= target; height++ {
+			confirmedBlock := chain[height]
+			for _, tx := range confirmedBlock.Transactions {
+				if !webhook.matches(tx) {
+					continue
+				}
+				tx := tx
+				m.dispatch(webhook, Payload{
+					Event:         EventTxConfirmed,
+					Transaction:   &tx,
+					BlockHeight:   confirmedBlock.Index,
+					BlockHash:     confirmedBlock.Hash,
+					Confirmations: tip - confirmedBlock.Index + 1,
+				})
+			}
+			m.confirmed[webhook.ID] = height
+		}
+	}
+}
+
+// blockMatches reports if the block passes the webhook filters.
+func (m *Manager) blockMatches(webhook Webhook, block blockchain.Block) bool {
+	if webhook.Author == "" {
+		return true
+	}
+	for _, tx := range block.Transactions {
+		if webhook.matches(tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch logs the delivery of the payload and sends it in the background (under lock).
+func (m *Manager) dispatch(webhook Webhook, payload Payload) {
+	payload.ID = randomID()
+	payload.WebhookID = webhook.ID
+	payload.Time = time.Now().Unix()
+	delivery := &Delivery{ID: payload.ID, WebhookID: webhook.ID, Event: payload.Event, Created: payload.Time}
+	m.deliveries = append(m.deliveries, delivery)
+	if len(m.deliveries) > MaxDeliveryLog {
+		m.deliveries = m.deliveries[len(m.deliveries)-MaxDeliveryLog:]
+	}
+	go m.deliver(webhook, payload, delivery)
+}
+
+// deliver posts the payload to the webhook, retrying with exponential backoff until
+// it is answered with a 2xx status or MaxAttempts is reached.
+func (m *Manager) deliver(webhook Webhook, payload Payload, delivery *Delivery) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Println("Error marshaling webhook payload:", err)
+		return
+	}
+	delay := RetryDelay
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		statusCode, err := post(webhook, payload, body)
+		m.mu.Lock()
+		delivery.Attempts = attempt
+		delivery.LastAttempt = time.Now().Unix()
+		delivery.StatusCode = statusCode
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		delivery.Delivered = err == nil
+		m.mu.Unlock()
+		if err == nil {
+			return
+		}
+		if attempt < MaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	log.Printf("Gave up delivery %s to webhook %s after %d attempts", delivery.ID, webhook.ID, MaxAttempts)
+}
+
+// post sends the signed payload body to the webhook url.
+func post(webhook Webhook, payload Payload, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, payload.Event)
+	request.Header.Set(DeliveryHeader, payload.ID)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	response, err := deliveryClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("status %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// Deliveries returns the logged deliveries of the webhook, newest first.
+func (m *Manager) Deliveries(webhookID string) []Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deliveries := []Delivery{}
+	for i := len(m.deliveries) - 1; i >= 0; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, *m.deliveries[i])
+		}
+	}
+	return deliveries
+}
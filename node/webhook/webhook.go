@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// Webhook event types.
+const (
+	EventBlock       = "block"        // a block was added to the chain
+	EventTxConfirmed = "tx_confirmed" // a transaction reached the webhook confirmations
+)
+
+// Registry settings.
+const (
+	MaxWebhooks      = 100
+	MaxConfirmations = 100
+)
+
+// ErrNotFound is returned for unknown webhook ids.
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook is a URL notified of the chain events matching its filters.
+type Webhook struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Confirmations of the transactions notified by tx_confirmed, the block including
+	// a transaction is its first confirmation.
+	Confirmations int    `json:"confirmations,omitempty"`
+	Author        string `json:"author,omitempty"` // only blocks/transactions of this author
+	Secret        string `json:"secret,omitempty"` // HMAC key of the payload signatures
+	Created       int64  `json:"created"`
+}
+
+// Manager holds the registered webhooks, saved to a file, and delivers the chain events to them.
+type Manager struct {
+	bc         *blockchain.Blockchain
+	file       string
+	webhooks   []Webhook
+	chain      []blockchain.Block // chain at the last notification
+	notified   map[string]int     // webhook id -> height of the last notified block
+	confirmed  map[string]int     // webhook id -> height of the last block with notified confirmations
+	deliveries []*Delivery        // delivery log, oldest first
+	mu         sync.Mutex
+}
+
+// NewManager creates the webhook manager of the chain, loading the webhooks from file if
+// it exists. An empty file name keeps the webhooks in memory only.
+func NewManager(bc *blockchain.Blockchain, file string) (*Manager, error) {
+	m := &Manager{bc: bc, file: file, webhooks: []Webhook{}, chain: bc.GetChain(), notified: map[string]int{}, confirmed: map[string]int{}}
+	if file == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.webhooks); err != nil {
+		return nil, fmt.Errorf("webhooks %s: %v", file, err)
+	}
+	// blocks and confirmations reached while we were stopped are not notified
+	for _, webhook := range m.webhooks {
+		m.track(webhook)
+	}
+	return m, nil
+}
+
+// Save writes the webhooks file.
+func (m *Manager) Save() error {
+	if m.file == "" {
+		return nil
+	}
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.webhooks, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(m.file, data, 0600)
+}
+
+// Register checks and adds a webhook, with a new id and a random secret if it has none.
+func (m *Manager) Register(webhook Webhook) (Webhook, error) {
+	address, err := url.Parse(webhook.URL)
+	if err != nil || (address.Scheme != "http" && address.Scheme != "https") || address.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid url %q", webhook.URL)
+	}
+	if len(webhook.Events) == 0 {
+		return Webhook{}, fmt.Errorf("no events")
+	}
+	for _, event := range webhook.Events {
+		if event != EventBlock && event != EventTxConfirmed {
+			return Webhook{}, fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if webhook.Confirmations == 0 {
+		webhook.Confirmations = 1
+	}
+	if webhook.Confirmations < 0 || webhook.Confirmations > MaxConfirmations {
+		return Webhook{}, fmt.Errorf("confirmations must be between 1 and %d", MaxConfirmations)
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = randomID()
+	}
+	webhook.ID = randomID()
+	webhook.Created = time.Now().Unix()
+
+	m.mu.Lock()
+	if len(m.webhooks) >= MaxWebhooks {
+		m.mu.Unlock()
+		return Webhook{}, fmt.Errorf("too many webhooks")
+	}
+	m.webhooks = append(m.webhooks, webhook)
+	// only blocks and confirmations reached from now on are notified
+	m.track(webhook)
+	m.mu.Unlock()
+	return webhook, m.Save()
+}
+
+// Remove deletes the webhook with the given id.
+func (m *Manager) Remove(id string) error {
+	m.mu.Lock()
+	found := false
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			delete(m.notified, id)
+			delete(m.confirmed, id)
+			found = true
+			break
+		}
+	}
+	m.mu.Unlock()
+	if !found {
+		return ErrNotFound
+	}
+	return m.Save()
+}
+
+// Webhooks returns the registered webhooks, without their secrets.
+func (m *Manager) Webhooks() []Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhooks := []Webhook{}
+	for _, webhook := range m.webhooks {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+// Get returns the webhook with the given id, without its secret.
+func (m *Manager) Get(id string) (Webhook, error) {
+	for _, webhook := range m.Webhooks() {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return Webhook{}, ErrNotFound
+}
+
+// track starts notifying the webhook of the blocks added after our last block, and of
+// the confirmations reached from now on (under lock).
+func (m *Manager) track(webhook Webhook) {
+	tip := m.bc.GetLastBlock().Index
+	m.notified[webhook.ID] = tip
+	m.confirmed[webhook.ID] = tip + 1 - webhook.Confirmations
+}
+
+// wants reports if the webhook is notified of the event type.
+func (webhook Webhook) wants(event string) bool {
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports if the transaction passes the webhook filters.
+func (webhook Webhook) matches(tx blockchain.Transaction) bool {
+	return webhook.Author == "" || tx.Author == webhook.Author
+}
+
+// randomID returns a random hex string.
+func randomID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
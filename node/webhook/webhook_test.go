@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chokey2nv/ultainfinity/node/blockchain"
+)
+
+// mine adds a block for each post of the author to the chain.
+func mine(t *testing.T, bc *blockchain.Blockchain, blocks int, author string) {
+	t.Helper()
+	for i := 0; i < blocks; i++ {
+		bc.AddNewTransaction(&blockchain.Transaction{Author: author, Content: fmt.Sprint("post ", i), Timestamp: int64(i)})
+		if _, err := bc.MineBlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name       string
+		webhook    Webhook
+		update     func(t *testing.T, bc *blockchain.Blockchain, m *Manager)
+		wantBlocks int
+		wantTxs    int
+	}{
+		{name: "block", webhook: Webhook{Events: []string{EventBlock}}, update: func(t *testing.T, bc *blockchain.Blockchain, m *Manager) {
+			mine(t, bc, 1, "alice")
+			m.notify()
+		}, wantBlocks: 1},
+		{name: "blocks of a sync longer than the event buffer", webhook: Webhook{Events: []string{EventBlock}}, update: func(t *testing.T, bc *blockchain.Blockchain, m *Manager) {
+			mine(t, bc, blockchain.EventBufferSize+10, "alice")
+			m.notify()
+			m.notify()
+		}, wantBlocks: blockchain.EventBufferSize + 10},
+		{name: "author", webhook: Webhook{Events: []string{EventBlock, EventTxConfirmed}, Author: "bob"}, update: func(t *testing.T, bc *blockchain.Blockchain, m *Manager) {
+			mine(t, bc, 2, "alice")
+			mine(t, bc, 1, "bob")
+			m.notify()
+		}, wantBlocks: 1, wantTxs: 1},
+		{name: "confirmations", webhook: Webhook{Events: []string{EventTxConfirmed}, Confirmations: 3}, update: func(t *testing.T, bc *blockchain.Blockchain, m *Manager) {
+			mine(t, bc, 4, "alice")
+			m.notify()
+		}, wantTxs: 3}, // the block before the webhook reaches its confirmations too
+		{name: "reorg", webhook: Webhook{Events: []string{EventBlock, EventTxConfirmed}, Confirmations: 2}, update: func(t *testing.T, bc *blockchain.Blockchain, m *Manager) {
+			mine(t, bc, 2, "alice")
+			m.notify()
+			fork := &blockchain.Blockchain{Difficulty: bc.Difficulty, Chain: append([]blockchain.Block{}, bc.GetChain()[:3]...)}
+			mine(t, fork, 2, "bob")
+			bc.ReplaceChain(fork.GetChain())
+			m.notify()
+		}, wantBlocks: 4, wantTxs: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer server.Close()
+			bc, err := blockchain.NewBlockchain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bc.Difficulty = 1
+			mine(t, bc, 1, "alice")
+			m, err := NewManager(bc, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.webhook.URL = server.URL
+			webhook, err := m.Register(tt.webhook)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.update(t, bc, m)
+			blocks, txs := 0, 0
+			for _, delivery := range m.Deliveries(webhook.ID) {
+				switch delivery.Event {
+				case EventBlock:
+					blocks++
+				case EventTxConfirmed:
+					txs++
+				}
+			}
+			if blocks != tt.wantBlocks || txs != tt.wantTxs {
+				t.Errorf("%d block and %d tx_confirmed deliveries, want %d and %d", blocks, txs, tt.wantBlocks, tt.wantTxs)
+			}
+		})
+	}
+}